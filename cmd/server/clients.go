@@ -0,0 +1,446 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"reflect"
+	"sort"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/nduyhai/hydra-bridge/internal/hydra"
+)
+
+// clientsFile is the YAML layout used by export/import/sync:
+//
+//	clients:
+//	  - client_id: demo-client
+//	    client_secret_env: DEMO_CLIENT_SECRET
+//	    redirect_uris: [http://localhost:8091/success]
+type clientsFile struct {
+	Clients []clientSpec `yaml:"clients"`
+}
+
+// clientSpec lets git-managed files pull secrets from the environment
+// instead of committing them. Fields OAuth2Client doesn't name land in
+// Extra (yaml.v3 only honours an inline map at the outer level).
+type clientSpec struct {
+	hydra.OAuth2Client `yaml:",inline"`
+	ClientSecretEnv    string         `yaml:"client_secret_env,omitempty"`
+	Extra              map[string]any `yaml:",inline"`
+}
+
+const clientsUsage = `usage: hydra-bridge clients <command> [flags]
+
+commands:
+  list                      list clients
+  get <id>                  show one client
+  create -f FILE            create the clients in FILE
+  update -f FILE            replace the clients in FILE
+  delete <id>               delete a client
+  rotate-secret <id>        generate and set a new client secret
+  export [-f FILE]          write all clients as YAML (stdout by default)
+  import -f FILE            create clients from FILE that don't exist yet
+  sync -f FILE [--dry-run] [--prune]
+                            reconcile Hydra with FILE; --prune deletes clients not in FILE
+
+flags:
+  --admin URL               Hydra admin URL (default $HYDRA_ADMIN_URL)
+  -o yaml|json|table        output format for list/get
+`
+
+func runClients(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, clientsUsage)
+		return 2
+	}
+	cmd, args := args[0], args[1:]
+
+	fs := flag.NewFlagSet("clients "+cmd, flag.ContinueOnError)
+	admin := fs.String("admin", os.Getenv("HYDRA_ADMIN_URL"), "Hydra admin URL")
+	file := fs.String("f", "", "YAML file")
+	output := fs.String("o", "", "output format: yaml, json or table")
+	dryRun := fs.Bool("dry-run", false, "print the plan without changing Hydra")
+	prune := fs.Bool("prune", false, "delete clients that are not in the file")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *admin == "" {
+		fmt.Fprintln(os.Stderr, "missing --admin or HYDRA_ADMIN_URL")
+		return 2
+	}
+	hc := hydra.NewAdminClient(*admin)
+
+	var err error
+	switch cmd {
+	case "list":
+		err = clientsList(hc, *output)
+	case "get":
+		err = clientsGet(hc, fs.Arg(0), *output)
+	case "create":
+		err = clientsApply(hc, *file, false)
+	case "update":
+		err = clientsApply(hc, *file, true)
+	case "delete":
+		if fs.Arg(0) == "" {
+			err = errors.New("missing client id")
+			break
+		}
+		if err = hc.DeleteClient(fs.Arg(0)); err == nil {
+			fmt.Printf("deleted %s\n", fs.Arg(0))
+		}
+	case "rotate-secret":
+		err = clientsRotate(hc, fs.Arg(0))
+	case "export":
+		err = clientsExport(hc, *file)
+	case "import":
+		err = clientsImport(hc, *file)
+	case "sync":
+		err = clientsSync(hc, *file, *dryRun, *prune)
+	default:
+		fmt.Fprint(os.Stderr, clientsUsage)
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "clients %s: %v\n", cmd, err)
+		return 1
+	}
+	return 0
+}
+
+func readClientsFile(path string) ([]hydra.OAuth2Client, error) {
+	if path == "" {
+		return nil, errors.New("missing -f FILE")
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f clientsFile
+	if err := yaml.Unmarshal(b, &f); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	out := make([]hydra.OAuth2Client, 0, len(f.Clients))
+	seen := map[string]bool{}
+	for _, spec := range f.Clients {
+		c := spec.OAuth2Client
+		c.Extra = spec.Extra
+		if c.ClientID == "" {
+			return nil, fmt.Errorf("%s: client without client_id", path)
+		}
+		if seen[c.ClientID] {
+			return nil, fmt.Errorf("%s: duplicate client_id %q", path, c.ClientID)
+		}
+		seen[c.ClientID] = true
+		if spec.ClientSecretEnv != "" {
+			c.ClientSecret = os.Getenv(spec.ClientSecretEnv)
+			if c.ClientSecret == "" {
+				return nil, fmt.Errorf("%s: %s is empty (client %s)", path, spec.ClientSecretEnv, c.ClientID)
+			}
+		}
+		out = append(out, c)
+	}
+	return out, nil
+}
+
+func writeYAML(w io.Writer, v any) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	defer enc.Close()
+	return enc.Encode(v)
+}
+
+func printClients(cs []hydra.OAuth2Client, format string) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(cs)
+	case "yaml":
+		specs := make([]clientSpec, 0, len(cs))
+		for _, c := range cs {
+			specs = append(specs, clientSpec{OAuth2Client: c, Extra: c.Extra})
+		}
+		return writeYAML(os.Stdout, specs)
+	default:
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "CLIENT_ID\tNAME\tAUTH_METHOD\tGRANT_TYPES\tREDIRECT_URIS")
+		for _, c := range cs {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%v\t%v\n", c.ClientID, c.ClientName, c.TokenEndpointAuthMethod, c.GrantTypes, c.RedirectURIs)
+		}
+		return tw.Flush()
+	}
+}
+
+func clientsList(hc *hydra.AdminClient, format string) error {
+	cs, err := hc.ListClients()
+	if err != nil {
+		return err
+	}
+	return printClients(cs, format)
+}
+
+func clientsGet(hc *hydra.AdminClient, id, format string) error {
+	if id == "" {
+		return errors.New("missing client id")
+	}
+	c, err := hc.GetClient(id)
+	if err != nil {
+		return err
+	}
+	if format == "" {
+		format = "yaml"
+	}
+	return printClients([]hydra.OAuth2Client{*c}, format)
+}
+
+func clientsApply(hc *hydra.AdminClient, path string, update bool) error {
+	cs, err := readClientsFile(path)
+	if err != nil {
+		return err
+	}
+	for _, c := range cs {
+		if update {
+			var cur *hydra.OAuth2Client
+			if cur, err = hc.GetClient(c.ClientID); err == nil {
+				_, err = hc.UpdateClient(withCurrent(*cur, c))
+			}
+		} else {
+			_, err = hc.CreateClient(c)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", c.ClientID, err)
+		}
+		fmt.Printf("%s %s\n", map[bool]string{true: "updated", false: "created"}[update], c.ClientID)
+	}
+	return nil
+}
+
+func newClientSecret() string {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func clientsRotate(hc *hydra.AdminClient, id string) error {
+	if id == "" {
+		return errors.New("missing client id")
+	}
+	secret := newClientSecret()
+	if err := hc.SetClientSecret(id, secret); err != nil {
+		return err
+	}
+	// Printed once; Hydra only stores a hash.
+	fmt.Printf("client_id:     %s\nclient_secret: %s\n", id, secret)
+	return nil
+}
+
+func clientsExport(hc *hydra.AdminClient, path string) error {
+	cs, err := hc.ListClients()
+	if err != nil {
+		return err
+	}
+	sort.Slice(cs, func(i, j int) bool { return cs[i].ClientID < cs[j].ClientID })
+	f := clientsFile{}
+	for _, c := range cs {
+		c.ClientSecret = "" // Hydra never returns it anyway
+		f.Clients = append(f.Clients, clientSpec{OAuth2Client: c, Extra: c.Extra})
+	}
+	if path == "" {
+		return writeYAML(os.Stdout, f)
+	}
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	return writeYAML(out, f)
+}
+
+func clientsImport(hc *hydra.AdminClient, path string) error {
+	want, err := readClientsFile(path)
+	if err != nil {
+		return err
+	}
+	have, err := existingClients(hc)
+	if err != nil {
+		return err
+	}
+	for _, c := range want {
+		if _, ok := have[c.ClientID]; ok {
+			fmt.Printf("skip %s (exists)\n", c.ClientID)
+			continue
+		}
+		if _, err := hc.CreateClient(c); err != nil {
+			return fmt.Errorf("%s: %w", c.ClientID, err)
+		}
+		fmt.Printf("created %s\n", c.ClientID)
+	}
+	return nil
+}
+
+func existingClients(hc *hydra.AdminClient) (map[string]hydra.OAuth2Client, error) {
+	cs, err := hc.ListClients()
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]hydra.OAuth2Client, len(cs))
+	for _, c := range cs {
+		out[c.ClientID] = c
+	}
+	return out, nil
+}
+
+// withCurrent fills in the fields of cur that want doesn't name, so the
+// full-replace PUT behind UpdateClient only changes what the file manages.
+// Fields OAuth2Client models are always taken from want.
+func withCurrent(cur, want hydra.OAuth2Client) hydra.OAuth2Client {
+	extra := maps.Clone(cur.Extra)
+	if extra == nil && len(want.Extra) > 0 {
+		extra = map[string]any{}
+	}
+	for k, v := range want.Extra {
+		extra[k] = v
+	}
+	want.Extra = extra
+	return want
+}
+
+// clientFields strips what Hydra owns (timestamps) or won't return (secret)
+// and round-trips through JSON so nil and empty values compare equal.
+func clientFields(c hydra.OAuth2Client) map[string]any {
+	c.ClientSecret = ""
+	b, _ := json.Marshal(c)
+	var m map[string]any
+	_ = json.Unmarshal(b, &m)
+	delete(m, "created_at")
+	delete(m, "updated_at")
+	for k, v := range m {
+		if v == nil || reflect.DeepEqual(v, []any{}) || reflect.DeepEqual(v, map[string]any{}) || v == "" || v == false {
+			delete(m, k)
+		}
+	}
+	return m
+}
+
+// clientDiff lists "field: old -> new" for every field that differs.
+// Fields Hydra fills with defaults are only compared when the file sets them.
+func clientDiff(have, want hydra.OAuth2Client) []string {
+	h, w := clientFields(have), clientFields(want)
+	keys := map[string]bool{}
+	for k := range w {
+		keys[k] = true
+	}
+	for k := range h {
+		if _, defaulted := hydraDefaults[k]; !defaulted {
+			keys[k] = true
+		}
+	}
+	var out []string
+	for k := range keys {
+		if !reflect.DeepEqual(h[k], w[k]) {
+			out = append(out, fmt.Sprintf("%s: %v -> %v", k, fmtVal(h[k]), fmtVal(w[k])))
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// hydraDefaults are set by Hydra when the client omits them.
+var hydraDefaults = map[string]struct{}{
+	"grant_types":                {},
+	"response_types":             {},
+	"scope":                      {},
+	"token_endpoint_auth_method": {},
+	"client_name":                {},
+	"audience":                   {},
+}
+
+func fmtVal(v any) string {
+	if v == nil {
+		return "<unset>"
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+func clientsSync(hc *hydra.AdminClient, path string, dryRun, prune bool) error {
+	want, err := readClientsFile(path)
+	if err != nil {
+		return err
+	}
+	have, err := existingClients(hc)
+	if err != nil {
+		return err
+	}
+
+	var creates, updates, deletes int
+	inFile := map[string]bool{}
+	for _, c := range want {
+		inFile[c.ClientID] = true
+		cur, ok := have[c.ClientID]
+		if !ok {
+			creates++
+			fmt.Printf("+ %s\n", c.ClientID)
+			if !dryRun {
+				if _, err := hc.CreateClient(c); err != nil {
+					return fmt.Errorf("create %s: %w", c.ClientID, err)
+				}
+			}
+			continue
+		}
+		c = withCurrent(cur, c)
+		diff := clientDiff(cur, c)
+		if len(diff) == 0 && c.ClientSecret == "" {
+			continue
+		}
+		updates++
+		fmt.Printf("~ %s\n", c.ClientID)
+		for _, d := range diff {
+			fmt.Printf("    %s\n", d)
+		}
+		if c.ClientSecret != "" {
+			// can't diff secrets; always re-set them so the file stays the source of truth
+			fmt.Printf("    client_secret: (set from file)\n")
+		}
+		if !dryRun {
+			if _, err := hc.UpdateClient(c); err != nil {
+				return fmt.Errorf("update %s: %w", c.ClientID, err)
+			}
+		}
+	}
+
+	if prune {
+		ids := make([]string, 0, len(have))
+		for id := range have {
+			if !inFile[id] {
+				ids = append(ids, id)
+			}
+		}
+		sort.Strings(ids)
+		for _, id := range ids {
+			deletes++
+			fmt.Printf("- %s\n", id)
+			if !dryRun {
+				if err := hc.DeleteClient(id); err != nil {
+					return fmt.Errorf("delete %s: %w", id, err)
+				}
+			}
+		}
+	}
+
+	mode := "applied"
+	if dryRun {
+		mode = "dry-run"
+	}
+	fmt.Printf("%s: %d to create, %d to update, %d to delete\n", mode, creates, updates, deletes)
+	return nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/nduyhai/hydra-bridge/internal/hydra"
+)
+
+func TestClientFields(t *testing.T) {
+	tests := []struct {
+		name string
+		in   hydra.OAuth2Client
+		want map[string]any
+	}{
+		{
+			name: "zero values dropped",
+			in:   hydra.OAuth2Client{ClientID: "a", RedirectURIs: []string{}, Metadata: map[string]any{}},
+			want: map[string]any{"client_id": "a"},
+		},
+		{
+			name: "secret and timestamps ignored",
+			in:   hydra.OAuth2Client{ClientID: "a", ClientSecret: "s"},
+			want: map[string]any{"client_id": "a"},
+		},
+		{
+			name: "extras kept, numbers normalised",
+			in: hydra.OAuth2Client{ClientID: "a", SkipConsent: true,
+				Extra: map[string]any{"logo_uri": "https://x/logo.png", "access_token_lifespan": 3600, "contacts": []any{}}},
+			want: map[string]any{"client_id": "a", "skip_consent": true,
+				"logo_uri": "https://x/logo.png", "access_token_lifespan": float64(3600)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := clientFields(tt.in); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("clientFields = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientDiff(t *testing.T) {
+	have := hydra.OAuth2Client{
+		ClientID:                "a",
+		ClientName:              "A",
+		GrantTypes:              []string{"authorization_code"},
+		Scope:                   "openid",
+		TokenEndpointAuthMethod: "client_secret_basic",
+		RedirectURIs:            []string{"https://a/cb"},
+		Extra:                   map[string]any{"logo_uri": "https://a/logo.png"},
+	}
+
+	tests := []struct {
+		name string
+		want hydra.OAuth2Client
+		diff []string
+	}{
+		{
+			name: "same",
+			want: have,
+		},
+		{
+			name: "hydra defaults not in file",
+			want: hydra.OAuth2Client{ClientID: "a", RedirectURIs: []string{"https://a/cb"}},
+		},
+		{
+			name: "secret alone is not a diff",
+			want: hydra.OAuth2Client{ClientID: "a", ClientSecret: "s", RedirectURIs: []string{"https://a/cb"}},
+		},
+		{
+			name: "changed and added",
+			want: hydra.OAuth2Client{ClientID: "a", Scope: "openid email", RedirectURIs: []string{"https://a/cb", "https://a/cb2"}},
+			diff: []string{
+				`redirect_uris: ["https://a/cb"] -> ["https://a/cb","https://a/cb2"]`,
+				`scope: "openid" -> "openid email"`,
+			},
+		},
+		{
+			name: "removed field",
+			want: hydra.OAuth2Client{ClientID: "a"},
+			diff: []string{`redirect_uris: ["https://a/cb"] -> <unset>`},
+		},
+		{
+			name: "extras not in file",
+			want: hydra.OAuth2Client{ClientID: "a", RedirectURIs: []string{"https://a/cb"}},
+		},
+		{
+			name: "extra changed",
+			want: hydra.OAuth2Client{ClientID: "a", RedirectURIs: []string{"https://a/cb"},
+				Extra: map[string]any{"logo_uri": "https://a/new.png"}},
+			diff: []string{`logo_uri: "https://a/logo.png" -> "https://a/new.png"`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// as sync does: fields the file doesn't name come from Hydra
+			if got := clientDiff(have, withCurrent(have, tt.want)); !reflect.DeepEqual(got, tt.diff) {
+				t.Errorf("clientDiff =\n  %q\nwant\n  %q", got, tt.diff)
+			}
+		})
+	}
+}
+
+func TestWithCurrent(t *testing.T) {
+	cur := hydra.OAuth2Client{
+		ClientID:   "a",
+		ClientName: "Old",
+		Extra:      map[string]any{"jwks": map[string]any{"keys": []any{}}, "logo_uri": "https://a/old.png"},
+	}
+	want := hydra.OAuth2Client{ClientID: "a", Extra: map[string]any{"logo_uri": "https://a/new.png"}}
+
+	got := withCurrent(cur, want)
+	if got.ClientName != "" {
+		t.Errorf("ClientName = %q, want the file's (empty) value", got.ClientName)
+	}
+	wantExtra := map[string]any{"jwks": map[string]any{"keys": []any{}}, "logo_uri": "https://a/new.png"}
+	if !reflect.DeepEqual(got.Extra, wantExtra) {
+		t.Errorf("Extra = %v, want %v", got.Extra, wantExtra)
+	}
+	if cur.Extra["logo_uri"] != "https://a/old.png" {
+		t.Errorf("withCurrent modified the current client")
+	}
+}
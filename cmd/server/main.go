@@ -1,13 +1,28 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/nduyhai/hydra-bridge/internal/audit"
 	"github.com/nduyhai/hydra-bridge/internal/hydra"
+	"github.com/nduyhai/hydra-bridge/internal/identity"
+	"github.com/nduyhai/hydra-bridge/internal/mail"
+	"github.com/nduyhai/hydra-bridge/internal/otp"
+	"github.com/nduyhai/hydra-bridge/internal/password"
 	"github.com/nduyhai/hydra-bridge/internal/plugins"
+	"github.com/nduyhai/hydra-bridge/internal/registration"
+	"github.com/nduyhai/hydra-bridge/internal/reset"
+	"github.com/nduyhai/hydra-bridge/internal/terms"
+	"github.com/nduyhai/hydra-bridge/internal/tlsutil"
 	"github.com/nduyhai/hydra-bridge/internal/ui"
 )
 
@@ -47,9 +62,113 @@ func mustEnvBool(key string, def bool) bool {
 	}
 	return def
 }
+
+// newMailer picks SMTP when MAIL_SMTP_ADDR is set, else writes .eml files to
+// MAIL_FILE_DIR. nil means no mail is configured.
+func newMailer() mail.Sender {
+	from := mustEnvDefault("MAIL_FROM", "Tripzy <no-reply@tripzy.local>")
+	if addr := mustEnvDefault("MAIL_SMTP_ADDR", ""); addr != "" {
+		return &mail.SMTPSender{
+			Addr:     addr,
+			From:     from,
+			Username: mustEnvDefault("MAIL_SMTP_USERNAME", ""),
+			Password: mustEnvDefault("MAIL_SMTP_PASSWORD", ""),
+		}
+	}
+	if dir := mustEnvDefault("MAIL_FILE_DIR", ""); dir != "" {
+		return &mail.FileSender{Dir: dir, From: from}
+	}
+	return nil
+}
+
+// newOTP wires the second-factor code transports:
+// OTP_EMAIL_TRANSPORT=mail|log and OTP_SMS_TRANSPORT=http|log.
+func newOTP(cfg ui.Config, mailer mail.Sender) *otp.Service {
+	transports := map[otp.Channel]otp.Transport{}
+	switch t := mustEnvDefault("OTP_EMAIL_TRANSPORT", ""); t {
+	case "":
+	case "mail":
+		if mailer == nil {
+			log.Fatalf("OTP_EMAIL_TRANSPORT=mail needs MAIL_SMTP_ADDR or MAIL_FILE_DIR")
+		}
+		transports[otp.Email] = &otp.MailTransport{Sender: mailer}
+	case "log":
+		transports[otp.Email] = &otp.LogTransport{Channel: otp.Email}
+	default:
+		log.Fatalf("invalid OTP_EMAIL_TRANSPORT %q", t)
+	}
+	switch t := mustEnvDefault("OTP_SMS_TRANSPORT", ""); t {
+	case "":
+	case "http":
+		transports[otp.SMS] = &otp.HTTPSMSTransport{
+			URL:   mustEnv("OTP_SMS_URL"),
+			Token: mustEnvDefault("OTP_SMS_TOKEN", ""),
+		}
+	case "log":
+		transports[otp.SMS] = &otp.LogTransport{Channel: otp.SMS}
+	default:
+		log.Fatalf("invalid OTP_SMS_TRANSPORT %q", t)
+	}
+	if len(transports) == 0 {
+		return nil
+	}
+	return otp.New(otp.Config{
+		Secret:      []byte("otp|" + cfg.CookieAuth),
+		Digits:      mustEnvInt("OTP_DIGITS", 6),
+		TTL:         envSeconds("OTP_TTL_SECONDS", 300),
+		MaxAttempts: mustEnvInt("OTP_MAX_ATTEMPTS", 5),
+		Resend:      envSeconds("OTP_RESEND_SECONDS", 30),
+	}, transports)
+}
+
+// registerSocial adds the social providers whose <NAME>_CLIENT_ID is set.
+// <NAME>_AUTH_URL, _TOKEN_URL and _USERINFO_URL (GitHub: _API_URL) override
+// the upstream endpoints, e.g. to point at local stubs.
+func registerSocial(reg *plugins.Registry, cfg ui.Config) {
+	social := func(prefix, userInfoKey string) (plugins.SocialConfig, bool) {
+		id := mustEnvDefault(prefix+"_CLIENT_ID", "")
+		if id == "" {
+			return plugins.SocialConfig{}, false
+		}
+		return plugins.SocialConfig{
+			ClientID:     id,
+			ClientSecret: mustEnv(prefix + "_CLIENT_SECRET"),
+			RedirectURL:  strings.TrimSuffix(cfg.PublicURL, "/") + ui.OAuthCallbackPath,
+			Scopes:       strings.Fields(mustEnvDefault(prefix+"_SCOPES", "")),
+			AuthURL:      mustEnvDefault(prefix+"_AUTH_URL", ""),
+			TokenURL:     mustEnvDefault(prefix+"_TOKEN_URL", ""),
+			UserInfoURL:  mustEnvDefault(prefix+userInfoKey, ""),
+		}, true
+	}
+	if sc, ok := social("GITHUB", "_API_URL"); ok {
+		reg.Register(plugins.NewGitHubPlugin(sc))
+	}
+	if sc, ok := social("GOOGLE", "_USERINFO_URL"); ok {
+		reg.Register(plugins.NewGooglePlugin(sc, mustEnvDefault("GOOGLE_HOSTED_DOMAIN", "")))
+	}
+	if sc, ok := social("MICROSOFT", "_USERINFO_URL"); ok {
+		reg.Register(plugins.NewMicrosoftPlugin(sc,
+			mustEnvDefault("MICROSOFT_AUTHORITY", ""),
+			mustEnvDefault("MICROSOFT_TENANT", "common"),
+			strings.Fields(strings.ReplaceAll(mustEnvDefault("MICROSOFT_ALLOWED_TENANTS", ""), ",", " "))))
+	}
+}
+
+func envSeconds(key string, def int) time.Duration {
+	return time.Duration(mustEnvInt(key, def)) * time.Second
+}
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "clients" {
+		os.Exit(runClients(os.Args[2:]))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
 	cfg := ui.Config{
 		Addr:        mustEnv("BRIDGE_ADDR"),
+		PublicURL:   mustEnvDefault("BRIDGE_PUBLIC_URL", "http://localhost:8081"),
 		HydraAdmin:  mustEnv("HYDRA_ADMIN_URL"),
 		HydraPublic: mustEnv("HYDRA_PUBLIC_URL"),
 		LoginAPIURL: mustEnv("LOGIN_API_URL"),
@@ -65,17 +184,206 @@ func main() {
 		CookieDomain:      mustEnvDefault("COOKIE_DOMAIN", ""),
 		CookieSecure:      mustEnvBool("COOKIE_SECURE", false),
 		CookieSameSite:    mustEnvDefault("COOKIE_SAMESITE", "lax"),
+
+		HealthCacheSeconds: mustEnvInt("HEALTH_CACHE_SECONDS", 5),
+
+		CSPExtra:          mustEnvDefault("CSP_EXTRA", ""),
+		FrameAncestors:    ui.ParseClientLists(mustEnvDefault("FRAME_ANCESTORS", "")),
+		HSTSMaxAgeSeconds: mustEnvInt("HSTS_MAX_AGE_SECONDS", 0),
+
+		CSRFTTLSeconds: mustEnvInt("CSRF_TTL_SECONDS", 3600),
+
+		APIAllowedOrigins: ui.ParseOrigins(mustEnvDefault("API_ALLOWED_ORIGINS", "")),
+
+		ProviderDomains: ui.ParseDomainMap(mustEnvDefault("HRD_DOMAINS", "")),
+		ClientProviders: ui.ParseClientLists(mustEnvDefault("CLIENT_PROVIDERS", "")),
+
+		PolicyFile: mustEnvDefault("POLICY_FILE", ""),
+		HooksFile:  mustEnvDefault("HOOKS_FILE", ""),
+
+		LinkReauthSeconds: mustEnvInt("LINK_REAUTH_SECONDS", 600),
+
+		LockoutMaxFailures: mustEnvInt("LOCKOUT_MAX_FAILURES", 5),
+		LockoutSeconds:     mustEnvInt("LOCKOUT_SECONDS", 900),
+	}
+	classes, err := password.ParseClasses(mustEnvDefault("PASSWORD_REQUIRE", ""))
+	if err != nil {
+		log.Fatalf("PASSWORD_REQUIRE: %v", err)
+	}
+	cfg.PasswordPolicy = password.Policy{
+		MinLength: mustEnvInt("PASSWORD_MIN_LENGTH", 10),
+		MaxLength: mustEnvInt("PASSWORD_MAX_LENGTH", 128),
+		Require:   classes,
 	}
 
-	hc := hydra.NewAdminClient(cfg.HydraAdmin)
+	var hydraOpts []hydra.Option
+	caFile := mustEnvDefault("HYDRA_ADMIN_CA_FILE", "")
+	clientCert := mustEnvDefault("HYDRA_ADMIN_CERT_FILE", "")
+	clientKey := mustEnvDefault("HYDRA_ADMIN_KEY_FILE", "")
+	if caFile != "" || clientCert != "" || clientKey != "" {
+		tlsCfg, err := tlsutil.ClientConfig(ctx, caFile, clientCert, clientKey)
+		if err != nil {
+			log.Fatalf("hydra admin tls: %v", err)
+		}
+		hydraOpts = append(hydraOpts, hydra.WithTLSConfig(tlsCfg))
+	}
+	hc := hydra.NewAdminClient(cfg.HydraAdmin, hydraOpts...)
 
 	reg := plugins.NewRegistry()
 	reg.Register(plugins.NewInternalLoginPlugin(cfg.LoginAPIURL))
+	if path := mustEnvDefault("AUTH_PLUGINS_FILE", ""); path != "" {
+		ps, err := plugins.LoadHTTPAuthPlugins(ctx, path)
+		if err != nil {
+			log.Fatalf("auth plugins: %v", err)
+		}
+		for _, p := range ps {
+			reg.Register(p)
+		}
+	}
+	mailer := newMailer()
+	if secret := mustEnvDefault("MAGIC_LINK_SECRET", ""); secret != "" {
+		if mailer == nil {
+			log.Fatalf("MAGIC_LINK_SECRET is set but no mail sender is configured (MAIL_SMTP_ADDR or MAIL_FILE_DIR)")
+		}
+		reg.Register(plugins.NewMagicLinkPlugin(plugins.MagicLinkConfig{
+			LoginAPI: cfg.LoginAPIURL,
+			Secret:   []byte(secret),
+			Mailer:   mailer,
+			TTL:      envSeconds("MAGIC_LINK_TTL_SECONDS", 900),
+			Resend:   envSeconds("MAGIC_LINK_RESEND_SECONDS", 60),
+		}))
+	}
+
+	registerSocial(reg, cfg)
+
+	var uiOpts []ui.Option
+	if svc := newOTP(cfg, mailer); svc != nil {
+		uiOpts = append(uiOpts, ui.WithOTP(svc))
+	}
+	if path := mustEnvDefault("IDENTITY_STORE_FILE", ""); path != "" {
+		ids, err := identity.NewFileStore(path)
+		if err != nil {
+			log.Fatalf("identity store: %v", err)
+		}
+		uiOpts = append(uiOpts, ui.WithIdentities(ids))
+	}
+	if mustEnvBool("PASSWORD_RESET_ENABLED", false) {
+		if mailer == nil {
+			log.Fatalf("PASSWORD_RESET_ENABLED needs a mail sender (MAIL_SMTP_ADDR or MAIL_FILE_DIR)")
+		}
+		uiOpts = append(uiOpts, ui.WithPasswordReset(reset.New(reset.Config{
+			TTL:    envSeconds("PASSWORD_RESET_TTL_SECONDS", 1800),
+			Resend: envSeconds("PASSWORD_RESET_RESEND_SECONDS", 60),
+		}), mailer))
+	}
+	if mustEnvBool("REGISTRATION_ENABLED", false) {
+		if mailer == nil {
+			log.Fatalf("REGISTRATION_ENABLED needs a mail sender (MAIL_SMTP_ADDR or MAIL_FILE_DIR)")
+		}
+		schema, err := registration.Load(mustEnvDefault("REGISTRATION_SCHEMA_FILE", ""))
+		if err != nil {
+			log.Fatalf("registration: %v", err)
+		}
+		codes := otp.New(otp.Config{
+			Secret:      []byte("register|" + cfg.CookieAuth),
+			TTL:         envSeconds("REGISTRATION_CODE_TTL_SECONDS", 600),
+			MaxAttempts: mustEnvInt("OTP_MAX_ATTEMPTS", 5),
+			Resend:      envSeconds("REGISTRATION_RESEND_SECONDS", 60),
+		}, map[otp.Channel]otp.Transport{otp.Email: &otp.MailTransport{
+			Sender:  mailer,
+			Subject: "Confirm your Tripzy email",
+			Note:    "If you didn't try to create an account, you can ignore this email.",
+		}})
+		uiOpts = append(uiOpts, ui.WithRegistration(schema, codes))
+	}
+	if path := mustEnvDefault("AUDIT_LOG_FILE", ""); path != "" {
+		al, err := audit.NewFileLogger(path)
+		if err != nil {
+			log.Fatalf("audit log: %v", err)
+		}
+		uiOpts = append(uiOpts, ui.WithAudit(al))
+	}
+	docs, err := terms.Load(mustEnvDefault("TERMS_FILE", ""))
+	if err != nil {
+		log.Fatalf("terms: %v", err)
+	}
+	if docs != nil {
+		var st terms.Store = terms.NewMemoryStore()
+		if path := mustEnvDefault("TERMS_STORE_FILE", ""); path != "" {
+			if st, err = terms.NewFileStore(path); err != nil {
+				log.Fatalf("terms store: %v", err)
+			}
+		}
+		uiOpts = append(uiOpts, ui.WithTerms(docs, st))
+	}
+
+	app, err := ui.NewServer(cfg, hc, reg, uiOpts...)
+	if err != nil {
+		log.Fatalf("ui: %v", err)
+	}
+
+	srv := &http.Server{
+		Addr:              cfg.Addr,
+		Handler:           app.Routes(),
+		ReadHeaderTimeout: envSeconds("HTTP_READ_HEADER_TIMEOUT_SECONDS", 5),
+		ReadTimeout:       envSeconds("HTTP_READ_TIMEOUT_SECONDS", 15),
+		WriteTimeout:      envSeconds("HTTP_WRITE_TIMEOUT_SECONDS", 30),
+		IdleTimeout:       envSeconds("HTTP_IDLE_TIMEOUT_SECONDS", 120),
+		MaxHeaderBytes:    64 << 10,
+	}
+
+	certFile := mustEnvDefault("TLS_CERT_FILE", "")
+	keyFile := mustEnvDefault("TLS_KEY_FILE", "")
+	if (certFile == "") != (keyFile == "") {
+		// never fall back to plaintext because half the pair is missing
+		log.Fatalf("tls: TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	useTLS := certFile != ""
+	if useTLS {
+		rl, err := tlsutil.NewCertReloader(certFile, keyFile)
+		if err != nil {
+			log.Fatalf("tls: %v", err)
+		}
+		go rl.Watch(ctx, envSeconds("TLS_RELOAD_INTERVAL_SECONDS", 30))
+		srv.TLSConfig = tlsutil.ServerConfig(rl)
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		log.Printf("bridge listening on %s (tls=%v)", cfg.Addr, useTLS)
+		var err error
+		if useTLS {
+			// certs come from TLSConfig.GetCertificate
+			err = srv.ListenAndServeTLS("", "")
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			errCh <- err
+		}
+		close(errCh)
+	}()
+
+	select {
+	case err := <-errCh:
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	case <-ctx.Done():
+	}
+	stop()
 
-	app := ui.NewServer(cfg, hc, reg)
+	// Go unready first and give the load balancer a moment to notice,
+	// then stop accepting and drain in-flight requests.
+	log.Printf("shutdown: draining")
+	app.BeginShutdown()
+	time.Sleep(envSeconds("SHUTDOWN_DRAIN_SECONDS", 5))
 
-	log.Printf("bridge listening on %s", cfg.Addr)
-	if err := http.ListenAndServe(cfg.Addr, app.Routes()); err != nil {
-		log.Fatal(err)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), envSeconds("SHUTDOWN_TIMEOUT_SECONDS", 20))
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("shutdown: %v", err)
 	}
+	log.Printf("shutdown: done")
 }
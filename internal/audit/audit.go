@@ -0,0 +1,66 @@
+// Package audit records events that legal or security may have to produce
+// later, such as a user accepting the terms of service. Records are JSON
+// lines, kept apart from the operational log.
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Event is one audit record.
+type Event struct {
+	Time     time.Time         `json:"time"`
+	Type     string            `json:"type"` // e.g. "terms.accepted"
+	Subject  string            `json:"sub,omitempty"`
+	ClientID string            `json:"client_id,omitempty"`
+	Details  map[string]string `json:"details,omitempty"`
+}
+
+// Logger stores events. A failed Record must fail the action it records.
+type Logger interface {
+	Record(ctx context.Context, e Event) error
+}
+
+// StdLogger writes events to the process log with an "audit:" prefix.
+type StdLogger struct{}
+
+func (StdLogger) Record(_ context.Context, e Event) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	log.Printf("audit: %s", b)
+	return nil
+}
+
+// FileLogger appends events to a file, one JSON object per line.
+type FileLogger struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+func NewFileLogger(path string) (*FileLogger, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &FileLogger{f: f}, nil
+}
+
+func (l *FileLogger) Record(_ context.Context, e Event) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.f.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	return l.f.Sync()
+}
@@ -0,0 +1,245 @@
+// Package hooks calls out to HTTP endpoints at fixed points of the login and
+// consent flow, so other services can enrich token claims or veto a login
+// without a Go plugin.
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// Event names a point in the flow where hooks run.
+type Event string
+
+const (
+	AfterAuthenticate   Event = "after_authenticate"    // fresh credentials checked, before policy
+	BeforeAcceptLogin   Event = "before_accept_login"   // fresh login or SSO reuse
+	BeforeAcceptConsent Event = "before_accept_consent" // scopes granted, tokens about to be minted
+)
+
+const (
+	SignatureHeader = "X-Bridge-Signature"
+	EventHeader     = "X-Bridge-Event"
+
+	defaultTimeout = 2 * time.Second
+)
+
+// Hook is one endpoint from the hooks file.
+type Hook struct {
+	Name      string   `json:"name"`
+	URL       string   `json:"url"`
+	Events    []Event  `json:"events"`
+	Clients   []string `json:"clients,omitempty"`    // empty = every client
+	SecretEnv string   `json:"secret_env"`           // env var holding the HMAC key
+	TimeoutMS int      `json:"timeout_ms,omitempty"` // default 2000
+	FailOpen  bool     `json:"fail_open,omitempty"`  // on error/timeout carry on without this hook
+
+	secret []byte
+}
+
+func (h Hook) timeout() time.Duration {
+	if h.TimeoutMS <= 0 {
+		return defaultTimeout
+	}
+	return time.Duration(h.TimeoutMS) * time.Millisecond
+}
+
+func (h Hook) matches(ev Event, clientID string) bool {
+	return slices.Contains(h.Events, ev) && (len(h.Clients) == 0 || slices.Contains(h.Clients, clientID))
+}
+
+// Request is the JSON body POSTed to a hook.
+type Request struct {
+	Event    Event          `json:"event"`
+	Subject  string         `json:"subject"`
+	ClientID string         `json:"client_id"`
+	Scopes   []string       `json:"scopes,omitempty"`
+	Provider string         `json:"provider,omitempty"`
+	AMR      []string       `json:"amr,omitempty"`
+	Claims   map[string]any `json:"claims,omitempty"`
+}
+
+// Response is what a hook may answer. An empty body (or 204) changes nothing.
+// Patches are shallow merges; a null value removes the claim.
+type Response struct {
+	Deny             bool   `json:"deny,omitempty"`
+	Error            string `json:"error,omitempty"` // OAuth2 error code, default access_denied
+	ErrorDescription string `json:"error_description,omitempty"`
+
+	Claims      map[string]any `json:"claims,omitempty"`       // user claims, seen by later steps
+	IDToken     map[string]any `json:"id_token,omitempty"`     // before_accept_consent only
+	AccessToken map[string]any `json:"access_token,omitempty"` // before_accept_consent only
+}
+
+// Result is the combined outcome of every hook run for one event.
+type Result struct {
+	Denied      bool
+	Error       string
+	Description string
+
+	Claims      map[string]any // input claims with all patches applied
+	IDToken     map[string]any // accumulated patches
+	AccessToken map[string]any
+}
+
+// Error is returned when a fail-closed hook could not be called.
+type Error struct {
+	Hook string
+	Err  error
+}
+
+func (e *Error) Error() string { return fmt.Sprintf("hook %s: %v", e.Hook, e.Err) }
+func (e *Error) Unwrap() error { return e.Err }
+
+// Runner holds the configured hooks.
+type Runner struct {
+	hooks []Hook
+	hc    *http.Client
+}
+
+type file struct {
+	Hooks []Hook `json:"hooks"`
+}
+
+// Load reads a JSON hooks file. An empty path yields a runner with no hooks.
+func Load(path string) (*Runner, error) {
+	r := &Runner{hc: &http.Client{}}
+	if path == "" {
+		return r, nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f file
+	if err := json.Unmarshal(b, &f); err != nil {
+		return nil, fmt.Errorf("hooks file %s: %w", path, err)
+	}
+	for _, h := range f.Hooks {
+		if h.Name == "" || h.URL == "" {
+			return nil, fmt.Errorf("hooks file %s: every hook needs a name and url", path)
+		}
+		h.secret = []byte(os.Getenv(h.SecretEnv))
+		if h.SecretEnv == "" || len(h.secret) == 0 {
+			return nil, fmt.Errorf("hooks file %s: hook %q: secret_env must name a non-empty env var", path, h.Name)
+		}
+		r.hooks = append(r.hooks, h)
+	}
+	return r, nil
+}
+
+// Run calls every hook registered for req.Event and req.ClientID, in file
+// order. Each hook sees the claims as patched by the ones before it; the
+// first deny stops the chain.
+func (r *Runner) Run(ctx context.Context, req Request) (Result, error) {
+	res := Result{Claims: req.Claims}
+	for _, h := range r.hooks {
+		if !h.matches(req.Event, req.ClientID) {
+			continue
+		}
+		req.Claims = res.Claims
+		out, err := r.call(ctx, h, req)
+		if err != nil {
+			if h.FailOpen {
+				log.Printf("hooks: %s %s failed, continuing (fail_open): %v", h.Name, req.Event, err)
+				continue
+			}
+			return Result{}, &Error{Hook: h.Name, Err: err}
+		}
+		if out.Deny {
+			res.Denied = true
+			res.Error = out.Error
+			if res.Error == "" {
+				res.Error = "access_denied"
+			}
+			res.Description = out.ErrorDescription
+			return res, nil
+		}
+		res.Claims = Merge(res.Claims, out.Claims)
+		res.IDToken = Merge(res.IDToken, out.IDToken)
+		res.AccessToken = Merge(res.AccessToken, out.AccessToken)
+	}
+	return res, nil
+}
+
+func (r *Runner) call(ctx context.Context, h Hook, req Request) (*Response, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, h.timeout())
+	defer cancel()
+
+	hr, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	hr.Header.Set("Content-Type", "application/json")
+	hr.Header.Set(EventHeader, string(req.Event))
+	hr.Header.Set(SignatureHeader, Sign(h.secret, time.Now(), body))
+
+	res, err := r.hc.Do(hr)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	raw, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return nil, fmt.Errorf("status %d: %s", res.StatusCode, raw)
+	}
+	var out Response
+	if len(bytes.TrimSpace(raw)) > 0 {
+		if err := json.Unmarshal(raw, &out); err != nil {
+			return nil, fmt.Errorf("bad response: %w", err)
+		}
+	}
+	return &out, nil
+}
+
+// Sign builds the X-Bridge-Signature value: "t=<unix>,v1=<hex>", where v1 is
+// HMAC-SHA256 over "<unix>.<body>". Receivers should recompute it and reject
+// stale timestamps.
+func Sign(secret []byte, at time.Time, body []byte) string {
+	ts := strconv.FormatInt(at.Unix(), 10)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "t=" + ts + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Merge returns a copy of dst with patch applied: keys are overwritten and
+// null values delete the key.
+func Merge(dst, patch map[string]any) map[string]any {
+	if patch == nil {
+		return dst
+	}
+	out := maps.Clone(dst)
+	if out == nil {
+		out = map[string]any{}
+	}
+	for k, v := range patch {
+		if v == nil {
+			delete(out, k)
+			continue
+		}
+		out[k] = v
+	}
+	return out
+}
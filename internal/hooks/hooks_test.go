@@ -0,0 +1,194 @@
+package hooks
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		name       string
+		dst, patch map[string]any
+		want       map[string]any
+	}{
+		{name: "nil patch", dst: map[string]any{"a": 1}, want: map[string]any{"a": 1}},
+		{name: "nil dst", patch: map[string]any{"a": 1}, want: map[string]any{"a": 1}},
+		{name: "both nil"},
+		{name: "overwrite and add", dst: map[string]any{"a": 1, "b": 2}, patch: map[string]any{"b": 3, "c": 4},
+			want: map[string]any{"a": 1, "b": 3, "c": 4}},
+		{name: "null deletes", dst: map[string]any{"a": 1, "b": 2}, patch: map[string]any{"a": nil},
+			want: map[string]any{"b": 2}},
+		{name: "null on missing key", patch: map[string]any{"a": nil}, want: map[string]any{}},
+		{name: "shallow", dst: map[string]any{"addr": map[string]any{"city": "x", "zip": "1"}},
+			patch: map[string]any{"addr": map[string]any{"city": "y"}},
+			want:  map[string]any{"addr": map[string]any{"city": "y"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var before map[string]any
+			if tt.dst != nil {
+				before = map[string]any{}
+				for k, v := range tt.dst {
+					before[k] = v
+				}
+			}
+			got := Merge(tt.dst, tt.patch)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Merge = %v, want %v", got, tt.want)
+			}
+			if tt.patch != nil && !reflect.DeepEqual(tt.dst, before) {
+				t.Errorf("Merge modified dst: %v, was %v", tt.dst, before)
+			}
+		})
+	}
+}
+
+func TestSign(t *testing.T) {
+	tests := []struct {
+		name   string
+		secret string
+		at     int64
+		body   string
+		want   string
+	}{
+		{
+			name:   "known vector",
+			secret: "whsec",
+			at:     1700000000,
+			body:   `{"event":"x"}`,
+			want:   "t=1700000000,v1=84da94eb7ba592f37db15d3d593d9ca72576fb27dbd519ff98dd8685441561de",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Sign([]byte(tt.secret), time.Unix(tt.at, 0), []byte(tt.body)); got != tt.want {
+				t.Errorf("Sign = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// verify checks a signature the way a receiver would.
+func verify(secret []byte, header string, body []byte) bool {
+	ts, v1, ok := strings.Cut(strings.TrimPrefix(header, "t="), ",v1=")
+	if !ok {
+		return false
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(ts + "."))
+	mac.Write(body)
+	got, err := hex.DecodeString(v1)
+	return err == nil && hmac.Equal(got, mac.Sum(nil))
+}
+
+func TestRun(t *testing.T) {
+	secret := []byte("whsec")
+	var seen []Request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if !verify(secret, r.Header.Get(SignatureHeader), body) {
+			http.Error(w, "bad signature", http.StatusUnauthorized)
+			return
+		}
+		var req Request
+		_ = json.Unmarshal(body, &req)
+		seen = append(seen, req)
+		switch r.URL.Path {
+		case "/enrich":
+			_ = json.NewEncoder(w).Encode(Response{Claims: map[string]any{"tier": "gold", "tmp": nil}})
+		case "/tokens":
+			_ = json.NewEncoder(w).Encode(Response{IDToken: map[string]any{"tier": req.Claims["tier"]}})
+		case "/deny":
+			_ = json.NewEncoder(w).Encode(Response{Deny: true, ErrorDescription: "no"})
+		case "/empty":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	hook := func(name, path string, failOpen bool, clients ...string) Hook {
+		return Hook{Name: name, URL: srv.URL + path, Events: []Event{BeforeAcceptLogin},
+			Clients: clients, FailOpen: failOpen, secret: secret}
+	}
+	claims := map[string]any{"email": "a@example.com", "tmp": true}
+
+	tests := []struct {
+		name    string
+		hooks   []Hook
+		event   Event
+		want    Result
+		wantErr bool
+		calls   int
+	}{
+		{
+			name:  "no matching event",
+			hooks: []Hook{hook("enrich", "/enrich", false)},
+			event: AfterAuthenticate,
+			want:  Result{Claims: claims},
+		},
+		{
+			name:  "other client",
+			hooks: []Hook{hook("enrich", "/enrich", false, "other-app")},
+			event: BeforeAcceptLogin,
+			want:  Result{Claims: claims},
+		},
+		{
+			name:  "chained patches",
+			hooks: []Hook{hook("enrich", "/enrich", false), hook("empty", "/empty", false), hook("tokens", "/tokens", false)},
+			event: BeforeAcceptLogin,
+			want: Result{
+				Claims:  map[string]any{"email": "a@example.com", "tier": "gold"},
+				IDToken: map[string]any{"tier": "gold"},
+			},
+			calls: 3,
+		},
+		{
+			name:  "deny stops the chain",
+			hooks: []Hook{hook("deny", "/deny", false), hook("enrich", "/enrich", false)},
+			event: BeforeAcceptLogin,
+			want:  Result{Denied: true, Error: "access_denied", Description: "no", Claims: claims},
+			calls: 1,
+		},
+		{
+			name:  "fail open",
+			hooks: []Hook{hook("broken", "/broken", true), hook("enrich", "/enrich", false)},
+			event: BeforeAcceptLogin,
+			want:  Result{Claims: map[string]any{"email": "a@example.com", "tier": "gold"}},
+			calls: 2,
+		},
+		{
+			name:    "fail closed",
+			hooks:   []Hook{hook("broken", "/broken", false)},
+			event:   BeforeAcceptLogin,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seen = nil
+			r := &Runner{hooks: tt.hooks, hc: srv.Client()}
+			got, err := r.Run(context.Background(), Request{Event: tt.event, Subject: "u1", ClientID: "app", Claims: claims})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Run error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Run = %+v, want %+v", got, tt.want)
+			}
+			if !tt.wantErr && len(seen) != tt.calls {
+				t.Errorf("hooks answered %d signed calls, want %d", len(seen), tt.calls)
+			}
+		})
+	}
+}
@@ -1,7 +1,8 @@
 package hydra
 
 import (
-	"bytes"
+	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -15,34 +16,79 @@ type AdminClient struct {
 	hc   *http.Client
 }
 
-func NewAdminClient(base string) *AdminClient {
-	return &AdminClient{
+// Option tweaks the admin client at construction time.
+type Option func(*AdminClient)
+
+// WithTLSConfig is used for mTLS to Hydra admin (or a private CA).
+func WithTLSConfig(cfg *tls.Config) Option {
+	return func(c *AdminClient) {
+		tr := http.DefaultTransport.(*http.Transport).Clone()
+		tr.TLSClientConfig = cfg
+		c.hc.Transport = tr
+	}
+}
+
+func NewAdminClient(base string, opts ...Option) *AdminClient {
+	c := &AdminClient{
 		base: base,
 		hc: &http.Client{
 			Timeout: 10 * time.Second,
 		},
 	}
+	for _, o := range opts {
+		o(c)
+	}
+	return c
 }
 
 type LoginRequest struct {
-	Challenge  string `json:"challenge"`
-	Client     Client `json:"client"`
-	Skip       bool   `json:"skip"`
-	Subject    string `json:"subject"`
-	RequestURL string `json:"request_url"`
+	Challenge   string      `json:"challenge"`
+	Client      Client      `json:"client"`
+	Skip        bool        `json:"skip"`
+	Subject     string      `json:"subject"`
+	RequestURL  string      `json:"request_url"`
+	OIDCContext OIDCContext `json:"oidc_context"`
+}
+
+// OIDCContext carries the OIDC-specific parameters of the auth request.
+type OIDCContext struct {
+	ACRValues []string `json:"acr_values,omitempty"`
+	LoginHint string   `json:"login_hint,omitempty"`
+	UILocales []string `json:"ui_locales,omitempty"`
+	Display   string   `json:"display,omitempty"`
 }
 
 type ConsentRequest struct {
-	Challenge      string   `json:"challenge"`
-	Client         Client   `json:"client"`
-	RequestedScope []string `json:"requested_scope"`
-	Skip           bool     `json:"skip"`
-	Subject        string   `json:"subject"`
+	Challenge      string         `json:"challenge"`
+	Client         Client         `json:"client"`
+	RequestedScope []string       `json:"requested_scope"`
+	Skip           bool           `json:"skip"`
+	Subject        string         `json:"subject"`
+	Context        map[string]any `json:"context,omitempty"` // what we passed when accepting login
+}
+
+type LogoutRequest struct {
+	Challenge   string  `json:"challenge"`
+	Subject     string  `json:"subject"`
+	SessionID   string  `json:"sid"` // Hydra's login session id, the "sid" RPs got in their ID tokens
+	RequestURL  string  `json:"request_url"`
+	RPInitiated bool    `json:"rp_initiated"`
+	Client      *Client `json:"client,omitempty"`
+
+	// IdentityProviderSessionID is the id we passed when accepting the
+	// login (our bridge session id). Empty when Hydra doesn't return it.
+	IdentityProviderSessionID string `json:"identity_provider_session_id,omitempty"`
 }
 
 type Client struct {
 	ClientID   string `json:"client_id"`
 	ClientName string `json:"client_name"`
+	ClientURI  string `json:"client_uri,omitempty"`
+
+	FrontchannelLogoutURI             string `json:"frontchannel_logout_uri,omitempty"`
+	FrontchannelLogoutSessionRequired bool   `json:"frontchannel_logout_session_required,omitempty"`
+
+	Metadata map[string]any `json:"metadata,omitempty"`
 }
 
 type AcceptLoginRequestBody struct {
@@ -50,6 +96,12 @@ type AcceptLoginRequestBody struct {
 	Remember    bool                   `json:"remember"`
 	RememberFor int                    `json:"remember_for"`
 	Context     map[string]interface{} `json:"context,omitempty"`
+	ACR         string                 `json:"acr,omitempty"`
+	AMR         []string               `json:"amr,omitempty"`
+
+	// IdentityProviderSessionID is our bridge session id, so a logout
+	// request can be traced back to the account it ends.
+	IdentityProviderSessionID string `json:"identity_provider_session_id,omitempty"`
 }
 
 type AcceptConsentRequestBody struct {
@@ -59,6 +111,14 @@ type AcceptConsentRequestBody struct {
 	Session     ConsentSession `json:"session,omitempty"`
 }
 
+// RejectRequestBody is the OAuth2 error Hydra forwards to the client.
+type RejectRequestBody struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+	ErrorHint        string `json:"error_hint,omitempty"`
+	StatusCode       int    `json:"status_code,omitempty"`
+}
+
 type ConsentSession struct {
 	IDToken     map[string]interface{} `json:"id_token,omitempty"`
 	AccessToken map[string]interface{} `json:"access_token,omitempty"`
@@ -68,6 +128,28 @@ type RedirectResponse struct {
 	RedirectTo string `json:"redirect_to"`
 }
 
+// APIError is returned for any non-2xx answer from Hydra admin.
+// Hydra uses the OAuth2 error shape; on 410 it also sends redirect_to.
+type APIError struct {
+	StatusCode  int    `json:"-"`
+	Name        string `json:"error"`
+	Description string `json:"error_description"`
+	Hint        string `json:"error_hint"`
+	RedirectTo  string `json:"redirect_to"`
+	Body        string `json:"-"`
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("hydra admin %d: %s", e.StatusCode, e.Body)
+}
+
+func newAPIError(res *http.Response) error {
+	b, _ := io.ReadAll(res.Body)
+	e := &APIError{StatusCode: res.StatusCode, Body: string(b)}
+	_ = json.Unmarshal(b, e)
+	return e
+}
+
 func (c *AdminClient) GetLoginRequest(loginChallenge string) (*LoginRequest, error) {
 	u := fmt.Sprintf("%s/oauth2/auth/requests/login?login_challenge=%s", c.base, url.QueryEscape(loginChallenge))
 	var out LoginRequest
@@ -86,6 +168,15 @@ func (c *AdminClient) AcceptLoginRequest(loginChallenge string, body AcceptLogin
 	return &out, nil
 }
 
+func (c *AdminClient) RejectLoginRequest(loginChallenge string, body RejectRequestBody) (*RedirectResponse, error) {
+	u := fmt.Sprintf("%s/oauth2/auth/requests/login/reject?login_challenge=%s", c.base, url.QueryEscape(loginChallenge))
+	var out RedirectResponse
+	if err := c.putJSON(u, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
 func (c *AdminClient) GetConsentRequest(consentChallenge string) (*ConsentRequest, error) {
 	u := fmt.Sprintf("%s/oauth2/auth/requests/consent?consent_challenge=%s", c.base, url.QueryEscape(consentChallenge))
 	var out ConsentRequest
@@ -104,28 +195,73 @@ func (c *AdminClient) AcceptConsentRequest(consentChallenge string, body AcceptC
 	return &out, nil
 }
 
-func (c *AdminClient) getJSON(u string, out any) error {
-	req, _ := http.NewRequest(http.MethodGet, u, nil)
-	req.Header.Set("Accept", "application/json")
+func (c *AdminClient) RejectConsentRequest(consentChallenge string, body RejectRequestBody) (*RedirectResponse, error) {
+	u := fmt.Sprintf("%s/oauth2/auth/requests/consent/reject?consent_challenge=%s", c.base, url.QueryEscape(consentChallenge))
+	var out RedirectResponse
+	if err := c.putJSON(u, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *AdminClient) GetLogoutRequest(logoutChallenge string) (*LogoutRequest, error) {
+	u := fmt.Sprintf("%s/oauth2/auth/requests/logout?logout_challenge=%s", c.base, url.QueryEscape(logoutChallenge))
+	var out LogoutRequest
+	if err := c.getJSON(u, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *AdminClient) AcceptLogoutRequest(logoutChallenge string) (*RedirectResponse, error) {
+	u := fmt.Sprintf("%s/oauth2/auth/requests/logout/accept?logout_challenge=%s", c.base, url.QueryEscape(logoutChallenge))
+	var out RedirectResponse
+	if err := c.putJSON(u, struct{}{}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RejectLogoutRequest keeps the user signed in; Hydra answers 204.
+func (c *AdminClient) RejectLogoutRequest(logoutChallenge string) error {
+	u := fmt.Sprintf("%s/oauth2/auth/requests/logout/reject?logout_challenge=%s", c.base, url.QueryEscape(logoutChallenge))
+	return c.putJSON(u, struct{}{}, nil)
+}
+
+// AcceptUserCodeRequestBody carries the code the user typed on the
+// device verification page.
+type AcceptUserCodeRequestBody struct {
+	UserCode string `json:"user_code"`
+}
+
+// AcceptUserCodeRequest binds a device challenge (RFC 8628) to the user code.
+// Hydra answers with where to send the browser next, usually its own
+// authorization endpoint, which in turn starts the regular login/consent.
+func (c *AdminClient) AcceptUserCodeRequest(deviceChallenge string, body AcceptUserCodeRequestBody) (*RedirectResponse, error) {
+	u := fmt.Sprintf("%s/oauth2/auth/requests/device/accept?device_challenge=%s", c.base, url.QueryEscape(deviceChallenge))
+	var out RedirectResponse
+	if err := c.putJSON(u, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CheckHealth asks Hydra whether it is ready (database reachable etc.).
+func (c *AdminClient) CheckHealth(ctx context.Context) error {
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, c.base+"/health/ready", nil)
 	res, err := c.hc.Do(req)
 	if err != nil {
 		return err
 	}
 	defer res.Body.Close()
 	if res.StatusCode >= 300 {
-		b, _ := io.ReadAll(res.Body)
-		return fmt.Errorf("hydra admin %s: %s", res.Status, string(b))
+		return newAPIError(res)
 	}
-	return json.NewDecoder(res.Body).Decode(out)
+	return nil
 }
 
-func (c *AdminClient) putJSON(u string, in any, out any) error {
-	buf := new(bytes.Buffer)
-	if err := json.NewEncoder(buf).Encode(in); err != nil {
-		return err
-	}
-	req, _ := http.NewRequest(http.MethodPut, u, buf)
-	req.Header.Set("Content-Type", "application/json")
+func (c *AdminClient) getJSON(u string, out any) error {
+	req, _ := http.NewRequest(http.MethodGet, u, nil)
 	req.Header.Set("Accept", "application/json")
 	res, err := c.hc.Do(req)
 	if err != nil {
@@ -133,8 +269,14 @@ func (c *AdminClient) putJSON(u string, in any, out any) error {
 	}
 	defer res.Body.Close()
 	if res.StatusCode >= 300 {
-		b, _ := io.ReadAll(res.Body)
-		return fmt.Errorf("hydra admin %s: %s", res.Status, string(b))
+		return newAPIError(res)
+	}
+	if out == nil || res.StatusCode == http.StatusNoContent {
+		return nil
 	}
 	return json.NewDecoder(res.Body).Decode(out)
 }
+
+func (c *AdminClient) putJSON(u string, in any, out any) error {
+	return c.doJSON(http.MethodPut, u, in, out)
+}
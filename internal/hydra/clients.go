@@ -0,0 +1,212 @@
+package hydra
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// OAuth2Client is the part of Hydra's client model we manage by name.
+// Field names follow Hydra's JSON so the YAML files read the same. Every
+// other field Hydra returns (jwks, logo_uri, token lifespans, ...) is kept
+// in Extra, so a read-modify-write or an export/import doesn't drop it.
+type OAuth2Client struct {
+	ClientID                          string         `json:"client_id" yaml:"client_id"`
+	ClientName                        string         `json:"client_name,omitempty" yaml:"client_name,omitempty"`
+	ClientSecret                      string         `json:"client_secret,omitempty" yaml:"client_secret,omitempty"`
+	ClientURI                         string         `json:"client_uri,omitempty" yaml:"client_uri,omitempty"`
+	GrantTypes                        []string       `json:"grant_types,omitempty" yaml:"grant_types,omitempty"`
+	ResponseTypes                     []string       `json:"response_types,omitempty" yaml:"response_types,omitempty"`
+	Scope                             string         `json:"scope,omitempty" yaml:"scope,omitempty"`
+	Audience                          []string       `json:"audience,omitempty" yaml:"audience,omitempty"`
+	RedirectURIs                      []string       `json:"redirect_uris,omitempty" yaml:"redirect_uris,omitempty"`
+	PostLogoutRedirectURIs            []string       `json:"post_logout_redirect_uris,omitempty" yaml:"post_logout_redirect_uris,omitempty"`
+	TokenEndpointAuthMethod           string         `json:"token_endpoint_auth_method,omitempty" yaml:"token_endpoint_auth_method,omitempty"`
+	FrontchannelLogoutURI             string         `json:"frontchannel_logout_uri,omitempty" yaml:"frontchannel_logout_uri,omitempty"`
+	FrontchannelLogoutSessionRequired bool           `json:"frontchannel_logout_session_required,omitempty" yaml:"frontchannel_logout_session_required,omitempty"`
+	BackchannelLogoutURI              string         `json:"backchannel_logout_uri,omitempty" yaml:"backchannel_logout_uri,omitempty"`
+	BackchannelLogoutSessionRequired  bool           `json:"backchannel_logout_session_required,omitempty" yaml:"backchannel_logout_session_required,omitempty"`
+	SkipConsent                       bool           `json:"skip_consent,omitempty" yaml:"skip_consent,omitempty"`
+	Metadata                          map[string]any `json:"metadata,omitempty" yaml:"metadata,omitempty"`
+
+	CreatedAt time.Time `json:"created_at,omitzero" yaml:"-"`
+	UpdatedAt time.Time `json:"updated_at,omitzero" yaml:"-"`
+
+	Extra map[string]any `json:"-" yaml:"-"`
+}
+
+// plainClient has OAuth2Client's fields without its JSON methods.
+type plainClient OAuth2Client
+
+// clientKeys are the JSON names of OAuth2Client's own fields.
+var clientKeys = func() map[string]bool {
+	keys := map[string]bool{}
+	t := reflect.TypeOf(plainClient{})
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			keys[name] = true
+		}
+	}
+	return keys
+}()
+
+func (c *OAuth2Client) UnmarshalJSON(b []byte) error {
+	var all map[string]any
+	if err := json.Unmarshal(b, &all); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(b, (*plainClient)(c)); err != nil {
+		return err
+	}
+	c.Extra = nil
+	for k, v := range all {
+		if !clientKeys[k] {
+			if c.Extra == nil {
+				c.Extra = map[string]any{}
+			}
+			c.Extra[k] = v
+		}
+	}
+	return nil
+}
+
+func (c OAuth2Client) MarshalJSON() ([]byte, error) {
+	b, err := json.Marshal(plainClient(c))
+	if err != nil || len(c.Extra) == 0 {
+		return b, err
+	}
+	var all map[string]any
+	if err := json.Unmarshal(b, &all); err != nil {
+		return nil, err
+	}
+	for k, v := range c.Extra {
+		if !clientKeys[k] {
+			all[k] = v
+		}
+	}
+	return json.Marshal(all)
+}
+
+func (c *AdminClient) clientURL(id string) string {
+	return fmt.Sprintf("%s/clients/%s", c.base, url.PathEscape(id))
+}
+
+func (c *AdminClient) CreateClient(in OAuth2Client) (*OAuth2Client, error) {
+	var out OAuth2Client
+	if err := c.doJSON(http.MethodPost, c.base+"/clients", in, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *AdminClient) GetClient(id string) (*OAuth2Client, error) {
+	var out OAuth2Client
+	if err := c.getJSON(c.clientURL(id), &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+var nextLink = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+
+// ListClients follows Hydra's Link-header pagination to the end.
+func (c *AdminClient) ListClients() ([]OAuth2Client, error) {
+	var all []OAuth2Client
+	u := c.base + "/clients?page_size=500"
+	for u != "" {
+		req, _ := http.NewRequest(http.MethodGet, u, nil)
+		req.Header.Set("Accept", "application/json")
+		res, err := c.hc.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if res.StatusCode >= 300 {
+			err := newAPIError(res)
+			res.Body.Close()
+			return nil, err
+		}
+		var page []OAuth2Client
+		err = json.NewDecoder(res.Body).Decode(&page)
+		res.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, page...)
+
+		u = ""
+		if m := nextLink.FindStringSubmatch(res.Header.Get("Link")); m != nil && len(page) > 0 {
+			next, err := url.Parse(m[1])
+			if err != nil {
+				return nil, err
+			}
+			u = c.base + "/clients?" + next.RawQuery
+		}
+	}
+	return all, nil
+}
+
+// UpdateClient replaces the client: fields missing from in are reset, so
+// callers start from the current client (see GetClient) to keep them. An
+// empty ClientSecret keeps the existing secret.
+func (c *AdminClient) UpdateClient(in OAuth2Client) (*OAuth2Client, error) {
+	var out OAuth2Client
+	if err := c.doJSON(http.MethodPut, c.clientURL(in.ClientID), in, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *AdminClient) DeleteClient(id string) error {
+	return c.doJSON(http.MethodDelete, c.clientURL(id), nil, nil)
+}
+
+type jsonPatchOp struct {
+	Op    string `json:"op"`
+	Path  string `json:"path"`
+	Value any    `json:"value,omitempty"`
+}
+
+// SetClientSecret replaces only the secret (JSON Patch), leaving the rest
+// of the client untouched.
+func (c *AdminClient) SetClientSecret(id, secret string) error {
+	ops := []jsonPatchOp{{Op: "replace", Path: "/client_secret", Value: secret}}
+	return c.doJSON(http.MethodPatch, c.clientURL(id), ops, nil)
+}
+
+// doJSON is the generic request helper for verbs other than GET.
+func (c *AdminClient) doJSON(method, u string, in any, out any) error {
+	var body *bytes.Buffer
+	if in != nil {
+		body = new(bytes.Buffer)
+		if err := json.NewEncoder(body).Encode(in); err != nil {
+			return err
+		}
+	}
+	var req *http.Request
+	if body != nil {
+		req, _ = http.NewRequest(method, u, body)
+		req.Header.Set("Content-Type", "application/json")
+	} else {
+		req, _ = http.NewRequest(method, u, nil)
+	}
+	req.Header.Set("Accept", "application/json")
+	res, err := c.hc.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 300 {
+		return newAPIError(res)
+	}
+	if out == nil || res.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return json.NewDecoder(res.Body).Decode(out)
+}
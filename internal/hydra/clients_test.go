@@ -0,0 +1,69 @@
+package hydra
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestOAuth2ClientJSON(t *testing.T) {
+	tests := []struct {
+		name      string
+		in        string
+		wantExtra map[string]any
+	}{
+		{
+			name: "only known fields",
+			in:   `{"client_id":"a","redirect_uris":["https://a/cb"]}`,
+		},
+		{
+			name: "unknown fields kept",
+			in:   `{"client_id":"a","jwks":{"keys":[]},"logo_uri":"https://a/logo.png","access_token_lifespan":"1h0m0s","skip_logout_consent":true}`,
+			wantExtra: map[string]any{
+				"jwks":                  map[string]any{"keys": []any{}},
+				"logo_uri":              "https://a/logo.png",
+				"access_token_lifespan": "1h0m0s",
+				"skip_logout_consent":   true,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var c OAuth2Client
+			if err := json.Unmarshal([]byte(tt.in), &c); err != nil {
+				t.Fatalf("Unmarshal: %v", err)
+			}
+			if c.ClientID != "a" {
+				t.Errorf("ClientID = %q", c.ClientID)
+			}
+			if !reflect.DeepEqual(c.Extra, tt.wantExtra) {
+				t.Errorf("Extra = %v, want %v", c.Extra, tt.wantExtra)
+			}
+
+			// what goes back to Hydra is what came from it
+			out, err := json.Marshal(c)
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+			var got, want map[string]any
+			_ = json.Unmarshal(out, &got)
+			_ = json.Unmarshal([]byte(tt.in), &want)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("round trip = %s, want %s", out, tt.in)
+			}
+		})
+	}
+}
+
+func TestOAuth2ClientExtraCantShadow(t *testing.T) {
+	c := OAuth2Client{ClientID: "a", Extra: map[string]any{"client_id": "b", "logo_uri": "x"}}
+	out, err := json.Marshal(c)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	var got map[string]any
+	_ = json.Unmarshal(out, &got)
+	if got["client_id"] != "a" || got["logo_uri"] != "x" {
+		t.Errorf("Marshal = %s", out)
+	}
+}
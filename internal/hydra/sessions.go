@@ -0,0 +1,44 @@
+package hydra
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// PreviousConsentSession is one remembered consent grant for a subject.
+type PreviousConsentSession struct {
+	ConsentRequest ConsentRequest `json:"consent_request"`
+	GrantScope     []string       `json:"grant_scope"`
+	HandledAt      time.Time      `json:"handled_at"`
+	Remember       bool           `json:"remember"`
+	RememberFor    int            `json:"remember_for"`
+}
+
+func (c *AdminClient) ListConsentSessions(subject string) ([]PreviousConsentSession, error) {
+	u := fmt.Sprintf("%s/oauth2/auth/sessions/consent?subject=%s", c.base, url.QueryEscape(subject))
+	var out []PreviousConsentSession
+	if err := c.getJSON(u, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// RevokeConsentSessions revokes the subject's consent for one client, or for
+// every client when clientID is empty. Tokens issued under it are revoked too.
+func (c *AdminClient) RevokeConsentSessions(subject, clientID string) error {
+	q := url.Values{"subject": {subject}}
+	if clientID == "" {
+		q.Set("all", "true")
+	} else {
+		q.Set("client", clientID)
+	}
+	return c.doJSON(http.MethodDelete, c.base+"/oauth2/auth/sessions/consent?"+q.Encode(), nil, nil)
+}
+
+// RevokeLoginSessions ends every Hydra login session of the subject.
+func (c *AdminClient) RevokeLoginSessions(subject string) error {
+	u := fmt.Sprintf("%s/oauth2/auth/sessions/login?subject=%s", c.base, url.QueryEscape(subject))
+	return c.doJSON(http.MethodDelete, u, nil, nil)
+}
@@ -0,0 +1,166 @@
+// Package identity maps the subjects plugins return (provider, external id)
+// to one stable subject, so a user who signs in with a password today and
+// with Google tomorrow is the same account in Hydra.
+package identity
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrLinkedElsewhere: the external identity already belongs to another subject.
+	ErrLinkedElsewhere = errors.New("identity: linked to another account")
+	// ErrProviderLinked: the subject already has an identity at this provider.
+	ErrProviderLinked = errors.New("identity: provider already linked")
+	// ErrNotLinked: there is no such link.
+	ErrNotLinked = errors.New("identity: not linked")
+)
+
+// Link ties one provider identity to a subject.
+type Link struct {
+	Subject    string    `json:"sub"`
+	Provider   string    `json:"provider"`
+	ExternalID string    `json:"external_id"` // AuthResult.Subject as the plugin returned it
+	LinkedAt   time.Time `json:"linked_at"`
+}
+
+// Primary reports whether this is the identity the subject was created from.
+// It resolves to the subject even without a link, so it can't be unlinked.
+func (l Link) Primary() bool { return l.ExternalID == l.Subject }
+
+// Store keeps the links. Identities without a link resolve to themselves.
+type Store interface {
+	Resolve(ctx context.Context, provider, externalID string) (sub string, ok bool, err error)
+	Links(ctx context.Context, sub string) ([]Link, error)
+	Link(ctx context.Context, l Link) error
+	Unlink(ctx context.Context, sub, provider string) error
+}
+
+// Subject returns the stable subject for a plugin result.
+func Subject(ctx context.Context, st Store, provider, externalID string) (string, error) {
+	sub, ok, err := st.Resolve(ctx, provider, externalID)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return externalID, nil
+	}
+	return sub, nil
+}
+
+// MemoryStore keeps links in memory; they are lost on restart. With a path
+// set (see NewFileStore) every change is written to a JSON file.
+type MemoryStore struct {
+	mu    sync.Mutex
+	links []Link
+	path  string
+}
+
+func NewMemoryStore() *MemoryStore { return &MemoryStore{} }
+
+// NewFileStore loads links from path (a missing file is an empty store)
+// and persists every change there.
+func NewFileStore(path string) (*MemoryStore, error) {
+	s := &MemoryStore{path: path}
+	b, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return s, nil
+	case err != nil:
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &s.links); err != nil {
+		return nil, fmt.Errorf("identity store %s: %w", path, err)
+	}
+	return s, nil
+}
+
+func (s *MemoryStore) Resolve(_ context.Context, provider, externalID string) (string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, l := range s.links {
+		if l.Provider == provider && l.ExternalID == externalID {
+			return l.Subject, true, nil
+		}
+	}
+	return "", false, nil
+}
+
+func (s *MemoryStore) Links(_ context.Context, sub string) ([]Link, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []Link
+	for _, l := range s.links {
+		if l.Subject == sub {
+			out = append(out, l)
+		}
+	}
+	return out, nil
+}
+
+func (s *MemoryStore) Link(_ context.Context, l Link) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, o := range s.links {
+		if o.Provider != l.Provider {
+			continue
+		}
+		if o.ExternalID == l.ExternalID {
+			if o.Subject == l.Subject {
+				return nil
+			}
+			return ErrLinkedElsewhere
+		}
+		if o.Subject == l.Subject {
+			return ErrProviderLinked
+		}
+	}
+	if l.LinkedAt.IsZero() {
+		l.LinkedAt = time.Now().UTC()
+	}
+	s.links = append(s.links, l)
+	return s.save()
+}
+
+func (s *MemoryStore) Unlink(_ context.Context, sub, provider string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := slices.IndexFunc(s.links, func(l Link) bool { return l.Subject == sub && l.Provider == provider })
+	if i < 0 || s.links[i].Primary() {
+		return ErrNotLinked
+	}
+	s.links = slices.Delete(s.links, i, i+1)
+	return s.save()
+}
+
+// save writes the file atomically. Callers hold mu.
+func (s *MemoryStore) save() error {
+	if s.path == "" {
+		return nil
+	}
+	b, err := json.MarshalIndent(s.links, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".identities-*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	if _, err := tmp.Write(b); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
@@ -0,0 +1,95 @@
+package identity
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+// failingStore fails every lookup.
+type failingStore struct{ *MemoryStore }
+
+var errStore = errors.New("store down")
+
+func (*failingStore) Resolve(context.Context, string, string) (string, bool, error) {
+	return "", false, errStore
+}
+
+func TestSubject(t *testing.T) {
+	ctx := context.Background()
+	st := NewMemoryStore()
+	for _, l := range []Link{
+		{Subject: "u1", Provider: "internal", ExternalID: "u1"},
+		{Subject: "u1", Provider: "google", ExternalID: "google:1234"},
+	} {
+		if err := st.Link(ctx, l); err != nil {
+			t.Fatalf("Link %+v: %v", l, err)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		st         Store
+		provider   string
+		externalID string
+		want       string
+		wantErr    error
+	}{
+		{name: "unlinked resolves to itself", st: st, provider: "github", externalID: "github:9", want: "github:9"},
+		{name: "linked", st: st, provider: "google", externalID: "google:1234", want: "u1"},
+		{name: "primary", st: st, provider: "internal", externalID: "u1", want: "u1"},
+		{name: "same id at another provider", st: st, provider: "github", externalID: "google:1234", want: "google:1234"},
+		{name: "store error", st: &failingStore{NewMemoryStore()}, provider: "google", externalID: "google:1234", wantErr: errStore},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Subject(ctx, tt.st, tt.provider, tt.externalID)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Subject error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Subject = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLink(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "identities.json")
+	st, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	if err := st.Link(ctx, Link{Subject: "u1", Provider: "google", ExternalID: "google:1"}); err != nil {
+		t.Fatalf("Link: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		link Link
+		want error
+	}{
+		{name: "again is a no-op", link: Link{Subject: "u1", Provider: "google", ExternalID: "google:1"}},
+		{name: "taken by another subject", link: Link{Subject: "u2", Provider: "google", ExternalID: "google:1"}, want: ErrLinkedElsewhere},
+		{name: "second identity at provider", link: Link{Subject: "u1", Provider: "google", ExternalID: "google:2"}, want: ErrProviderLinked},
+		{name: "other provider", link: Link{Subject: "u1", Provider: "github", ExternalID: "github:1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := st.Link(ctx, tt.link); !errors.Is(err, tt.want) {
+				t.Errorf("Link = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	// links survive a reload
+	reloaded, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if sub, _ := Subject(ctx, reloaded, "github", "github:1"); sub != "u1" {
+		t.Errorf("after reload Subject = %q, want u1", sub)
+	}
+}
@@ -0,0 +1,123 @@
+// Package mail delivers the bridge's transactional emails (sign-in links,
+// codes). Production uses SMTP; the file and memory senders are for local
+// runs and tests.
+package mail
+
+import (
+	"context"
+	"fmt"
+	"net"
+	netmail "net/mail"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message is a plain-text email.
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+}
+
+// Sender delivers a message or reports why it could not.
+type Sender interface {
+	Send(ctx context.Context, m Message) error
+}
+
+// SMTPSender sends through an SMTP relay. Auth is used when Username is
+// set; net/smtp upgrades to STARTTLS when the server offers it.
+type SMTPSender struct {
+	Addr     string // host:port
+	From     string
+	Username string
+	Password string
+}
+
+func (s *SMTPSender) Send(ctx context.Context, m Message) error {
+	host, _, err := net.SplitHostPort(s.Addr)
+	if err != nil {
+		return fmt.Errorf("smtp addr %q: %w", s.Addr, err)
+	}
+	var auth smtp.Auth
+	if s.Username != "" {
+		auth = smtp.PlainAuth("", s.Username, s.Password, host)
+	}
+	// From may be "Name <addr>"; the envelope wants the bare address.
+	envelope := s.From
+	if a, err := netmail.ParseAddress(s.From); err == nil {
+		envelope = a.Address
+	}
+	done := make(chan error, 1)
+	go func() { done <- smtp.SendMail(s.Addr, auth, envelope, []string{m.To}, format(s.From, m)) }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// FileSender writes each message as an .eml file into Dir, handy with
+// docker-compose where there is no mail server.
+type FileSender struct {
+	Dir  string
+	From string
+}
+
+func (s *FileSender) Send(_ context.Context, m Message) error {
+	if err := os.MkdirAll(s.Dir, 0o700); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), safeName(m.To))
+	return os.WriteFile(filepath.Join(s.Dir, name), format(s.From, m), 0o600)
+}
+
+// MemorySender keeps messages in memory for tests.
+type MemorySender struct {
+	mu   sync.Mutex
+	sent []Message
+}
+
+func (s *MemorySender) Send(_ context.Context, m Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sent = append(s.sent, m)
+	return nil
+}
+
+// Sent returns a copy of everything sent so far.
+func (s *MemorySender) Sent() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message(nil), s.sent...)
+}
+
+func format(from string, m Message) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", headerValue(from))
+	fmt.Fprintf(&b, "To: %s\r\n", headerValue(m.To))
+	fmt.Fprintf(&b, "Subject: %s\r\n", headerValue(m.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(m.Text, "\n", "\r\n"))
+	return []byte(b.String())
+}
+
+// headerValue drops line breaks so user input can't inject headers.
+func headerValue(v string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(v)
+}
+
+func safeName(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '@' || r == '.' || r == '-' || (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, strings.ToLower(s))
+}
@@ -0,0 +1,169 @@
+// Package otp issues short numeric one-time codes for the second factor and
+// delivers them by email or SMS. Only an HMAC of each code is kept.
+package otp
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+)
+
+// Channel is how a code reaches the user.
+type Channel string
+
+const (
+	Email Channel = "email"
+	SMS   Channel = "sms"
+)
+
+var (
+	ErrNoCode          = errors.New("otp: no code was sent or it has expired")
+	ErrInvalid         = errors.New("otp: wrong code")
+	ErrTooManyAttempts = errors.New("otp: too many attempts")
+	ErrThrottled       = errors.New("otp: resend requested too soon")
+	ErrNoTransport     = errors.New("otp: channel not configured")
+)
+
+// Transport delivers a code to an address on one channel.
+type Transport interface {
+	Deliver(ctx context.Context, to, code string, ttl time.Duration) error
+}
+
+type Config struct {
+	Secret      []byte // HMAC key for stored codes
+	Digits      int    // default 6
+	TTL         time.Duration
+	MaxAttempts int           // wrong codes before the code is burned; default 5
+	Resend      time.Duration // minimum gap between codes for one key
+}
+
+type entry struct {
+	hash     []byte
+	exp      time.Time
+	sentAt   time.Time
+	attempts int
+}
+
+// Service issues and checks codes. Codes are keyed by the caller (the
+// bridge uses the login challenge), so one login has at most one live code.
+// The store is per process.
+type Service struct {
+	cfg        Config
+	transports map[Channel]Transport
+
+	mu    sync.Mutex
+	codes map[string]*entry
+}
+
+func New(cfg Config, transports map[Channel]Transport) *Service {
+	if cfg.Digits <= 0 {
+		cfg.Digits = 6
+	}
+	if cfg.TTL <= 0 {
+		cfg.TTL = 5 * time.Minute
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 5
+	}
+	if cfg.Resend <= 0 {
+		cfg.Resend = 30 * time.Second
+	}
+	return &Service{cfg: cfg, transports: transports, codes: map[string]*entry{}}
+}
+
+// Has reports whether codes can be sent on ch.
+func (s *Service) Has(ch Channel) bool {
+	if s == nil {
+		return false
+	}
+	_, ok := s.transports[ch]
+	return ok
+}
+
+// Send generates a fresh code for key and delivers it, replacing any
+// previous one.
+func (s *Service) Send(ctx context.Context, key string, ch Channel, to string) error {
+	t, ok := s.transports[ch]
+	if !ok {
+		return ErrNoTransport
+	}
+	code, err := s.generate()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	s.mu.Lock()
+	s.prune(now)
+	if e, ok := s.codes[key]; ok && now.Sub(e.sentAt) < s.cfg.Resend {
+		s.mu.Unlock()
+		return ErrThrottled
+	}
+	s.codes[key] = &entry{hash: s.hash(key, code), exp: now.Add(s.cfg.TTL), sentAt: now}
+	s.mu.Unlock()
+
+	if err := t.Deliver(ctx, to, code, s.cfg.TTL); err != nil {
+		s.Discard(key)
+		return fmt.Errorf("otp: deliver via %s: %w", ch, err)
+	}
+	return nil
+}
+
+// Verify checks code against key's live code. A correct code is consumed;
+// after MaxAttempts wrong ones the code is burned.
+func (s *Service) Verify(key, code string) error {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.codes[key]
+	if !ok || now.After(e.exp) {
+		delete(s.codes, key)
+		return ErrNoCode
+	}
+	if hmac.Equal(e.hash, s.hash(key, code)) {
+		delete(s.codes, key)
+		return nil
+	}
+	e.attempts++
+	if e.attempts >= s.cfg.MaxAttempts {
+		delete(s.codes, key)
+		return ErrTooManyAttempts
+	}
+	return ErrInvalid
+}
+
+// Discard drops key's code, if any.
+func (s *Service) Discard(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.codes, key)
+}
+
+func (s *Service) generate() (string, error) {
+	max := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(s.cfg.Digits)), nil)
+	n, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", s.cfg.Digits, n), nil
+}
+
+func (s *Service) hash(key, code string) []byte {
+	mac := hmac.New(sha256.New, s.cfg.Secret)
+	mac.Write([]byte(key + "|" + code))
+	return mac.Sum(nil)
+}
+
+func (s *Service) prune(now time.Time) {
+	for k, e := range s.codes {
+		if now.After(e.exp) {
+			delete(s.codes, k)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package otp
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// captureTransport keeps the last code it was asked to deliver.
+type captureTransport struct{ code string }
+
+func (t *captureTransport) Deliver(_ context.Context, _, code string, _ time.Duration) error {
+	t.code = code
+	return nil
+}
+
+func TestVerify(t *testing.T) {
+	const wrong = "not-a-code"
+
+	tests := []struct {
+		name        string
+		maxAttempts int
+		guesses     []string // "" means the code that was sent
+		want        []error
+	}{
+		{name: "correct", guesses: []string{""}, want: []error{nil}},
+		{name: "consumed", guesses: []string{"", ""}, want: []error{nil, ErrNoCode}},
+		{name: "wrong then correct", maxAttempts: 3, guesses: []string{wrong, wrong, ""},
+			want: []error{ErrInvalid, ErrInvalid, nil}},
+		{name: "burned at limit", maxAttempts: 3, guesses: []string{wrong, wrong, wrong, ""},
+			want: []error{ErrInvalid, ErrInvalid, ErrTooManyAttempts, ErrNoCode}},
+		{name: "default limit", guesses: []string{wrong, wrong, wrong, wrong, wrong, ""},
+			want: []error{ErrInvalid, ErrInvalid, ErrInvalid, ErrInvalid, ErrTooManyAttempts, ErrNoCode}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := &captureTransport{}
+			s := New(Config{Secret: []byte("k"), MaxAttempts: tt.maxAttempts}, map[Channel]Transport{Email: tr})
+			if err := s.Send(context.Background(), "ch", Email, "a@example.com"); err != nil {
+				t.Fatalf("Send: %v", err)
+			}
+			for i, g := range tt.guesses {
+				if g == "" {
+					g = tr.code
+				}
+				if err := s.Verify("ch", g); !errors.Is(err, tt.want[i]) {
+					t.Fatalf("guess %d: Verify = %v, want %v", i+1, err, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestVerifyKeys(t *testing.T) {
+	tr := &captureTransport{}
+	s := New(Config{Secret: []byte("k")}, map[Channel]Transport{Email: tr})
+	if err := s.Send(context.Background(), "ch1", Email, "a@example.com"); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if err := s.Verify("ch2", tr.code); !errors.Is(err, ErrNoCode) {
+		t.Errorf("other key: Verify = %v, want ErrNoCode", err)
+	}
+	if err := s.Send(context.Background(), "ch1", Email, "a@example.com"); !errors.Is(err, ErrThrottled) {
+		t.Errorf("resend: Send = %v, want ErrThrottled", err)
+	}
+	if err := s.Send(context.Background(), "ch1", SMS, "+100"); !errors.Is(err, ErrNoTransport) {
+		t.Errorf("sms: Send = %v, want ErrNoTransport", err)
+	}
+	if err := s.Verify("ch1", tr.code); err != nil {
+		t.Errorf("Verify = %v, want nil", err)
+	}
+}
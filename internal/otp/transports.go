@@ -0,0 +1,86 @@
+package otp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/nduyhai/hydra-bridge/internal/mail"
+)
+
+func message(code string, ttl time.Duration) string {
+	return fmt.Sprintf("Your Tripzy verification code is %s. It expires in %d minutes. Never share it with anyone.",
+		code, int(ttl.Minutes()))
+}
+
+// MailTransport emails codes through a mail.Sender (SMTP in production).
+// Subject and Note default to the sign-in wording.
+type MailTransport struct {
+	Sender  mail.Sender
+	Subject string
+	Note    string // closing line, e.g. what to do if it wasn't you
+}
+
+func (t *MailTransport) Deliver(ctx context.Context, to, code string, ttl time.Duration) error {
+	subject, note := t.Subject, t.Note
+	if subject == "" {
+		subject = "Your Tripzy verification code"
+	}
+	if note == "" {
+		note = "If you didn't try to sign in, change your password."
+	}
+	return t.Sender.Send(ctx, mail.Message{
+		To:      to,
+		Subject: subject,
+		Text:    message(code, ttl) + "\n\n" + note + "\n",
+	})
+}
+
+// HTTPSMSTransport posts {"to": ..., "message": ...} to a generic SMS
+// gateway, with an optional bearer token. Any 2xx counts as accepted.
+type HTTPSMSTransport struct {
+	URL   string
+	Token string
+	HC    *http.Client
+}
+
+func (t *HTTPSMSTransport) Deliver(ctx context.Context, to, code string, ttl time.Duration) error {
+	body, _ := json.Marshal(map[string]string{"to": to, "message": message(code, ttl)})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if t.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+t.Token)
+	}
+	hc := t.HC
+	if hc == nil {
+		hc = &http.Client{Timeout: 8 * time.Second}
+	}
+	res, err := hc.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		b, _ := io.ReadAll(io.LimitReader(res.Body, 4<<10))
+		return fmt.Errorf("sms gateway %s: %s", res.Status, b)
+	}
+	return nil
+}
+
+// LogTransport writes codes to the log. Development only.
+type LogTransport struct {
+	Channel Channel
+}
+
+func (t *LogTransport) Deliver(_ context.Context, to, code string, _ time.Duration) error {
+	log.Printf("otp (dev): %s code for %s is %s", t.Channel, to, code)
+	return nil
+}
@@ -0,0 +1,116 @@
+// Package password is the bridge's policy for new passwords. It runs before
+// a new password is handed to a backend, so every backend gets the same
+// rules; backends may still refuse a password for their own reasons.
+package password
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Class is a kind of character a password must contain.
+type Class string
+
+const (
+	Lower  Class = "lower"
+	Upper  Class = "upper"
+	Digit  Class = "digit"
+	Symbol Class = "symbol"
+)
+
+type Policy struct {
+	MinLength int     // default 10
+	MaxLength int     // default 128
+	Require   []Class // character classes that must all appear
+}
+
+// ParseClasses reads "lower,upper,digit".
+func ParseClasses(v string) ([]Class, error) {
+	var out []Class
+	for _, f := range strings.FieldsFunc(v, func(r rune) bool { return r == ',' || r == ' ' }) {
+		c := Class(strings.ToLower(f))
+		switch c {
+		case Lower, Upper, Digit, Symbol:
+			out = append(out, c)
+		default:
+			return nil, fmt.Errorf("unknown password character class %q", f)
+		}
+	}
+	return out, nil
+}
+
+func (p Policy) minLength() int {
+	if p.MinLength <= 0 {
+		return 10
+	}
+	return p.MinLength
+}
+
+func (p Policy) maxLength() int {
+	if p.MaxLength <= 0 {
+		return 128
+	}
+	return p.MaxLength
+}
+
+var classLabels = map[Class]string{
+	Lower:  "a lowercase letter",
+	Upper:  "an uppercase letter",
+	Digit:  "a digit",
+	Symbol: "a symbol",
+}
+
+// Rules describes the policy for the form, e.g. "At least 10 characters".
+func (p Policy) Rules() []string {
+	rules := []string{fmt.Sprintf("At least %d characters", p.minLength())}
+	for _, c := range p.Require {
+		rules = append(rules, "Contains "+classLabels[c])
+	}
+	rules = append(rules, "Does not contain your username or email")
+	return rules
+}
+
+// Check returns what is wrong with pw; nil means it passes. identifiers
+// (username, email) must not appear in the password.
+func (p Policy) Check(pw string, identifiers ...string) []string {
+	var problems []string
+	n := utf8.RuneCountInString(pw)
+	if n < p.minLength() {
+		problems = append(problems, fmt.Sprintf("Use at least %d characters.", p.minLength()))
+	}
+	if n > p.maxLength() {
+		problems = append(problems, fmt.Sprintf("Use at most %d characters.", p.maxLength()))
+	}
+	for _, c := range p.Require {
+		if !strings.ContainsFunc(pw, classFunc(c)) {
+			problems = append(problems, "Include "+classLabels[c]+".")
+		}
+	}
+	lower := strings.ToLower(pw)
+	for _, id := range identifiers {
+		id = strings.ToLower(strings.TrimSpace(id))
+		if local, _, ok := strings.Cut(id, "@"); ok {
+			id = local
+		}
+		if len(id) >= 3 && strings.Contains(lower, id) {
+			problems = append(problems, "Don't use your username or email in the password.")
+			break
+		}
+	}
+	return problems
+}
+
+func classFunc(c Class) func(rune) bool {
+	switch c {
+	case Lower:
+		return unicode.IsLower
+	case Upper:
+		return unicode.IsUpper
+	case Digit:
+		return unicode.IsDigit
+	default:
+		return func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.IsSpace(r) }
+	}
+}
@@ -0,0 +1,98 @@
+package password
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	all := Policy{Require: []Class{Lower, Upper, Digit, Symbol}}
+
+	tests := []struct {
+		name   string
+		policy Policy
+		pw     string
+		ids    []string
+		want   []string
+	}{
+		{name: "default length ok", pw: "abcdefghij"},
+		{name: "default too short", pw: "abcdefghi", want: []string{"Use at least 10 characters."}},
+		{name: "length in runes", policy: Policy{MinLength: 4}, pw: "ñññ", want: []string{"Use at least 4 characters."}},
+		{name: "custom min", policy: Policy{MinLength: 4}, pw: "abcd"},
+		{name: "default max", pw: strings.Repeat("a", 129), want: []string{"Use at most 128 characters."}},
+		{name: "custom max", policy: Policy{MinLength: 1, MaxLength: 5}, pw: "abcdef", want: []string{"Use at most 5 characters."}},
+		{name: "all classes", policy: all, pw: "Abcdefgh1!"},
+		{name: "no lower", policy: Policy{Require: []Class{Lower}}, pw: "ABCDEFGH12", want: []string{"Include a lowercase letter."}},
+		{name: "no upper", policy: Policy{Require: []Class{Upper}}, pw: "abcdefgh12", want: []string{"Include an uppercase letter."}},
+		{name: "no digit", policy: Policy{Require: []Class{Digit}}, pw: "abcdefghij", want: []string{"Include a digit."}},
+		{name: "no symbol", policy: Policy{Require: []Class{Symbol}}, pw: "abcdefgh12", want: []string{"Include a symbol."}},
+		{name: "space is not a symbol", policy: Policy{Require: []Class{Symbol}}, pw: "abcd efgh1", want: []string{"Include a symbol."}},
+		{name: "several problems", policy: all, pw: "abc", want: []string{
+			"Use at least 10 characters.", "Include an uppercase letter.", "Include a digit.", "Include a symbol.",
+		}},
+		{name: "contains username", pw: "xxAliceXX99", ids: []string{"alice"},
+			want: []string{"Don't use your username or email in the password."}},
+		{name: "contains email local part", pw: "my-bob.smith-pw", ids: []string{"alice", " Bob.Smith@Example.com "},
+			want: []string{"Don't use your username or email in the password."}},
+		{name: "reported once", pw: "alice-alice-pw", ids: []string{"alice", "alice@example.com"},
+			want: []string{"Don't use your username or email in the password."}},
+		{name: "empty identifier ignored", pw: "abcdefghij", ids: []string{"", "  "}},
+		{name: "short identifier ignored", pw: "joe-secret-pw", ids: []string{"jo"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.Check(tt.pw, tt.ids...); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Check(%q) = %q, want %q", tt.pw, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRules(t *testing.T) {
+	tests := []struct {
+		policy Policy
+		want   []string
+	}{
+		{
+			policy: Policy{},
+			want:   []string{"At least 10 characters", "Does not contain your username or email"},
+		},
+		{
+			policy: Policy{MinLength: 12, Require: []Class{Upper, Digit}},
+			want: []string{"At least 12 characters", "Contains an uppercase letter", "Contains a digit",
+				"Does not contain your username or email"},
+		},
+	}
+	for _, tt := range tests {
+		if got := tt.policy.Rules(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Rules(%+v) = %q, want %q", tt.policy, got, tt.want)
+		}
+	}
+}
+
+func TestParseClasses(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    []Class
+		wantErr bool
+	}{
+		{in: ""},
+		{in: "lower,upper,digit,symbol", want: []Class{Lower, Upper, Digit, Symbol}},
+		{in: " Upper , DIGIT ", want: []Class{Upper, Digit}},
+		{in: "lower digit", want: []Class{Lower, Digit}},
+		{in: "lower,,digit", want: []Class{Lower, Digit}},
+		{in: "lower,emoji", wantErr: true},
+		{in: "uppercase", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseClasses(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseClasses(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseClasses(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
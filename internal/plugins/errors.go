@@ -0,0 +1,78 @@
+package plugins
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Code says why Authenticate failed, so the bridge can tell the user
+// something useful and only count real failures toward lockout.
+type Code string
+
+const (
+	CodeInvalidCredentials Code = "invalid_credentials"
+	CodeAccountLocked      Code = "account_locked"
+	CodePasswordExpired    Code = "password_expired"
+	CodeMFARequired        Code = "mfa_required" // the backend wants a factor this plugin can't collect
+	CodeUnavailable        Code = "upstream_unavailable"
+	CodePasswordRejected   Code = "password_rejected" // new password refused by the backend
+	CodeAccountExists      Code = "account_exists"    // registration for an address that already has an account
+)
+
+// Error is a typed plugin failure. Err is the underlying cause, for logs.
+type Error struct {
+	Code Code
+	Err  error
+}
+
+func (e *Error) Error() string {
+	if e.Err == nil {
+		return string(e.Code)
+	}
+	return fmt.Sprintf("%s: %v", e.Code, e.Err)
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// Is matches any *Error with the same code, so errors.Is(err,
+// ErrInvalidCredentials) works on wrapped and annotated errors.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+var (
+	ErrInvalidCredentials = &Error{Code: CodeInvalidCredentials}
+	ErrAccountLocked      = &Error{Code: CodeAccountLocked}
+	ErrPasswordExpired    = &Error{Code: CodePasswordExpired}
+	ErrMFARequired        = &Error{Code: CodeMFARequired}
+	ErrUnavailable        = &Error{Code: CodeUnavailable}
+	ErrPasswordRejected   = &Error{Code: CodePasswordRejected}
+	ErrAccountExists      = &Error{Code: CodeAccountExists}
+)
+
+// Unavailable marks err as a backend outage (network error, timeout, 5xx).
+func Unavailable(err error) error {
+	return &Error{Code: CodeUnavailable, Err: err}
+}
+
+// ErrorCode returns the Code of a typed plugin error, or "" for anything
+// else. Plugins that return plain errors are treated by the bridge as
+// failed sign-ins that don't count toward lockout.
+func ErrorCode(err error) Code {
+	var pe *Error
+	if errors.As(err, &pe) {
+		return pe.Code
+	}
+	return ""
+}
+
+// knownCode reports whether c is one of the codes above.
+func knownCode(c Code) bool {
+	switch c {
+	case CodeInvalidCredentials, CodeAccountLocked, CodePasswordExpired, CodeMFARequired, CodeUnavailable,
+		CodePasswordRejected, CodeAccountExists:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,441 @@
+package plugins
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nduyhai/hydra-bridge/internal/tlsutil"
+)
+
+// HTTPAuthConfig describes a login service that checks a username and
+// password over HTTP, so it can be plugged in without Go code.
+type HTTPAuthConfig struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name,omitempty"`
+	IconURL     string `json:"icon_url,omitempty"`
+
+	URL       string `json:"url"`
+	Method    string `json:"method,omitempty"`   // default POST
+	Encoding  string `json:"encoding,omitempty"` // "json" (default) or "form"
+	TimeoutMS int    `json:"timeout_ms,omitempty"`
+	HealthURL string `json:"health_url,omitempty"` // GET, any 2xx is healthy
+
+	// Body is the request template. "{{username}}" and "{{password}}" in
+	// string values are replaced; form bodies must be flat.
+	Body    map[string]any    `json:"body"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Auth    HTTPAuthAuth      `json:"auth,omitempty"`
+	TLS     HTTPAuthTLS       `json:"tls,omitempty"`
+
+	Response HTTPAuthResponse `json:"response"`
+	// InvalidStatus lists statuses meaning "wrong credentials" (default
+	// 401, 403). StatusCodes maps other statuses to a failure code, e.g.
+	// 423 -> account_locked. Any other non-2xx status is an upstream failure.
+	InvalidStatus []int        `json:"invalid_status,omitempty"`
+	StatusCodes   map[int]Code `json:"status_codes,omitempty"`
+	AMR           []string     `json:"amr,omitempty"` // default ["pwd"]
+
+	// SubjectPrefix namespaces the ids this service returns, so user "42"
+	// here is not user "42" of another service. Default "<name>:".
+	SubjectPrefix string `json:"subject_prefix,omitempty"`
+}
+
+// HTTPAuthAuth authenticates the bridge to the login service. Secrets come
+// from environment variables so the file can be committed.
+type HTTPAuthAuth struct {
+	Type        string `json:"type,omitempty"`   // "", "api_key", "bearer" or "basic"
+	Header      string `json:"header,omitempty"` // api_key header, default X-API-Key
+	ValueEnv    string `json:"value_env,omitempty"`
+	UsernameEnv string `json:"username_env,omitempty"` // basic
+	PasswordEnv string `json:"password_env,omitempty"` // basic
+}
+
+// HTTPAuthTLS pins the service CA and enables mTLS with a client cert.
+type HTTPAuthTLS struct {
+	CAFile   string `json:"ca_file,omitempty"`
+	CertFile string `json:"cert_file,omitempty"`
+	KeyFile  string `json:"key_file,omitempty"`
+}
+
+// HTTPAuthResponse locates fields in a 2xx JSON response by dotted path
+// ("data.user.id", "roles.0").
+type HTTPAuthResponse struct {
+	Success  string            `json:"success,omitempty"` // must be true/"true"/non-zero; empty = 2xx suffices
+	Subject  string            `json:"subject"`
+	Claims   string            `json:"claims,omitempty"`    // object copied into the claims
+	ClaimMap map[string]string `json:"claim_map,omitempty"` // claim -> path
+
+	// Error is the path to the backend's failure reason. ErrorMap turns
+	// its values into failure codes; values that already are codes
+	// ("account_locked", "password_expired", ...) need no entry.
+	Error    string          `json:"error,omitempty"`
+	ErrorMap map[string]Code `json:"error_map,omitempty"`
+}
+
+// HTTPAuthPlugin is the configurable HTTP authenticator.
+type HTTPAuthPlugin struct {
+	cfg    HTTPAuthConfig
+	hc     *http.Client
+	header http.Header // static headers plus service auth
+	prefix string      // prepended to subjects; only internal has none
+}
+
+// NewHTTPAuthPlugin validates cfg and builds the plugin. ctx bounds the
+// client-certificate reloader when mTLS is configured.
+func NewHTTPAuthPlugin(ctx context.Context, cfg HTTPAuthConfig) (*HTTPAuthPlugin, error) {
+	if cfg.Name == "" || cfg.URL == "" {
+		return nil, fmt.Errorf("http auth plugin: name and url are required")
+	}
+	if cfg.Response.Subject == "" {
+		return nil, fmt.Errorf("http auth plugin %s: response.subject is required", cfg.Name)
+	}
+	cfg.Method = strings.ToUpper(orDefault(cfg.Method, http.MethodPost))
+	cfg.Encoding = orDefault(cfg.Encoding, "json")
+	if cfg.Encoding != "json" && cfg.Encoding != "form" {
+		return nil, fmt.Errorf("http auth plugin %s: encoding must be json or form", cfg.Name)
+	}
+	if cfg.Encoding == "form" {
+		for k, v := range cfg.Body {
+			switch v.(type) {
+			case map[string]any, []any:
+				return nil, fmt.Errorf("http auth plugin %s: form body field %q must be a scalar", cfg.Name, k)
+			}
+		}
+	}
+	for _, c := range cfg.StatusCodes {
+		if !knownCode(c) {
+			return nil, fmt.Errorf("http auth plugin %s: unknown failure code %q", cfg.Name, c)
+		}
+	}
+	for _, c := range cfg.Response.ErrorMap {
+		if !knownCode(c) {
+			return nil, fmt.Errorf("http auth plugin %s: unknown failure code %q", cfg.Name, c)
+		}
+	}
+	if len(cfg.InvalidStatus) == 0 {
+		cfg.InvalidStatus = []int{http.StatusUnauthorized, http.StatusForbidden}
+	}
+	if len(cfg.AMR) == 0 {
+		cfg.AMR = []string{"pwd"}
+	}
+
+	header := http.Header{}
+	for k, v := range cfg.Headers {
+		header.Set(k, v)
+	}
+	secret := func(env string) (string, error) {
+		v := os.Getenv(env)
+		if env == "" || v == "" {
+			return "", fmt.Errorf("http auth plugin %s: env %q is empty", cfg.Name, env)
+		}
+		return v, nil
+	}
+	switch cfg.Auth.Type {
+	case "":
+	case "api_key":
+		v, err := secret(cfg.Auth.ValueEnv)
+		if err != nil {
+			return nil, err
+		}
+		header.Set(orDefault(cfg.Auth.Header, "X-API-Key"), v)
+	case "bearer":
+		v, err := secret(cfg.Auth.ValueEnv)
+		if err != nil {
+			return nil, err
+		}
+		header.Set("Authorization", "Bearer "+v)
+	case "basic":
+		u, err := secret(cfg.Auth.UsernameEnv)
+		if err != nil {
+			return nil, err
+		}
+		pw, err := secret(cfg.Auth.PasswordEnv)
+		if err != nil {
+			return nil, err
+		}
+		header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(u+":"+pw)))
+	default:
+		return nil, fmt.Errorf("http auth plugin %s: unknown auth type %q", cfg.Name, cfg.Auth.Type)
+	}
+
+	timeout := 8 * time.Second
+	if cfg.TimeoutMS > 0 {
+		timeout = time.Duration(cfg.TimeoutMS) * time.Millisecond
+	}
+	hc := &http.Client{Timeout: timeout}
+	if t := cfg.TLS; t.CAFile != "" || t.CertFile != "" || t.KeyFile != "" {
+		tlsCfg, err := tlsutil.ClientConfig(ctx, t.CAFile, t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("http auth plugin %s: %w", cfg.Name, err)
+		}
+		tr := http.DefaultTransport.(*http.Transport).Clone()
+		tr.TLSClientConfig = tlsCfg
+		hc.Transport = tr
+	}
+	return &HTTPAuthPlugin{cfg: cfg, hc: hc, header: header, prefix: orDefault(cfg.SubjectPrefix, cfg.Name+":")}, nil
+}
+
+// LoadHTTPAuthPlugins reads {"plugins": [HTTPAuthConfig...]} from a JSON file.
+func LoadHTTPAuthPlugins(ctx context.Context, path string) ([]*HTTPAuthPlugin, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file struct {
+		Plugins []HTTPAuthConfig `json:"plugins"`
+	}
+	if err := json.Unmarshal(b, &file); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	out := make([]*HTTPAuthPlugin, 0, len(file.Plugins))
+	for _, c := range file.Plugins {
+		p, err := NewHTTPAuthPlugin(ctx, c)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, nil
+}
+
+func (p *HTTPAuthPlugin) Name() string { return p.cfg.Name }
+
+func (p *HTTPAuthPlugin) DisplayName() string { return orDefault(p.cfg.DisplayName, p.cfg.Name) }
+
+func (p *HTTPAuthPlugin) IconURL() string { return p.cfg.IconURL }
+
+func (p *HTTPAuthPlugin) Authenticate(ctx context.Context, cred Credentials) (*AuthResult, error) {
+	fill := strings.NewReplacer("{{username}}", cred.Username, "{{password}}", cred.Password)
+
+	var body io.Reader
+	var contentType string
+	switch p.cfg.Encoding {
+	case "form":
+		form := url.Values{}
+		for k, v := range p.cfg.Body {
+			form.Set(k, fill.Replace(fmt.Sprint(v)))
+		}
+		body, contentType = strings.NewReader(form.Encode()), "application/x-www-form-urlencoded"
+	default:
+		b, err := json.Marshal(renderTemplate(p.cfg.Body, fill))
+		if err != nil {
+			return nil, err
+		}
+		body, contentType = bytes.NewReader(b), "application/json"
+	}
+
+	req, err := http.NewRequestWithContext(ctx, p.cfg.Method, p.cfg.URL, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header = p.header.Clone()
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Accept", "application/json")
+
+	res, err := p.hc.Do(req)
+	if err != nil {
+		return nil, Unavailable(fmt.Errorf("%s: %w", p.cfg.Name, err))
+	}
+	defer func(Body io.ReadCloser) {
+		_ = Body.Close()
+	}(res.Body)
+
+	b, _ := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var doc any
+	decodeErr := dec.Decode(&doc)
+
+	rs := p.cfg.Response
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		if code := p.failureCode(doc); code != "" {
+			return nil, &Error{Code: code, Err: fmt.Errorf("%s: login service %s", p.cfg.Name, res.Status)}
+		}
+		if code, ok := p.cfg.StatusCodes[res.StatusCode]; ok {
+			return nil, &Error{Code: code, Err: fmt.Errorf("%s: login service %s", p.cfg.Name, res.Status)}
+		}
+		if slices.Contains(p.cfg.InvalidStatus, res.StatusCode) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, Unavailable(fmt.Errorf("%s: login service %s: %s", p.cfg.Name, res.Status, string(b)))
+	}
+	if decodeErr != nil {
+		return nil, Unavailable(fmt.Errorf("%s: login service response: %w", p.cfg.Name, decodeErr))
+	}
+
+	if rs.Success != "" {
+		if v, _ := lookupPath(doc, rs.Success); !truthy(v) {
+			if code := p.failureCode(doc); code != "" {
+				return nil, &Error{Code: code}
+			}
+			return nil, ErrInvalidCredentials
+		}
+	}
+	sub := scalarString(lookupPath(doc, rs.Subject))
+	if sub == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	claims := map[string]interface{}{}
+	if rs.Claims != "" {
+		v, _ := lookupPath(doc, rs.Claims)
+		if m, ok := v.(map[string]any); ok {
+			for k, e := range m {
+				claims[k] = jsonValue(e)
+			}
+		}
+	}
+	for claim, path := range rs.ClaimMap {
+		if v, ok := lookupPath(doc, path); ok {
+			claims[claim] = jsonValue(v)
+		}
+	}
+
+	return &AuthResult{Subject: p.prefix + sub, Claims: claims, AMR: slices.Clone(p.cfg.AMR)}, nil
+}
+
+func (p *HTTPAuthPlugin) CheckHealth(ctx context.Context) error {
+	if p.cfg.HealthURL == "" {
+		return nil
+	}
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, p.cfg.HealthURL, nil)
+	req.Header = p.header.Clone()
+	res, err := p.hc.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func(Body io.ReadCloser) {
+		_ = Body.Close()
+	}(res.Body)
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("%s health %s", p.cfg.Name, res.Status)
+	}
+	return nil
+}
+
+// failureCode reads the backend's failure reason from the response, if the
+// config says where it is and the value is one we know.
+func (p *HTTPAuthPlugin) failureCode(doc any) Code {
+	if p.cfg.Response.Error == "" {
+		return ""
+	}
+	v := scalarString(lookupPath(doc, p.cfg.Response.Error))
+	if c, ok := p.cfg.Response.ErrorMap[v]; ok {
+		return c
+	}
+	if knownCode(Code(v)) {
+		return Code(v)
+	}
+	return ""
+}
+
+// renderTemplate copies v, filling placeholders in string leaves. Values
+// are substituted after decoding, so they can't break out of the JSON.
+func renderTemplate(v any, fill *strings.Replacer) any {
+	switch t := v.(type) {
+	case string:
+		return fill.Replace(t)
+	case map[string]any:
+		out := make(map[string]any, len(t))
+		for k, e := range t {
+			out[k] = renderTemplate(e, fill)
+		}
+		return out
+	case []any:
+		out := make([]any, len(t))
+		for i, e := range t {
+			out[i] = renderTemplate(e, fill)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// lookupPath walks a decoded JSON document along a dotted path.
+func lookupPath(doc any, path string) (any, bool) {
+	cur := doc
+	for _, part := range strings.Split(path, ".") {
+		switch t := cur.(type) {
+		case map[string]any:
+			v, ok := t[part]
+			if !ok {
+				return nil, false
+			}
+			cur = v
+		case []any:
+			i, err := strconv.Atoi(part)
+			if err != nil || i < 0 || i >= len(t) {
+				return nil, false
+			}
+			cur = t[i]
+		default:
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+func truthy(v any) bool {
+	switch t := v.(type) {
+	case bool:
+		return t
+	case string:
+		return strings.EqualFold(t, "true") || t == "1" || strings.EqualFold(t, "ok")
+	case json.Number:
+		return t.String() != "0"
+	default:
+		return false
+	}
+}
+
+func scalarString(v any, ok bool) string {
+	if !ok {
+		return ""
+	}
+	switch t := v.(type) {
+	case string:
+		return t
+	case json.Number:
+		return t.String()
+	default:
+		return ""
+	}
+}
+
+// jsonValue turns json.Number back into a plain number for the claims.
+func jsonValue(v any) any {
+	switch t := v.(type) {
+	case json.Number:
+		if i, err := t.Int64(); err == nil {
+			return i
+		}
+		f, _ := t.Float64()
+		return f
+	case map[string]any:
+		out := make(map[string]any, len(t))
+		for k, e := range t {
+			out[k] = jsonValue(e)
+		}
+		return out
+	case []any:
+		out := make([]any, len(t))
+		for i, e := range t {
+			out[i] = jsonValue(e)
+		}
+		return out
+	default:
+		return v
+	}
+}
@@ -0,0 +1,83 @@
+package plugins
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// decodeDoc decodes a response body the way the plugin does.
+func decodeDoc(t *testing.T, body string) any {
+	t.Helper()
+	dec := json.NewDecoder(strings.NewReader(body))
+	dec.UseNumber()
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		t.Fatalf("decode %s: %v", body, err)
+	}
+	return doc
+}
+
+func TestLookupPath(t *testing.T) {
+	const body = `{"ok": true, "user": {"id": 42, "roles": ["a", "b"], "profile": {"email": "x@example.com"}}, "list": [{"v": "first"}]}`
+
+	tests := []struct {
+		path   string
+		want   any
+		wantOK bool
+	}{
+		{path: "ok", want: true, wantOK: true},
+		{path: "user.id", want: json.Number("42"), wantOK: true},
+		{path: "user.profile.email", want: "x@example.com", wantOK: true},
+		{path: "user.roles.1", want: "b", wantOK: true},
+		{path: "list.0.v", want: "first", wantOK: true},
+		{path: "user.roles", want: []any{"a", "b"}, wantOK: true},
+		{path: "missing"},
+		{path: "user.missing"},
+		{path: "user.roles.2"},
+		{path: "user.roles.-1"},
+		{path: "user.roles.x"},
+		{path: "ok.deeper"},
+		{path: ""},
+	}
+	doc := decodeDoc(t, body)
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, ok := lookupPath(doc, tt.path)
+			if ok != tt.wantOK || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("lookupPath(%q) = %v, %v; want %v, %v", tt.path, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestFailureCode(t *testing.T) {
+	tests := []struct {
+		name string
+		resp HTTPAuthResponse
+		body string
+		want Code
+	}{
+		{name: "no error path", resp: HTTPAuthResponse{}, body: `{"error": "account_locked"}`},
+		{name: "known code", resp: HTTPAuthResponse{Error: "error"}, body: `{"error": "account_locked"}`,
+			want: CodeAccountLocked},
+		{name: "unknown code", resp: HTTPAuthResponse{Error: "error"}, body: `{"error": "teapot"}`},
+		{name: "missing field", resp: HTTPAuthResponse{Error: "error"}, body: `{"ok": false}`},
+		{name: "not a string", resp: HTTPAuthResponse{Error: "error"}, body: `{"error": {"code": 1}}`},
+		{name: "mapped", resp: HTTPAuthResponse{Error: "error.code", ErrorMap: map[string]Code{"PWD_EXPIRED": CodePasswordExpired}},
+			body: `{"error": {"code": "PWD_EXPIRED"}}`, want: CodePasswordExpired},
+		{name: "mapped number", resp: HTTPAuthResponse{Error: "err", ErrorMap: map[string]Code{"1007": CodeMFARequired}},
+			body: `{"err": 1007}`, want: CodeMFARequired},
+		{name: "map wins over known code", resp: HTTPAuthResponse{Error: "error", ErrorMap: map[string]Code{"account_locked": CodeUnavailable}},
+			body: `{"error": "account_locked"}`, want: CodeUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &HTTPAuthPlugin{cfg: HTTPAuthConfig{Response: tt.resp}}
+			if got := p.failureCode(decodeDoc(t, tt.body)); got != tt.want {
+				t.Errorf("failureCode = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -4,31 +4,43 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"time"
 )
 
+// internalLoginPlugin is the Tripzy login API: the generic HTTP
+// authenticator with the API's contract, plus TOTP and health endpoints.
 type internalLoginPlugin struct {
+	*HTTPAuthPlugin
 	loginAPI string
 	hc       *http.Client
 }
 
 func NewInternalLoginPlugin(loginAPI string) AuthPlugin {
-	return &internalLoginPlugin{
-		loginAPI: loginAPI,
-		hc: &http.Client{
-			Timeout: 8 * time.Second,
+	hc := &http.Client{Timeout: 8 * time.Second}
+	// Built directly rather than through NewHTTPAuthPlugin: the contract is
+	// fixed, so there is nothing to validate and nothing that can fail.
+	auth := &HTTPAuthPlugin{
+		cfg: HTTPAuthConfig{
+			Name:          "internal",
+			DisplayName:   "Tripzy account",
+			URL:           loginAPI + "/login",
+			Method:        http.MethodPost,
+			Encoding:      "json",
+			Body:          map[string]any{"username": "{{username}}", "password": "{{password}}"},
+			Response:      HTTPAuthResponse{Success: "ok", Subject: "user_id", Claims: "claims", Error: "error"},
+			InvalidStatus: []int{http.StatusUnauthorized, http.StatusForbidden},
+			StatusCodes:   map[int]Code{http.StatusLocked: CodeAccountLocked},
+			AMR:           []string{"pwd"},
 		},
+		hc:     hc,
+		header: http.Header{},
+		// no prefix: the bridge's own accounts keep their bare ids
 	}
-}
-
-func (p *internalLoginPlugin) Name() string { return "internal" }
-
-type loginReq struct {
-	Username string `json:"username"`
-	Password string `json:"password"`
+	return &internalLoginPlugin{HTTPAuthPlugin: auth, loginAPI: loginAPI, hc: hc}
 }
 
 type loginResp struct {
@@ -38,18 +50,21 @@ type loginResp struct {
 	Error  string                 `json:"error"`
 }
 
-func (p *internalLoginPlugin) Authenticate(ctx context.Context, cred Credentials) (*AuthResult, error) {
-	u := p.loginAPI + "/login"
-	body := loginReq{Username: cred.Username, Password: cred.Password}
+type totpReq struct {
+	UserID string `json:"user_id"`
+	Code   string `json:"code"`
+}
+
+func (p *internalLoginPlugin) VerifyTOTP(ctx context.Context, subject, code string) error {
 	buf := new(bytes.Buffer)
-	_ = json.NewEncoder(buf).Encode(body)
+	_ = json.NewEncoder(buf).Encode(totpReq{UserID: subject, Code: code})
 
-	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, u, buf)
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, p.loginAPI+"/mfa/totp/verify", buf)
 	req.Header.Set("Content-Type", "application/json")
 
 	res, err := p.hc.Do(req)
 	if err != nil {
-		return nil, err
+		return Unavailable(err)
 	}
 	defer func(Body io.ReadCloser) {
 		_ = Body.Close()
@@ -57,20 +72,168 @@ func (p *internalLoginPlugin) Authenticate(ctx context.Context, cred Credentials
 
 	b, _ := io.ReadAll(res.Body)
 	if res.StatusCode >= 300 {
-		return nil, fmt.Errorf("login api %s: %s", res.Status, string(b))
+		return Unavailable(fmt.Errorf("login api %s: %s", res.Status, string(b)))
 	}
-
 	var out loginResp
 	if err := json.Unmarshal(b, &out); err != nil {
+		return Unavailable(err)
+	}
+	if !out.OK {
+		return &Error{Code: CodeInvalidCredentials, Err: fmt.Errorf("invalid code")}
+	}
+	return nil
+}
+
+type passwordChangeReq struct {
+	Username    string `json:"username"`
+	OldPassword string `json:"old_password"`
+	NewPassword string `json:"new_password"`
+}
+
+func (p *internalLoginPlugin) ChangePassword(ctx context.Context, pc PasswordChange) error {
+	buf := new(bytes.Buffer)
+	_ = json.NewEncoder(buf).Encode(passwordChangeReq{
+		Username:    pc.Username,
+		OldPassword: pc.OldPassword,
+		NewPassword: pc.NewPassword,
+	})
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, p.loginAPI+"/password/change", buf)
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := p.hc.Do(req)
+	if err != nil {
+		return Unavailable(err)
+	}
+	defer func(Body io.ReadCloser) {
+		_ = Body.Close()
+	}(res.Body)
+
+	b, _ := io.ReadAll(res.Body)
+	var out loginResp
+	_ = json.Unmarshal(b, &out)
+	switch {
+	case res.StatusCode == http.StatusUnauthorized:
+		return ErrInvalidCredentials
+	case res.StatusCode == http.StatusLocked:
+		return ErrAccountLocked
+	case res.StatusCode == http.StatusConflict, res.StatusCode == http.StatusUnprocessableEntity:
+		// 409 here is the new password clashing with history, not a
+		// duplicate account.
+		return &Error{Code: CodePasswordRejected, Err: fmt.Errorf("login api %s: %s", res.Status, out.Error)}
+	case res.StatusCode >= 300:
+		return Unavailable(fmt.Errorf("login api %s: %s", res.Status, string(b)))
+	case !out.OK:
+		return &Error{Code: CodePasswordRejected, Err: fmt.Errorf("login api: %s", out.Error)}
+	}
+	return nil
+}
+
+func (p *internalLoginPlugin) FindAccount(ctx context.Context, email string) (*Account, error) {
+	var out loginResp
+	err := p.post(ctx, "/users/lookup", map[string]string{"email": email}, &out)
+	switch {
+	case errors.Is(err, errNotFound):
+		return nil, ErrInvalidCredentials
+	case err != nil:
 		return nil, err
+	case !out.OK || out.UserID == "":
+		return nil, ErrInvalidCredentials
 	}
-	if !out.OK || out.UserID == "" {
-		return nil, fmt.Errorf("invalid credentials")
+	acct := &Account{ID: out.UserID, Email: email}
+	acct.Username, _ = out.Claims["preferred_username"].(string)
+	if acct.Username == "" {
+		acct.Username = email
 	}
+	return acct, nil
+}
 
-	// IMPORTANT: subject becomes OIDC sub
-	return &AuthResult{
-		Subject: out.UserID,
-		Claims:  out.Claims,
-	}, nil
+type passwordResetReq struct {
+	UserID      string `json:"user_id"`
+	NewPassword string `json:"new_password"`
+}
+
+func (p *internalLoginPlugin) ResetPassword(ctx context.Context, accountID, newPassword string) error {
+	var out loginResp
+	err := p.post(ctx, "/password/reset", passwordResetReq{UserID: accountID, NewPassword: newPassword}, &out)
+	switch {
+	case errors.Is(err, errNotFound):
+		return ErrInvalidCredentials
+	case err != nil:
+		return err
+	case !out.OK:
+		return &Error{Code: CodePasswordRejected, Err: fmt.Errorf("login api: %s", out.Error)}
+	}
+	return nil
+}
+
+type registerReq struct {
+	Email    string            `json:"email"`
+	Name     string            `json:"name,omitempty"`
+	Password string            `json:"password"`
+	Fields   map[string]string `json:"fields,omitempty"`
+}
+
+func (p *internalLoginPlugin) Register(ctx context.Context, reg Registration) (*AuthResult, error) {
+	var out loginResp
+	err := p.post(ctx, "/users", registerReq{Email: reg.Email, Name: reg.Name, Password: reg.Password, Fields: reg.Fields}, &out)
+	switch {
+	case err != nil:
+		return nil, err
+	case !out.OK || out.UserID == "":
+		return nil, Unavailable(fmt.Errorf("login api: register: %s", out.Error))
+	}
+	return &AuthResult{Subject: out.UserID, Claims: out.Claims, AMR: []string{"pwd"}}, nil
+}
+
+var errNotFound = errors.New("login api: not found")
+
+// post sends a JSON request to the login API. 404 is errNotFound, 409 is
+// ErrAccountExists, 422 is ErrPasswordRejected and other failures are
+// upstream outages.
+func (p *internalLoginPlugin) post(ctx context.Context, path string, in, out any) error {
+	buf := new(bytes.Buffer)
+	_ = json.NewEncoder(buf).Encode(in)
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, p.loginAPI+path, buf)
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := p.hc.Do(req)
+	if err != nil {
+		return Unavailable(err)
+	}
+	defer func(Body io.ReadCloser) {
+		_ = Body.Close()
+	}(res.Body)
+
+	b, _ := io.ReadAll(res.Body)
+	switch {
+	case res.StatusCode == http.StatusNotFound:
+		return errNotFound
+	case res.StatusCode == http.StatusConflict:
+		return &Error{Code: CodeAccountExists, Err: fmt.Errorf("login api %s: %s", res.Status, string(b))}
+	case res.StatusCode == http.StatusUnprocessableEntity:
+		return &Error{Code: CodePasswordRejected, Err: fmt.Errorf("login api %s: %s", res.Status, string(b))}
+	case res.StatusCode >= 300:
+		return Unavailable(fmt.Errorf("login api %s: %s", res.Status, string(b)))
+	}
+	if err := json.Unmarshal(b, out); err != nil {
+		return Unavailable(err)
+	}
+	return nil
+}
+
+func (p *internalLoginPlugin) CheckHealth(ctx context.Context) error {
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, p.loginAPI+"/healthz", nil)
+	res, err := p.hc.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func(Body io.ReadCloser) {
+		_ = Body.Close()
+	}(res.Body)
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("login api %s", res.Status)
+	}
+	return nil
 }
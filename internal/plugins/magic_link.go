@@ -0,0 +1,243 @@
+package plugins
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nduyhai/hydra-bridge/internal/mail"
+)
+
+// ErrLinkThrottled is returned by SendLink when a link for the same address
+// was sent too recently.
+var ErrLinkThrottled = errors.New("magic link: resend requested too soon")
+
+// MagicLinkConfig configures the passwordless email plugin.
+type MagicLinkConfig struct {
+	LoginAPI string      // resolves an email to a user (POST /users/lookup)
+	Secret   []byte      // HMAC key for link tokens
+	Mailer   mail.Sender // delivers the link
+	TTL      time.Duration
+	Resend   time.Duration // minimum gap between links to one address
+}
+
+type magicLinkPlugin struct {
+	cfg MagicLinkConfig
+	hc  *http.Client
+
+	mu       sync.Mutex
+	lastSent map[string]time.Time // email -> last link
+	used     map[string]time.Time // token id -> expiry, for single use
+}
+
+func NewMagicLinkPlugin(cfg MagicLinkConfig) AuthPlugin {
+	if cfg.TTL <= 0 {
+		cfg.TTL = 15 * time.Minute
+	}
+	if cfg.Resend <= 0 {
+		cfg.Resend = time.Minute
+	}
+	return &magicLinkPlugin{
+		cfg:      cfg,
+		hc:       &http.Client{Timeout: 8 * time.Second},
+		lastSent: map[string]time.Time{},
+		used:     map[string]time.Time{},
+	}
+}
+
+func (p *magicLinkPlugin) Name() string { return "magic-link" }
+
+func (p *magicLinkPlugin) DisplayName() string { return "Email link" }
+
+func (p *magicLinkPlugin) IconURL() string { return "" }
+
+// linkToken is signed and base64url-encoded into the link. The browser
+// binding is hashed so the raw cookie-derived value never leaves the bridge.
+type linkToken struct {
+	ID        string `json:"jti"`
+	Email     string `json:"email"`
+	Challenge string `json:"ch"`
+	Binding   string `json:"bnd"`
+	Exp       int64  `json:"exp"`
+}
+
+func (p *magicLinkPlugin) SendLink(ctx context.Context, req LinkRequest) error {
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+	if email == "" {
+		return fmt.Errorf("magic link: empty email")
+	}
+
+	now := time.Now()
+	p.mu.Lock()
+	if last, ok := p.lastSent[email]; ok && now.Sub(last) < p.cfg.Resend {
+		p.mu.Unlock()
+		return ErrLinkThrottled
+	}
+	p.lastSent[email] = now
+	for k, t := range p.lastSent {
+		if now.Sub(t) > p.cfg.Resend {
+			delete(p.lastSent, k)
+		}
+	}
+	p.mu.Unlock()
+
+	// Unknown addresses get no mail, but the caller can't tell the
+	// difference; otherwise the form would reveal who has an account.
+	if _, err := p.lookup(ctx, email); err != nil {
+		if errors.Is(err, ErrUnavailable) {
+			return err
+		}
+		log.Printf("magic-link: no link sent: %v", err)
+		return nil
+	}
+
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	tok := p.sign(linkToken{
+		ID:        base64.RawURLEncoding.EncodeToString(id),
+		Email:     email,
+		Challenge: req.Challenge,
+		Binding:   hashBinding(req.Binding),
+		Exp:       now.Add(p.cfg.TTL).Unix(),
+	})
+
+	u, err := url.Parse(req.CallbackURL)
+	if err != nil {
+		return err
+	}
+	q := u.Query()
+	q.Set("token", tok)
+	u.RawQuery = q.Encode()
+
+	return p.cfg.Mailer.Send(ctx, mail.Message{
+		To:      email,
+		Subject: "Your Tripzy sign-in link",
+		Text: "Click the link below to sign in. It works once, in the browser where you asked for it,\n" +
+			fmt.Sprintf("and expires in %d minutes.\n\n%s\n\n", int(p.cfg.TTL.Minutes()), u.String()) +
+			"If you didn't try to sign in, you can ignore this email.\n",
+	})
+}
+
+func (p *magicLinkPlugin) Authenticate(ctx context.Context, cred Credentials) (*AuthResult, error) {
+	t, err := p.verify(cred.Token)
+	if err != nil {
+		return nil, err
+	}
+	if t.Challenge != cred.Challenge {
+		return nil, fmt.Errorf("magic link: issued for another login")
+	}
+	if !hmac.Equal([]byte(t.Binding), []byte(hashBinding(cred.Binding))) {
+		return nil, fmt.Errorf("magic link: opened in another browser")
+	}
+	if err := p.consume(t); err != nil {
+		return nil, err
+	}
+
+	res, err := p.lookup(ctx, t.Email)
+	if err != nil {
+		return nil, err
+	}
+	res.AMR = []string{"email"}
+	return res, nil
+}
+
+func (p *magicLinkPlugin) sign(t linkToken) string {
+	payload, _ := json.Marshal(t)
+	mac := hmac.New(sha256.New, p.cfg.Secret)
+	mac.Write(payload)
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (p *magicLinkPlugin) verify(tok string) (*linkToken, error) {
+	payloadB64, sigB64, ok := strings.Cut(tok, ".")
+	if !ok {
+		return nil, fmt.Errorf("magic link: malformed token")
+	}
+	payload, err1 := base64.RawURLEncoding.DecodeString(payloadB64)
+	sig, err2 := base64.RawURLEncoding.DecodeString(sigB64)
+	if err1 != nil || err2 != nil {
+		return nil, fmt.Errorf("magic link: malformed token")
+	}
+	mac := hmac.New(sha256.New, p.cfg.Secret)
+	mac.Write(payload)
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		return nil, fmt.Errorf("magic link: bad signature")
+	}
+	var t linkToken
+	if err := json.Unmarshal(payload, &t); err != nil {
+		return nil, err
+	}
+	if time.Now().Unix() > t.Exp {
+		return nil, fmt.Errorf("magic link: expired")
+	}
+	return &t, nil
+}
+
+// consume marks the token used. Entries live until the token would have
+// expired anyway. The store is per process: run one replica or put sticky
+// sessions in front when using this plugin.
+func (p *magicLinkPlugin) consume(t *linkToken) error {
+	now := time.Now()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for id, exp := range p.used {
+		if now.After(exp) {
+			delete(p.used, id)
+		}
+	}
+	if _, seen := p.used[t.ID]; seen {
+		return fmt.Errorf("magic link: already used")
+	}
+	p.used[t.ID] = time.Unix(t.Exp, 0)
+	return nil
+}
+
+func hashBinding(b string) string {
+	sum := sha256.Sum256([]byte("magic-link|" + b))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// lookup resolves an email to the user via the login API.
+func (p *magicLinkPlugin) lookup(ctx context.Context, email string) (*AuthResult, error) {
+	buf := new(bytes.Buffer)
+	_ = json.NewEncoder(buf).Encode(map[string]string{"email": email})
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, p.cfg.LoginAPI+"/users/lookup", buf)
+	req.Header.Set("Content-Type", "application/json")
+	res, err := p.hc.Do(req)
+	if err != nil {
+		return nil, Unavailable(err)
+	}
+	defer func(Body io.ReadCloser) {
+		_ = Body.Close()
+	}(res.Body)
+
+	b, _ := io.ReadAll(res.Body)
+	switch {
+	case res.StatusCode == http.StatusNotFound:
+		return nil, &Error{Code: CodeInvalidCredentials, Err: fmt.Errorf("unknown user")}
+	case res.StatusCode >= 300:
+		return nil, Unavailable(fmt.Errorf("login api %s: %s", res.Status, string(b)))
+	}
+	var out loginResp
+	if err := json.Unmarshal(b, &out); err != nil {
+		return nil, Unavailable(err)
+	}
+	if !out.OK || out.UserID == "" {
+		return nil, &Error{Code: CodeInvalidCredentials, Err: fmt.Errorf("unknown user")}
+	}
+	return &AuthResult{Subject: out.UserID, Claims: out.Claims}, nil
+}
@@ -2,6 +2,7 @@ package plugins
 
 import (
 	"fmt"
+	"sort"
 	"sync"
 )
 
@@ -29,3 +30,15 @@ func (r *Registry) Get(name string) (AuthPlugin, error) {
 	}
 	return p, nil
 }
+
+// All returns registered plugins ordered by name.
+func (r *Registry) All() []AuthPlugin {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]AuthPlugin, 0, len(r.plugins))
+	for _, p := range r.plugins {
+		out = append(out, p)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name() < out[j].Name() })
+	return out
+}
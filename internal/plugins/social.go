@@ -0,0 +1,177 @@
+package plugins
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// SocialConfig configures an upstream OAuth2 provider. The endpoint fields
+// default to the real provider; override them to point at local stubs.
+type SocialConfig struct {
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string // the bridge's /login/oauth/callback
+	Scopes       []string
+
+	AuthURL     string
+	TokenURL    string
+	UserInfoURL string // API base for GitHub, userinfo endpoint otherwise
+}
+
+// socialProvider is the shared authorization-code + PKCE client. Each
+// provider supplies its defaults and how to turn tokens into an AuthResult.
+type socialProvider struct {
+	name, display string
+	cfg           SocialConfig
+	hc            *http.Client
+	extraAuth     url.Values // provider-specific authorization parameters
+	profile       func(ctx context.Context, tok *tokenResponse) (*AuthResult, error)
+}
+
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	IDToken     string `json:"id_token"`
+	Error       string `json:"error"`
+	ErrorDesc   string `json:"error_description"`
+}
+
+func newSocialProvider(name, display string, cfg SocialConfig) *socialProvider {
+	return &socialProvider{
+		name:    name,
+		display: display,
+		cfg:     cfg,
+		hc:      &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (p *socialProvider) Name() string { return p.name }
+
+func (p *socialProvider) DisplayName() string { return p.display }
+
+func (p *socialProvider) IconURL() string { return "" }
+
+func (p *socialProvider) AuthCodeURL(state, codeChallenge string) string {
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.cfg.ClientID},
+		"redirect_uri":          {p.cfg.RedirectURL},
+		"scope":                 {strings.Join(p.cfg.Scopes, " ")},
+		"state":                 {state},
+		"code_challenge":        {codeChallenge},
+		"code_challenge_method": {"S256"},
+	}
+	for k, v := range p.extraAuth {
+		q[k] = v
+	}
+	sep := "?"
+	if strings.Contains(p.cfg.AuthURL, "?") {
+		sep = "&"
+	}
+	return p.cfg.AuthURL + sep + q.Encode()
+}
+
+func (p *socialProvider) Authenticate(ctx context.Context, cred Credentials) (*AuthResult, error) {
+	if cred.Token == "" {
+		return nil, fmt.Errorf("%s: missing authorization code", p.name)
+	}
+	tok, err := p.exchange(ctx, cred.Token, cred.Verifier)
+	if err != nil {
+		return nil, err
+	}
+	res, err := p.profile(ctx, tok)
+	if err != nil {
+		return nil, err
+	}
+	res.AMR = []string{"fed"}
+	res.Claims["idp"] = p.name
+	return res, nil
+}
+
+func (p *socialProvider) exchange(ctx context.Context, code, verifier string) (*tokenResponse, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"client_id":     {p.cfg.ClientID},
+		"client_secret": {p.cfg.ClientSecret},
+	}
+	if verifier != "" {
+		form.Set("code_verifier", verifier)
+	}
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, p.cfg.TokenURL, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json") // GitHub answers form-encoded otherwise
+
+	var out tokenResponse
+	if err := p.do(req, &out); err != nil {
+		return nil, fmt.Errorf("%s token: %w", p.name, err)
+	}
+	if out.Error != "" {
+		return nil, fmt.Errorf("%s token: %s: %s", p.name, out.Error, out.ErrorDesc)
+	}
+	if out.AccessToken == "" {
+		return nil, fmt.Errorf("%s token: no access_token", p.name)
+	}
+	return &out, nil
+}
+
+// getJSON calls an upstream API with the user's access token.
+func (p *socialProvider) getJSON(ctx context.Context, u string, tok *tokenResponse, out any) error {
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	req.Header.Set("Authorization", "Bearer "+tok.AccessToken)
+	req.Header.Set("Accept", "application/json")
+	return p.do(req, out)
+}
+
+func (p *socialProvider) do(req *http.Request, out any) error {
+	res, err := p.hc.Do(req)
+	if err != nil {
+		return Unavailable(err)
+	}
+	defer func(Body io.ReadCloser) {
+		_ = Body.Close()
+	}(res.Body)
+
+	b, _ := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if res.StatusCode >= 500 {
+		return Unavailable(fmt.Errorf("%s %s", req.URL.Path, res.Status))
+	}
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("%s %s: %s", req.URL.Path, res.Status, string(b))
+	}
+	return json.Unmarshal(b, out)
+}
+
+// idTokenClaims reads the payload of an ID token received directly from
+// the token endpoint over TLS (OIDC Core 3.1.3.7 allows skipping the
+// signature check in that case).
+func idTokenClaims(raw string) (map[string]any, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed id_token")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, err
+	}
+	var claims map[string]any
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func orDefault(v, def string) string {
+	if v == "" {
+		return def
+	}
+	return v
+}
@@ -0,0 +1,74 @@
+package plugins
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// NewGitHubPlugin signs users in with GitHub. GitHub is plain OAuth2, so
+// the profile comes from GET /user, and the email from /user/emails when
+// the public profile has none (or an unverified one).
+func NewGitHubPlugin(cfg SocialConfig) AuthPlugin {
+	cfg.AuthURL = orDefault(cfg.AuthURL, "https://github.com/login/oauth/authorize")
+	cfg.TokenURL = orDefault(cfg.TokenURL, "https://github.com/login/oauth/access_token")
+	cfg.UserInfoURL = strings.TrimSuffix(orDefault(cfg.UserInfoURL, "https://api.github.com"), "/")
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"read:user", "user:email"}
+	}
+	p := newSocialProvider("github", "GitHub", cfg)
+	p.profile = p.githubProfile
+	return p
+}
+
+type githubUser struct {
+	ID        int64  `json:"id"`
+	Login     string `json:"login"`
+	Name      string `json:"name"`
+	Email     string `json:"email"`
+	AvatarURL string `json:"avatar_url"`
+}
+
+type githubEmail struct {
+	Email    string `json:"email"`
+	Primary  bool   `json:"primary"`
+	Verified bool   `json:"verified"`
+}
+
+func (p *socialProvider) githubProfile(ctx context.Context, tok *tokenResponse) (*AuthResult, error) {
+	var u githubUser
+	if err := p.getJSON(ctx, p.cfg.UserInfoURL+"/user", tok, &u); err != nil {
+		return nil, fmt.Errorf("github user: %w", err)
+	}
+	if u.ID == 0 {
+		return nil, fmt.Errorf("github user: no id")
+	}
+
+	// The public email is optional and not necessarily verified; the
+	// emails endpoint says which one is primary and verified.
+	email, verified := "", false
+	var emails []githubEmail
+	if err := p.getJSON(ctx, p.cfg.UserInfoURL+"/user/emails", tok, &emails); err == nil {
+		for _, e := range emails {
+			if e.Primary && e.Verified {
+				email, verified = e.Email, true
+				break
+			}
+		}
+	}
+	if email == "" {
+		email = u.Email
+	}
+
+	claims := map[string]interface{}{
+		"preferred_username": u.Login,
+		"name":               orDefault(u.Name, u.Login),
+		"picture":            u.AvatarURL,
+	}
+	if email != "" {
+		claims["email"] = email
+		claims["email_verified"] = verified
+	}
+	return &AuthResult{Subject: "github:" + strconv.FormatInt(u.ID, 10), Claims: claims}, nil
+}
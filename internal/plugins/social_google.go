@@ -0,0 +1,46 @@
+package plugins
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// NewGooglePlugin signs users in with Google (OpenID Connect). When
+// hostedDomain is set only Google Workspace accounts of that domain get in.
+func NewGooglePlugin(cfg SocialConfig, hostedDomain string) AuthPlugin {
+	cfg.AuthURL = orDefault(cfg.AuthURL, "https://accounts.google.com/o/oauth2/v2/auth")
+	cfg.TokenURL = orDefault(cfg.TokenURL, "https://oauth2.googleapis.com/token")
+	cfg.UserInfoURL = orDefault(cfg.UserInfoURL, "https://openidconnect.googleapis.com/v1/userinfo")
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "email", "profile"}
+	}
+	p := newSocialProvider("google", "Google", cfg)
+	if hostedDomain != "" {
+		p.extraAuth = url.Values{"hd": {hostedDomain}} // UI hint only; enforced below
+	}
+	p.profile = func(ctx context.Context, tok *tokenResponse) (*AuthResult, error) {
+		var info map[string]interface{}
+		if err := p.getJSON(ctx, p.cfg.UserInfoURL, tok, &info); err != nil {
+			return nil, fmt.Errorf("google userinfo: %w", err)
+		}
+		sub, _ := info["sub"].(string)
+		if sub == "" {
+			return nil, fmt.Errorf("google userinfo: no sub")
+		}
+		if hostedDomain != "" {
+			if hd, _ := info["hd"].(string); !strings.EqualFold(hd, hostedDomain) {
+				return nil, fmt.Errorf("google: account is not in %s", hostedDomain)
+			}
+		}
+		claims := map[string]interface{}{}
+		for _, k := range []string{"name", "given_name", "family_name", "picture", "email", "email_verified", "locale", "hd"} {
+			if v, ok := info[k]; ok {
+				claims[k] = v
+			}
+		}
+		return &AuthResult{Subject: "google:" + sub, Claims: claims}, nil
+	}
+	return p
+}
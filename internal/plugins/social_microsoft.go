@@ -0,0 +1,56 @@
+package plugins
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// NewMicrosoftPlugin signs users in with Microsoft Entra ID / personal
+// accounts. tenant is "common", "organizations", "consumers" or a tenant
+// id/domain. With a multi-tenant value, allowedTenants (tenant ids) limits
+// which directories may sign in; empty allows any.
+func NewMicrosoftPlugin(cfg SocialConfig, authority, tenant string, allowedTenants []string) AuthPlugin {
+	tenant = orDefault(tenant, "common")
+	base := strings.TrimSuffix(orDefault(authority, "https://login.microsoftonline.com"), "/") + "/" + tenant + "/oauth2/v2.0"
+	cfg.AuthURL = orDefault(cfg.AuthURL, base+"/authorize")
+	cfg.TokenURL = orDefault(cfg.TokenURL, base+"/token")
+	cfg.UserInfoURL = orDefault(cfg.UserInfoURL, "https://graph.microsoft.com/oidc/userinfo")
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "email", "profile"}
+	}
+	p := newSocialProvider("microsoft", "Microsoft", cfg)
+	p.profile = func(ctx context.Context, tok *tokenResponse) (*AuthResult, error) {
+		// tid/oid only come in the ID token, not from userinfo.
+		idc, err := idTokenClaims(tok.IDToken)
+		if err != nil {
+			return nil, fmt.Errorf("microsoft id_token: %w", err)
+		}
+		tid, _ := idc["tid"].(string)
+		oid, _ := idc["oid"].(string)
+		if tid == "" || oid == "" {
+			return nil, fmt.Errorf("microsoft id_token: missing tid/oid")
+		}
+		if len(allowedTenants) > 0 && !slices.Contains(allowedTenants, tid) {
+			return nil, fmt.Errorf("microsoft: tenant %s is not allowed", tid)
+		}
+
+		var info map[string]interface{}
+		if err := p.getJSON(ctx, p.cfg.UserInfoURL, tok, &info); err != nil {
+			return nil, fmt.Errorf("microsoft userinfo: %w", err)
+		}
+		claims := map[string]interface{}{"tid": tid}
+		for _, k := range []string{"name", "given_name", "family_name", "picture", "email"} {
+			if v, ok := info[k]; ok {
+				claims[k] = v
+			}
+		}
+		if v, ok := idc["preferred_username"].(string); ok {
+			claims["preferred_username"] = v
+		}
+		// oid is stable per user within a tenant; sub is pairwise per app.
+		return &AuthResult{Subject: "microsoft:" + tid + ":" + oid, Claims: claims}, nil
+	}
+	return p
+}
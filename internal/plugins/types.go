@@ -5,14 +5,112 @@ import "context"
 type AuthResult struct {
 	Subject string
 	Claims  map[string]interface{}
+	AMR     []string // RFC 8176 authentication method references, e.g. "pwd"
 }
 
 type Credentials struct {
 	Username string
 	Password string
+
+	// Passwordless plugins: the token from the emailed link, and the login
+	// challenge and browser binding it has to have been issued for.
+	Token     string
+	Challenge string
+	Binding   string
+
+	// Redirect plugins: PKCE code_verifier matching the challenge sent with
+	// the authorization request. Token then holds the authorization code.
+	Verifier string
 }
 
 type AuthPlugin interface {
 	Name() string
 	Authenticate(ctx context.Context, cred Credentials) (*AuthResult, error)
 }
+
+// HealthChecker is optional. Plugins backed by a remote service implement it
+// so the bridge readiness probe can report on that dependency.
+type HealthChecker interface {
+	CheckHealth(ctx context.Context) error
+}
+
+// Describer is optional. It gives the provider chooser a human label and an
+// icon (absolute URL or data: URI) instead of the plugin name.
+type Describer interface {
+	DisplayName() string
+	IconURL() string
+}
+
+// TOTPVerifier is optional. Plugins whose backend knows the user's
+// authenticator secret implement it to serve as the second factor.
+type TOTPVerifier interface {
+	VerifyTOTP(ctx context.Context, subject, code string) error
+}
+
+// LinkSender is optional. Passwordless plugins implement it: the login page
+// asks for an email, the plugin mails a one-time link back to the bridge, and
+// the token from that link is passed to Authenticate.
+type LinkSender interface {
+	SendLink(ctx context.Context, req LinkRequest) error
+}
+
+// LinkRequest asks a LinkSender for a sign-in link. CallbackURL already
+// carries the login challenge; the plugin adds its token.
+type LinkRequest struct {
+	Email       string
+	Challenge   string
+	Binding     string // opaque per-browser value; the link only works there
+	CallbackURL string
+}
+
+// Redirector is optional. Plugins that sign in at an upstream OAuth2/OIDC
+// provider implement it: the bridge sends the browser to AuthCodeURL and
+// passes the returned authorization code to Authenticate.
+type Redirector interface {
+	AuthCodeURL(state, codeChallenge string) string
+}
+
+// PasswordChanger is optional. Plugins whose backend can set a new password
+// implement it, so users whose password has expired can pick a new one in
+// the login flow. Wrong current passwords are ErrInvalidCredentials; a new
+// password the backend refuses is ErrPasswordRejected.
+type PasswordChanger interface {
+	ChangePassword(ctx context.Context, req PasswordChange) error
+}
+
+type PasswordChange struct {
+	Username    string
+	OldPassword string
+	NewPassword string
+}
+
+// PasswordResetter is optional. Plugins whose backend can find an account
+// by email and set its password without the old one implement it for the
+// forgot-password flow. Unknown addresses are ErrInvalidCredentials.
+type PasswordResetter interface {
+	FindAccount(ctx context.Context, email string) (*Account, error)
+	ResetPassword(ctx context.Context, accountID, newPassword string) error
+}
+
+// Account identifies a user for a password reset.
+type Account struct {
+	ID       string
+	Username string // what the user signs in with afterwards
+	Email    string
+}
+
+// Registrar is optional. Plugins whose backend can create accounts
+// implement it for the sign-up form. The bridge has already checked the
+// form against its schema and verified the email address. An address that
+// is taken is ErrAccountExists.
+type Registrar interface {
+	Register(ctx context.Context, reg Registration) (*AuthResult, error)
+}
+
+// Registration is a validated sign-up form.
+type Registration struct {
+	Email    string
+	Name     string // the "name" field, when the schema has one
+	Password string
+	Fields   map[string]string // every other field by name; checkboxes are "true" or ""
+}
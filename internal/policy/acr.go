@@ -0,0 +1,39 @@
+package policy
+
+import "slices"
+
+// Authentication context class references the bridge asserts in the "acr"
+// claim, weakest first. Clients ask for them with acr_values.
+const (
+	ACRPassword = "urn:tripzy:acr:pwd" // one factor
+	ACRMFA      = "urn:tripzy:acr:mfa" // a second factor was verified
+)
+
+var acrLevels = []string{ACRPassword, ACRMFA}
+
+// ACRFor derives the achieved acr from the authentication methods.
+func ACRFor(amr []string) string {
+	if HasMFA(amr) {
+		return ACRMFA
+	}
+	return ACRPassword
+}
+
+// ACRSatisfied reports whether have meets any of the requested values.
+// Values we don't know are ignored; acr_values is a voluntary claim, so an
+// all-unknown request is treated as satisfied.
+func ACRSatisfied(have string, requested []string) bool {
+	level := slices.Index(acrLevels, have)
+	known := false
+	for _, want := range requested {
+		i := slices.Index(acrLevels, want)
+		if i < 0 {
+			continue
+		}
+		known = true
+		if level >= i {
+			return true
+		}
+	}
+	return !known
+}
@@ -0,0 +1,45 @@
+package policy
+
+import "testing"
+
+func TestACRSatisfied(t *testing.T) {
+	tests := []struct {
+		name      string
+		have      string
+		requested []string
+		want      bool
+	}{
+		{name: "nothing requested", have: ACRPassword, want: true},
+		{name: "password meets password", have: ACRPassword, requested: []string{ACRPassword}, want: true},
+		{name: "password short of mfa", have: ACRPassword, requested: []string{ACRMFA}},
+		{name: "mfa meets password", have: ACRMFA, requested: []string{ACRPassword}, want: true},
+		{name: "mfa meets mfa", have: ACRMFA, requested: []string{ACRMFA}, want: true},
+		{name: "any of the values", have: ACRPassword, requested: []string{ACRMFA, ACRPassword}, want: true},
+		{name: "unknown only", have: ACRPassword, requested: []string{"urn:other:loa:3"}, want: true},
+		{name: "unknown ignored", have: ACRPassword, requested: []string{"urn:other:loa:3", ACRMFA}},
+		{name: "unknown have", have: "urn:other:loa:3", requested: []string{ACRPassword}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ACRSatisfied(tt.have, tt.requested); got != tt.want {
+				t.Errorf("ACRSatisfied(%q, %q) = %v, want %v", tt.have, tt.requested, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestACRFor(t *testing.T) {
+	tests := []struct {
+		amr  []string
+		want string
+	}{
+		{amr: nil, want: ACRPassword},
+		{amr: []string{"pwd"}, want: ACRPassword},
+		{amr: []string{"pwd", "otp", "mfa"}, want: ACRMFA},
+	}
+	for _, tt := range tests {
+		if got := ACRFor(tt.amr); got != tt.want {
+			t.Errorf("ACRFor(%q) = %q, want %q", tt.amr, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// MetadataKey on a Hydra client's metadata selects a policy by name, so
+// clients can be grouped without listing every client_id in the file.
+const MetadataKey = "bridge_policy"
+
+// Policy is the per-client authentication policy.
+type Policy struct {
+	Name    string   `json:"name"`
+	Clients []string `json:"clients,omitempty"`
+
+	RequireMFA           bool     `json:"require_mfa,omitempty"`
+	AllowedProviders     []string `json:"allowed_providers,omitempty"`       // empty = any
+	MaxSessionAgeSeconds int      `json:"max_session_age_seconds,omitempty"` // 0 = bridge session TTL
+	RequiredGroups       []string `json:"required_groups,omitempty"`         // all must be present
+	GroupsClaim          string   `json:"groups_claim,omitempty"`            // default "groups"
+
+	Deny            bool   `json:"deny,omitempty"`
+	DenyError       string `json:"deny_error,omitempty"` // OAuth2 error code, default access_denied
+	DenyDescription string `json:"deny_description,omitempty"`
+}
+
+type file struct {
+	Default  Policy   `json:"default"`
+	Policies []Policy `json:"policies"`
+}
+
+// Engine resolves the policy for a client.
+type Engine struct {
+	def      Policy
+	byClient map[string]Policy
+	byName   map[string]Policy
+}
+
+// Load reads a JSON policy file. An empty path yields a permissive engine.
+func Load(path string) (*Engine, error) {
+	e := &Engine{byClient: map[string]Policy{}, byName: map[string]Policy{}}
+	if path == "" {
+		return e, nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f file
+	if err := json.Unmarshal(b, &f); err != nil {
+		return nil, fmt.Errorf("policy file %s: %w", path, err)
+	}
+	e.def = f.Default
+	for _, p := range f.Policies {
+		if p.Name != "" {
+			e.byName[p.Name] = p
+		}
+		for _, id := range p.Clients {
+			if _, dup := e.byClient[id]; dup {
+				return nil, fmt.Errorf("policy file %s: client %q listed in more than one policy", path, id)
+			}
+			e.byClient[id] = p
+		}
+	}
+	return e, nil
+}
+
+// For picks the client's policy: explicit client_id, then the
+// bridge_policy metadata value, then the default.
+func (e *Engine) For(clientID string, metadata map[string]any) Policy {
+	if p, ok := e.byClient[clientID]; ok {
+		return p
+	}
+	if name, ok := metadata[MetadataKey].(string); ok {
+		if p, ok := e.byName[name]; ok {
+			return p
+		}
+	}
+	return e.def
+}
+
+// ProviderAllowed reports whether the policy lets the client use provider.
+func (p Policy) ProviderAllowed(provider string) bool {
+	return len(p.AllowedProviders) == 0 || slices.Contains(p.AllowedProviders, provider)
+}
+
+// SessionUsable reports whether an SSO session issued at iat may be reused.
+func (p Policy) SessionUsable(iat int64, now time.Time) bool {
+	if p.MaxSessionAgeSeconds <= 0 {
+		return true
+	}
+	return now.Unix()-iat <= int64(p.MaxSessionAgeSeconds)
+}
+
+// Input is what the bridge knows about the user at decision time.
+type Input struct {
+	Provider  string
+	Claims    map[string]any
+	AMR       []string
+	ACRValues []string // requested by the client for this login
+}
+
+// Decision is the outcome of Evaluate. When Allowed is false, Error and
+// Description form the OAuth2 error sent back to the client.
+type Decision struct {
+	Allowed     bool
+	NeedMFA     bool
+	Error       string
+	Description string
+}
+
+func deny(code, desc string) Decision {
+	if code == "" {
+		code = "access_denied"
+	}
+	return Decision{Error: code, Description: desc}
+}
+
+// HasMFA reports whether the authentication methods include a second factor.
+func HasMFA(amr []string) bool {
+	return slices.Contains(amr, "mfa")
+}
+
+func (p Policy) Evaluate(in Input) Decision {
+	if p.Deny {
+		desc := p.DenyDescription
+		if desc == "" {
+			desc = "Access to this application is not permitted."
+		}
+		return deny(p.DenyError, desc)
+	}
+	if !p.ProviderAllowed(in.Provider) {
+		return deny("access_denied", "This application does not accept the selected sign-in method.")
+	}
+	if len(p.RequiredGroups) > 0 {
+		have := groups(in.Claims, p.GroupsClaim)
+		for _, g := range p.RequiredGroups {
+			if !slices.Contains(have, g) {
+				return deny("access_denied", "Your account is not authorized to use this application.")
+			}
+		}
+	}
+	stepUp := !ACRSatisfied(ACRFor(in.AMR), in.ACRValues)
+	return Decision{Allowed: true, NeedMFA: (p.RequireMFA || stepUp) && !HasMFA(in.AMR)}
+}
+
+// groups reads a list claim that may be a JSON array or a space/comma
+// separated string, depending on the backend.
+func groups(claims map[string]any, claim string) []string {
+	if claim == "" {
+		claim = "groups"
+	}
+	switch v := claims[claim].(type) {
+	case []any:
+		out := make([]string, 0, len(v))
+		for _, g := range v {
+			if s, ok := g.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	case []string:
+		return v
+	case string:
+		return strings.FieldsFunc(v, func(r rune) bool { return r == ',' || r == ' ' })
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package policy
+
+import "testing"
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy Policy
+		in     Input
+		want   Decision
+	}{
+		{
+			name: "permissive",
+			in:   Input{Provider: "internal", AMR: []string{"pwd"}},
+			want: Decision{Allowed: true},
+		},
+		{
+			name:   "deny with defaults",
+			policy: Policy{Deny: true},
+			want:   Decision{Error: "access_denied", Description: "Access to this application is not permitted."},
+		},
+		{
+			name:   "deny with custom error",
+			policy: Policy{Deny: true, DenyError: "unauthorized_client", DenyDescription: "Closed."},
+			want:   Decision{Error: "unauthorized_client", Description: "Closed."},
+		},
+		{
+			name:   "provider not allowed",
+			policy: Policy{AllowedProviders: []string{"google"}},
+			in:     Input{Provider: "internal"},
+			want:   Decision{Error: "access_denied", Description: "This application does not accept the selected sign-in method."},
+		},
+		{
+			name:   "provider allowed",
+			policy: Policy{AllowedProviders: []string{"google", "internal"}},
+			in:     Input{Provider: "internal"},
+			want:   Decision{Allowed: true},
+		},
+		{
+			name:   "groups from array",
+			policy: Policy{RequiredGroups: []string{"staff", "ops"}},
+			in:     Input{Claims: map[string]any{"groups": []any{"ops", "staff", "x"}}},
+			want:   Decision{Allowed: true},
+		},
+		{
+			name:   "groups from string in custom claim",
+			policy: Policy{RequiredGroups: []string{"staff"}, GroupsClaim: "roles"},
+			in:     Input{Claims: map[string]any{"roles": "ops, staff"}},
+			want:   Decision{Allowed: true},
+		},
+		{
+			name:   "missing group",
+			policy: Policy{RequiredGroups: []string{"staff", "ops"}},
+			in:     Input{Claims: map[string]any{"groups": []string{"staff"}}},
+			want:   Decision{Error: "access_denied", Description: "Your account is not authorized to use this application."},
+		},
+		{
+			name:   "mfa required",
+			policy: Policy{RequireMFA: true},
+			in:     Input{AMR: []string{"pwd"}},
+			want:   Decision{Allowed: true, NeedMFA: true},
+		},
+		{
+			name:   "mfa required and done",
+			policy: Policy{RequireMFA: true},
+			in:     Input{AMR: []string{"pwd", "otp", "mfa"}},
+			want:   Decision{Allowed: true},
+		},
+		{
+			name: "acr step-up",
+			in:   Input{AMR: []string{"pwd"}, ACRValues: []string{ACRMFA}},
+			want: Decision{Allowed: true, NeedMFA: true},
+		},
+		{
+			name: "acr already met",
+			in:   Input{AMR: []string{"pwd", "mfa"}, ACRValues: []string{ACRMFA}},
+			want: Decision{Allowed: true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.Evaluate(tt.in); got != tt.want {
+				t.Errorf("Evaluate = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,215 @@
+// Package registration describes the sign-up form: which fields it asks
+// for and how each one is checked. The schema is loaded from a JSON file;
+// without one the form asks for email, name and password.
+package registration
+
+import (
+	"encoding/json"
+	"fmt"
+	netmail "net/mail"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// Type is how a field is entered and checked.
+type Type string
+
+const (
+	Text     Type = "text"
+	Email    Type = "email"
+	Password Type = "password"
+	Select   Type = "select"
+	Checkbox Type = "checkbox"
+)
+
+// Field is one input of the sign-up form.
+type Field struct {
+	Name         string   `json:"name"`
+	Label        string   `json:"label"`
+	Type         Type     `json:"type"`
+	Required     bool     `json:"required,omitempty"`
+	MinLength    int      `json:"min_length,omitempty"`
+	MaxLength    int      `json:"max_length,omitempty"` // default 200; password length comes from the password policy
+	Pattern      string   `json:"pattern,omitempty"`    // RE2, must match the whole value
+	PatternHint  string   `json:"pattern_hint,omitempty"`
+	Options      []string `json:"options,omitempty"` // select only
+	Placeholder  string   `json:"placeholder,omitempty"`
+	Autocomplete string   `json:"autocomplete,omitempty"`
+
+	re *regexp.Regexp
+}
+
+// Schema is the ordered list of fields. It always has exactly one email
+// field named "email" and one password field named "password".
+type Schema struct {
+	Fields []Field `json:"fields"`
+}
+
+// Default is the schema used when no file is configured.
+func Default() *Schema {
+	s := &Schema{Fields: []Field{
+		{Name: "email", Label: "Email", Type: Email, Required: true, Autocomplete: "email", Placeholder: "you@example.com"},
+		{Name: "name", Label: "Full name", Type: Text, Required: true, MaxLength: 100, Autocomplete: "name"},
+		{Name: "password", Label: "Password", Type: Password, Required: true, Autocomplete: "new-password"},
+	}}
+	if err := s.compile(); err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// Load reads a schema file. An empty path gives the default schema.
+func Load(path string) (*Schema, error) {
+	if path == "" {
+		return Default(), nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var s Schema
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, fmt.Errorf("registration schema %s: %w", path, err)
+	}
+	if err := s.compile(); err != nil {
+		return nil, fmt.Errorf("registration schema %s: %w", path, err)
+	}
+	return &s, nil
+}
+
+var fieldName = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+func (s *Schema) compile() error {
+	seen := map[string]bool{}
+	for i := range s.Fields {
+		f := &s.Fields[i]
+		if !fieldName.MatchString(f.Name) {
+			return fmt.Errorf("field %q: name must be lower case letters, digits and _", f.Name)
+		}
+		if seen[f.Name] {
+			return fmt.Errorf("field %q: defined twice", f.Name)
+		}
+		seen[f.Name] = true
+		if f.Type == "" {
+			f.Type = Text
+		}
+		switch f.Type {
+		case Text, Checkbox:
+		case Email:
+			if f.Name != "email" {
+				return fmt.Errorf("field %q: the email field must be named email", f.Name)
+			}
+		case Password:
+			if f.Name != "password" {
+				return fmt.Errorf("field %q: the password field must be named password", f.Name)
+			}
+		case Select:
+			if len(f.Options) == 0 {
+				return fmt.Errorf("field %q: select needs options", f.Name)
+			}
+		default:
+			return fmt.Errorf("field %q: unknown type %q", f.Name, f.Type)
+		}
+		if f.Label == "" {
+			f.Label = f.Name
+		}
+		if f.MaxLength <= 0 {
+			f.MaxLength = 200
+		}
+		if f.Pattern != "" {
+			re, err := regexp.Compile(`^(?:` + f.Pattern + `)$`)
+			if err != nil {
+				return fmt.Errorf("field %q: pattern: %w", f.Name, err)
+			}
+			f.re = re
+		}
+	}
+	if e, ok := s.Field("email"); !ok || e.Type != Email {
+		return fmt.Errorf("an email field named email is required")
+	}
+	if p, ok := s.Field("password"); !ok || p.Type != Password {
+		return fmt.Errorf("a password field named password is required")
+	}
+	return nil
+}
+
+// Field returns the named field.
+func (s *Schema) Field(name string) (Field, bool) {
+	for _, f := range s.Fields {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return Field{}, false
+}
+
+// Check validates one value and returns a message for the user, or "".
+// Passwords are only checked for presence here; the bridge's password
+// policy applies on top.
+func (f Field) Check(v string) string {
+	if v == "" {
+		if f.Required {
+			if f.Type == Checkbox {
+				return f.Label + " must be accepted."
+			}
+			return f.Label + " is required."
+		}
+		return ""
+	}
+	switch f.Type {
+	case Email:
+		if a, err := netmail.ParseAddress(v); err != nil || a.Address != v {
+			return "Please enter a valid email address."
+		}
+	case Select:
+		if !slices.Contains(f.Options, v) {
+			return "Choose one of the options for " + f.Label + "."
+		}
+		return ""
+	case Checkbox:
+		return ""
+	case Password:
+		return ""
+	}
+	n := utf8.RuneCountInString(v)
+	if n < f.MinLength {
+		return fmt.Sprintf("%s must be at least %d characters.", f.Label, f.MinLength)
+	}
+	if n > f.MaxLength {
+		return fmt.Sprintf("%s must be at most %d characters.", f.Label, f.MaxLength)
+	}
+	if f.re != nil && !f.re.MatchString(v) {
+		if f.PatternHint != "" {
+			return f.PatternHint
+		}
+		return f.Label + " is not in the expected format."
+	}
+	return ""
+}
+
+// Validate checks every field. get returns the submitted value for a name;
+// text values are trimmed, passwords are not. It returns the cleaned
+// values and the problems by field name.
+func (s *Schema) Validate(get func(name string) string) (values, problems map[string]string) {
+	values, problems = map[string]string{}, map[string]string{}
+	for _, f := range s.Fields {
+		v := get(f.Name)
+		switch f.Type {
+		case Password:
+		case Checkbox:
+			if v != "" {
+				v = "true"
+			}
+		default:
+			v = strings.TrimSpace(v)
+		}
+		if msg := f.Check(v); msg != "" {
+			problems[f.Name] = msg
+		}
+		values[f.Name] = v
+	}
+	return values, problems
+}
@@ -0,0 +1,156 @@
+package registration
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func loadSchema(t *testing.T, body string) (*Schema, error) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "schema.json")
+	if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return Load(path)
+}
+
+const testSchema = `{"fields": [
+	{"name": "email", "type": "email", "label": "Email", "required": true},
+	{"name": "password", "type": "password", "label": "Password", "required": true},
+	{"name": "name", "label": "Name", "required": true, "min_length": 2, "max_length": 5},
+	{"name": "code", "label": "Code", "pattern": "[A-Z]{3}", "pattern_hint": "Three capital letters."},
+	{"name": "plain", "label": "Plain", "pattern": "[0-9]+"},
+	{"name": "country", "type": "select", "label": "Country", "options": ["VN", "SG"]},
+	{"name": "terms", "type": "checkbox", "label": "The terms", "required": true}
+]}`
+
+func TestValidate(t *testing.T) {
+	s, err := loadSchema(t, testSchema)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	valid := map[string]string{
+		"email": "a@example.com", "password": " secret ", "name": "Ann",
+		"code": "ABC", "plain": "12", "country": "VN", "terms": "on",
+	}
+
+	tests := []struct {
+		name       string
+		change     map[string]string // applied on top of valid
+		wantValues map[string]string // checked when set
+		want       map[string]string // problems
+	}{
+		{
+			name:       "valid",
+			wantValues: map[string]string{"password": " secret ", "terms": "true"},
+			want:       map[string]string{},
+		},
+		{
+			name:       "text trimmed",
+			change:     map[string]string{"name": "  Ann  ", "email": " a@example.com "},
+			wantValues: map[string]string{"name": "Ann", "email": "a@example.com"},
+			want:       map[string]string{},
+		},
+		{
+			name:   "required missing",
+			change: map[string]string{"email": "", "password": "", "name": "   ", "terms": ""},
+			want: map[string]string{
+				"email":    "Email is required.",
+				"password": "Password is required.",
+				"name":     "Name is required.",
+				"terms":    "The terms must be accepted.",
+			},
+		},
+		{
+			name:   "optional empty",
+			change: map[string]string{"code": "", "plain": "", "country": ""},
+			want:   map[string]string{},
+		},
+		{
+			name:   "bad email",
+			change: map[string]string{"email": "Ann <a@example.com>"},
+			want:   map[string]string{"email": "Please enter a valid email address."},
+		},
+		{
+			name:   "length counted in runes",
+			change: map[string]string{"name": "Nguyễn"},
+			want:   map[string]string{"name": "Name must be at most 5 characters."},
+		},
+		{
+			name:   "too short",
+			change: map[string]string{"name": "A"},
+			want:   map[string]string{"name": "Name must be at least 2 characters."},
+		},
+		{
+			name:   "pattern with hint",
+			change: map[string]string{"code": "ABCD"},
+			want:   map[string]string{"code": "Three capital letters."},
+		},
+		{
+			name:   "pattern anchored",
+			change: map[string]string{"plain": "12a"},
+			want:   map[string]string{"plain": "Plain is not in the expected format."},
+		},
+		{
+			name:   "unknown option",
+			change: map[string]string{"country": "US"},
+			want:   map[string]string{"country": "Choose one of the options for Country."},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := map[string]string{}
+			for k, v := range valid {
+				form[k] = v
+			}
+			for k, v := range tt.change {
+				form[k] = v
+			}
+			values, problems := s.Validate(func(name string) string { return form[name] })
+			if !reflect.DeepEqual(problems, tt.want) {
+				t.Errorf("problems = %v, want %v", problems, tt.want)
+			}
+			for k, want := range tt.wantValues {
+				if values[k] != want {
+					t.Errorf("values[%q] = %q, want %q", k, values[k], want)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{name: "no email", body: `{"fields": [{"name": "password", "type": "password"}]}`,
+			want: "an email field named email is required"},
+		{name: "no password", body: `{"fields": [{"name": "email", "type": "email"}]}`,
+			want: "a password field named password is required"},
+		{name: "bad name", body: `{"fields": [{"name": "Email", "type": "email"}]}`,
+			want: "name must be lower case"},
+		{name: "duplicate", body: `{"fields": [{"name": "a"}, {"name": "a"}]}`,
+			want: "defined twice"},
+		{name: "renamed email", body: `{"fields": [{"name": "mail", "type": "email"}]}`,
+			want: "must be named email"},
+		{name: "select without options", body: `{"fields": [{"name": "c", "type": "select"}]}`,
+			want: "select needs options"},
+		{name: "unknown type", body: `{"fields": [{"name": "c", "type": "date"}]}`,
+			want: "unknown type"},
+		{name: "bad pattern", body: `{"fields": [{"name": "c", "pattern": "("}]}`,
+			want: "pattern"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadSchema(t, tt.body)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Load error = %v, want it to mention %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+// Package reset issues single-use password-reset tokens. Only a SHA-256 of
+// each token is kept, so a dump of the store can't be used to reset
+// anything. The store is per process, like the OTP store.
+package reset
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrThrottled = errors.New("reset: requested too soon")
+	ErrInvalid   = errors.New("reset: token is invalid, expired or already used")
+)
+
+// Ticket is what a token stands for.
+type Ticket struct {
+	Provider  string
+	AccountID string
+	Username  string // signs in with the new password
+	Email     string
+	Challenge string // login challenge to resume afterwards, if any
+	Binding   string // browser that asked; only there is the login resumed
+	Exp       time.Time
+}
+
+type Config struct {
+	TTL    time.Duration // default 30 minutes
+	Resend time.Duration // minimum gap between requests for one address; default 1 minute
+}
+
+type Service struct {
+	cfg Config
+
+	mu       sync.Mutex
+	tickets  map[string]*Ticket   // token hash -> ticket
+	lastSent map[string]time.Time // address -> last request
+}
+
+func New(cfg Config) *Service {
+	if cfg.TTL <= 0 {
+		cfg.TTL = 30 * time.Minute
+	}
+	if cfg.Resend <= 0 {
+		cfg.Resend = time.Minute
+	}
+	return &Service{cfg: cfg, tickets: map[string]*Ticket{}, lastSent: map[string]time.Time{}}
+}
+
+// TTL is how long issued tokens stay valid.
+func (s *Service) TTL() time.Duration { return s.cfg.TTL }
+
+// Allow records a request for email and reports whether it may go ahead.
+// Callers check it before looking the address up, so unknown addresses
+// are throttled the same way as known ones.
+func (s *Service) Allow(email string) error {
+	key := strings.ToLower(strings.TrimSpace(email))
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prune(now)
+	if last, ok := s.lastSent[key]; ok && now.Sub(last) < s.cfg.Resend {
+		return ErrThrottled
+	}
+	s.lastSent[key] = now
+	return nil
+}
+
+// Issue creates a token for t. Earlier tokens for the same account stop
+// working, so only the newest email is usable.
+func (s *Service) Issue(t Ticket) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	t.Exp = time.Now().Add(s.cfg.TTL)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for h, o := range s.tickets {
+		if o.Provider == t.Provider && o.AccountID == t.AccountID {
+			delete(s.tickets, h)
+		}
+	}
+	s.tickets[hash(token)] = &t
+	return token, nil
+}
+
+// Check returns the ticket for a live token without using it up.
+func (s *Service) Check(token string) (*Ticket, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.tickets[hash(token)]
+	if !ok || time.Now().After(t.Exp) {
+		return nil, ErrInvalid
+	}
+	cp := *t
+	return &cp, nil
+}
+
+// Consume uses the token up and returns its ticket. Only one caller can
+// consume a token.
+func (s *Service) Consume(token string) (*Ticket, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	h := hash(token)
+	t, ok := s.tickets[h]
+	delete(s.tickets, h)
+	if !ok || time.Now().After(t.Exp) {
+		return nil, ErrInvalid
+	}
+	return t, nil
+}
+
+// Restore puts a consumed ticket back, for when the backend failed to set
+// the password and the user should be able to retry with the same link.
+func (s *Service) Restore(token string, t *Ticket) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if time.Now().Before(t.Exp) {
+		s.tickets[hash(token)] = t
+	}
+}
+
+// prune drops expired entries. Callers hold mu.
+func (s *Service) prune(now time.Time) {
+	for h, t := range s.tickets {
+		if now.After(t.Exp) {
+			delete(s.tickets, h)
+		}
+	}
+	for k, at := range s.lastSent {
+		if now.Sub(at) > s.cfg.Resend {
+			delete(s.lastSent, k)
+		}
+	}
+}
+
+func hash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,141 @@
+package reset
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestConsumeRestore(t *testing.T) {
+	ticket := Ticket{Provider: "internal", AccountID: "u1", Username: "alice", Email: "a@example.com"}
+
+	tests := []struct {
+		name string
+		// run gets a fresh service and a token issued for ticket, and
+		// returns the token to finally consume.
+		run     func(t *testing.T, s *Service, token string) string
+		wantErr error
+	}{
+		{
+			name: "fresh",
+			run:  func(_ *testing.T, _ *Service, token string) string { return token },
+		},
+		{
+			name:    "unknown",
+			run:     func(*testing.T, *Service, string) string { return "not-a-token" },
+			wantErr: ErrInvalid,
+		},
+		{
+			name: "single use",
+			run: func(t *testing.T, s *Service, token string) string {
+				if _, err := s.Consume(token); err != nil {
+					t.Fatalf("first Consume: %v", err)
+				}
+				return token
+			},
+			wantErr: ErrInvalid,
+		},
+		{
+			name: "check leaves it usable",
+			run: func(t *testing.T, s *Service, token string) string {
+				if _, err := s.Check(token); err != nil {
+					t.Fatalf("Check: %v", err)
+				}
+				return token
+			},
+		},
+		{
+			name: "restored after failure",
+			run: func(t *testing.T, s *Service, token string) string {
+				got, err := s.Consume(token)
+				if err != nil {
+					t.Fatalf("first Consume: %v", err)
+				}
+				s.Restore(token, got)
+				return token
+			},
+		},
+		{
+			name: "expired not restored",
+			run: func(t *testing.T, s *Service, token string) string {
+				got, err := s.Consume(token)
+				if err != nil {
+					t.Fatalf("first Consume: %v", err)
+				}
+				got.Exp = time.Now().Add(-time.Second)
+				s.Restore(token, got)
+				return token
+			},
+			wantErr: ErrInvalid,
+		},
+		{
+			name: "superseded by a newer token",
+			run: func(t *testing.T, s *Service, token string) string {
+				if _, err := s.Issue(ticket); err != nil {
+					t.Fatalf("second Issue: %v", err)
+				}
+				return token
+			},
+			wantErr: ErrInvalid,
+		},
+		{
+			name: "other account keeps its token",
+			run: func(t *testing.T, s *Service, token string) string {
+				other := ticket
+				other.AccountID = "u2"
+				if _, err := s.Issue(other); err != nil {
+					t.Fatalf("second Issue: %v", err)
+				}
+				return token
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New(Config{})
+			token, err := s.Issue(ticket)
+			if err != nil {
+				t.Fatalf("Issue: %v", err)
+			}
+			got, err := s.Consume(tt.run(t, s, token))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Consume error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && (got.AccountID != ticket.AccountID || got.Username != ticket.Username) {
+				t.Errorf("Consume = %+v, want account %s", got, ticket.AccountID)
+			}
+		})
+	}
+}
+
+func TestExpiredToken(t *testing.T) {
+	s := New(Config{TTL: time.Millisecond})
+	token, err := s.Issue(Ticket{Provider: "internal", AccountID: "u1"})
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if _, err := s.Check(token); !errors.Is(err, ErrInvalid) {
+		t.Errorf("Check = %v, want ErrInvalid", err)
+	}
+	if _, err := s.Consume(token); !errors.Is(err, ErrInvalid) {
+		t.Errorf("Consume = %v, want ErrInvalid", err)
+	}
+}
+
+func TestAllow(t *testing.T) {
+	s := New(Config{})
+	tests := []struct {
+		email string
+		want  error
+	}{
+		{email: "a@example.com"},
+		{email: " A@Example.com ", want: ErrThrottled},
+		{email: "b@example.com"},
+	}
+	for _, tt := range tests {
+		if err := s.Allow(tt.email); !errors.Is(err, tt.want) {
+			t.Errorf("Allow(%q) = %v, want %v", tt.email, err, tt.want)
+		}
+	}
+}
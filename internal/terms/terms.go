@@ -0,0 +1,179 @@
+// Package terms tracks which versions of the legal documents (terms of
+// service, privacy policy, client-specific terms) each subject accepted.
+// The bridge asks for acceptance whenever a document's version changes.
+package terms
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Document is one versioned legal text the user must agree to.
+type Document struct {
+	ID      string   `json:"id"`      // stable key, e.g. "tos" or "acme-tos"
+	Title   string   `json:"title"`   // shown next to the link
+	Version string   `json:"version"` // any change asks everyone again
+	URL     string   `json:"url"`
+	Clients []string `json:"clients,omitempty"` // empty = every client
+}
+
+// Set is the configured documents.
+type Set struct {
+	Documents []Document `json:"documents"`
+}
+
+// Load reads the documents file. An empty path means no terms gate.
+func Load(path string) (*Set, error) {
+	if path == "" {
+		return nil, nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var s Set
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, fmt.Errorf("terms %s: %w", path, err)
+	}
+	seen := map[string]bool{}
+	for _, d := range s.Documents {
+		switch {
+		case d.ID == "" || d.Version == "" || d.URL == "":
+			return nil, fmt.Errorf("terms %s: every document needs id, version and url", path)
+		case seen[d.ID]:
+			return nil, fmt.Errorf("terms %s: document %q defined twice", path, d.ID)
+		}
+		seen[d.ID] = true
+	}
+	return &s, nil
+}
+
+// For returns the documents that apply to a client.
+func (s *Set) For(clientID string) []Document {
+	if s == nil {
+		return nil
+	}
+	var out []Document
+	for _, d := range s.Documents {
+		if len(d.Clients) == 0 || slices.Contains(d.Clients, clientID) {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+// Acceptance is a subject agreeing to one version of a document.
+type Acceptance struct {
+	Subject    string    `json:"sub"`
+	Document   string    `json:"document"`
+	Version    string    `json:"version"`
+	ClientID   string    `json:"client_id,omitempty"` // client the user was signing in to
+	AcceptedAt time.Time `json:"accepted_at"`
+}
+
+// Store keeps the latest acceptance per subject and document.
+type Store interface {
+	Accepted(ctx context.Context, sub, document string) (version string, ok bool, err error)
+	Accept(ctx context.Context, a Acceptance) error
+}
+
+// Pending returns the documents sub has not accepted in their current
+// version, and whether any of them was accepted in an older one.
+func Pending(ctx context.Context, st Store, docs []Document, sub string) (pending []Document, updated bool, err error) {
+	for _, d := range docs {
+		v, ok, err := st.Accepted(ctx, sub, d.ID)
+		if err != nil {
+			return nil, false, err
+		}
+		if ok && v == d.Version {
+			continue
+		}
+		pending = append(pending, d)
+		updated = updated || ok
+	}
+	return pending, updated, nil
+}
+
+// MemoryStore keeps acceptances in memory; they are lost on restart. With a
+// path set (see NewFileStore) every change is written to a JSON file.
+type MemoryStore struct {
+	mu   sync.Mutex
+	acc  []Acceptance
+	path string
+}
+
+func NewMemoryStore() *MemoryStore { return &MemoryStore{} }
+
+// NewFileStore loads acceptances from path (a missing file is an empty
+// store) and persists every change there.
+func NewFileStore(path string) (*MemoryStore, error) {
+	s := &MemoryStore{path: path}
+	b, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return s, nil
+	case err != nil:
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &s.acc); err != nil {
+		return nil, fmt.Errorf("terms store %s: %w", path, err)
+	}
+	return s, nil
+}
+
+func (s *MemoryStore) Accepted(_ context.Context, sub, document string) (string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, a := range s.acc {
+		if a.Subject == sub && a.Document == document {
+			return a.Version, true, nil
+		}
+	}
+	return "", false, nil
+}
+
+func (s *MemoryStore) Accept(_ context.Context, a Acceptance) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if a.AcceptedAt.IsZero() {
+		a.AcceptedAt = time.Now().UTC()
+	}
+	i := slices.IndexFunc(s.acc, func(o Acceptance) bool { return o.Subject == a.Subject && o.Document == a.Document })
+	if i >= 0 {
+		s.acc[i] = a
+	} else {
+		s.acc = append(s.acc, a)
+	}
+	return s.save()
+}
+
+// save writes the file atomically. Callers hold mu.
+func (s *MemoryStore) save() error {
+	if s.path == "" {
+		return nil
+	}
+	b, err := json.MarshalIndent(s.acc, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".terms-*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	if _, err := tmp.Write(b); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
@@ -0,0 +1,92 @@
+package terms
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type failingStore struct{ *MemoryStore }
+
+var errStore = errors.New("store down")
+
+func (*failingStore) Accepted(context.Context, string, string) (string, bool, error) {
+	return "", false, errStore
+}
+
+func TestPending(t *testing.T) {
+	ctx := context.Background()
+	tos := Document{ID: "tos", Version: "2", URL: "https://example.com/tos"}
+	privacy := Document{ID: "privacy", Version: "1", URL: "https://example.com/privacy"}
+	docs := []Document{tos, privacy}
+
+	st := NewMemoryStore()
+	for _, a := range []Acceptance{
+		{Subject: "current", Document: "tos", Version: "2"},
+		{Subject: "current", Document: "privacy", Version: "1"},
+		{Subject: "outdated", Document: "tos", Version: "1"},
+		{Subject: "outdated", Document: "privacy", Version: "1"},
+		{Subject: "partial", Document: "tos", Version: "2"},
+	} {
+		if err := st.Accept(ctx, a); err != nil {
+			t.Fatalf("Accept %+v: %v", a, err)
+		}
+	}
+
+	tests := []struct {
+		name        string
+		st          Store
+		docs        []Document
+		sub         string
+		want        []Document
+		wantUpdated bool
+		wantErr     error
+	}{
+		{name: "new user", st: st, docs: docs, sub: "new", want: docs},
+		{name: "all current", st: st, docs: docs, sub: "current"},
+		{name: "new version", st: st, docs: docs, sub: "outdated", want: []Document{tos}, wantUpdated: true},
+		{name: "new document", st: st, docs: docs, sub: "partial", want: []Document{privacy}},
+		{name: "no documents", st: st, sub: "new"},
+		{name: "store error", st: &failingStore{NewMemoryStore()}, docs: docs, sub: "new", wantErr: errStore},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, updated, err := Pending(ctx, tt.st, tt.docs, tt.sub)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Pending error = %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) || updated != tt.wantUpdated {
+				t.Errorf("Pending = %v, %v; want %v, %v", got, updated, tt.want, tt.wantUpdated)
+			}
+		})
+	}
+}
+
+func TestFor(t *testing.T) {
+	s := &Set{Documents: []Document{
+		{ID: "tos"},
+		{ID: "acme-tos", Clients: []string{"acme"}},
+	}}
+	tests := []struct {
+		name   string
+		set    *Set
+		client string
+		want   []string
+	}{
+		{name: "global only", set: s, client: "other", want: []string{"tos"}},
+		{name: "client specific", set: s, client: "acme", want: []string{"tos", "acme-tos"}},
+		{name: "no set", client: "acme"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, d := range tt.set.For(tt.client) {
+				got = append(got, d.ID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("For(%q) = %v, want %v", tt.client, got, tt.want)
+			}
+		})
+	}
+}
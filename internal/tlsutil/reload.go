@@ -0,0 +1,149 @@
+package tlsutil
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// CertReloader keeps a key pair in memory and swaps it when the files on disk
+// change (cert-manager / vault agent rotations). It polls mtimes, which is
+// good enough for certs and keeps us free of fsnotify.
+type CertReloader struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+func NewCertReloader(certFile, keyFile string) (*CertReloader, error) {
+	r := &CertReloader{certFile: certFile, keyFile: keyFile}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *CertReloader) latestModTime() (time.Time, error) {
+	ci, err := os.Stat(r.certFile)
+	if err != nil {
+		return time.Time{}, err
+	}
+	ki, err := os.Stat(r.keyFile)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if ki.ModTime().After(ci.ModTime()) {
+		return ki.ModTime(), nil
+	}
+	return ci.ModTime(), nil
+}
+
+func (r *CertReloader) reload() error {
+	mt, err := r.latestModTime()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("load key pair %s: %w", r.certFile, err)
+	}
+	r.mu.Lock()
+	r.cert = &cert
+	r.modTime = mt
+	r.mu.Unlock()
+	return nil
+}
+
+// Watch polls the files until ctx is done. A broken rotation (half-written
+// file) keeps serving the previous certificate.
+func (r *CertReloader) Watch(ctx context.Context, every time.Duration) {
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			mt, err := r.latestModTime()
+			if err != nil {
+				log.Printf("tls: stat %s: %v", r.certFile, err)
+				continue
+			}
+			r.mu.RLock()
+			changed := mt.After(r.modTime)
+			r.mu.RUnlock()
+			if !changed {
+				continue
+			}
+			if err := r.reload(); err != nil {
+				log.Printf("tls: reload failed, keeping previous certificate: %v", err)
+				continue
+			}
+			log.Printf("tls: reloaded certificate %s", r.certFile)
+		}
+	}
+}
+
+func (r *CertReloader) current() *tls.Certificate {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert
+}
+
+// GetCertificate plugs into tls.Config for servers.
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.current(), nil
+}
+
+// GetClientCertificate plugs into tls.Config for clients (mTLS).
+func (r *CertReloader) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return r.current(), nil
+}
+
+// ServerConfig returns a TLS 1.2+ server config backed by the reloader.
+func ServerConfig(r *CertReloader) *tls.Config {
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: r.GetCertificate,
+	}
+}
+
+// ClientConfig builds a client config for talking to an internal service.
+// caFile pins the server CA (empty = system roots); certFile/keyFile enable
+// mTLS and are reloaded like server certs.
+func ClientConfig(ctx context.Context, caFile, certFile, keyFile string) (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", caFile)
+		}
+		cfg.RootCAs = pool
+	}
+
+	if certFile != "" || keyFile != "" {
+		if certFile == "" || keyFile == "" {
+			return nil, fmt.Errorf("client certificate and key must be set together")
+		}
+		rl, err := NewCertReloader(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		go rl.Watch(ctx, time.Minute)
+		cfg.GetClientCertificate = rl.GetClientCertificate
+	}
+	return cfg, nil
+}
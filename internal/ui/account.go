@@ -0,0 +1,188 @@
+package ui
+
+import (
+	"log"
+	"net/http"
+	"sort"
+	"time"
+)
+
+type accountConsent struct {
+	ClientID   string
+	ClientName string
+	Scopes     []string
+	GrantedAt  time.Time
+}
+
+type accountPageData struct {
+	pageMeta
+	SignedIn bool
+	Name     string
+	Email    string
+	Subject  string
+	Consents []accountConsent
+	Accounts []accountOption // every account signed in in this browser
+	Methods  []accountLink   // identities that sign in to this account
+	Linkable []providerOption
+	CSRF     string
+	Notice   string
+}
+
+// handleAccount lists the apps the signed-in user has authorized. Identity
+// comes from __bridge_session only; there is no Hydra challenge here.
+func (s *Server) handleAccount(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	s.renderAccount(w, r, r.URL.Query().Get("notice"))
+}
+
+func (s *Server) renderAccount(w http.ResponseWriter, r *http.Request, notice string) {
+	w.Header().Set("Cache-Control", "no-store")
+	data := accountPageData{pageMeta: s.meta(r), Notice: notice}
+
+	jar := s.readSessions(r)
+	sess, ok := jar.active()
+	if !ok {
+		if err := s.tmplAccount.ExecuteTemplate(w, "layout", data); err != nil {
+			log.Printf("account template render: %v", err)
+		}
+		return
+	}
+
+	data.SignedIn = true
+	data.Subject = sess.Sub
+	data.Name, _ = sess.Claims["name"].(string)
+	data.Email, _ = sess.Claims["email"].(string)
+	if data.Name == "" {
+		data.Name = sess.Sub
+	}
+	data.Accounts = jar.options()
+	data.Methods, data.Linkable = s.accountLinks(r, sess)
+	data.CSRF = s.issueCSRF(w, r, "account", sess.Sub)
+
+	consents, err := s.hyd.ListConsentSessions(sess.Sub)
+	if err != nil {
+		s.renderError(w, r, err, nil)
+		return
+	}
+	// one row per client; Hydra may hold several grants for the same client
+	seen := map[string]int{}
+	for _, c := range consents {
+		cl := c.ConsentRequest.Client
+		if i, ok := seen[cl.ClientID]; ok {
+			if c.HandledAt.After(data.Consents[i].GrantedAt) {
+				data.Consents[i].GrantedAt = c.HandledAt
+				data.Consents[i].Scopes = c.GrantScope
+			}
+			continue
+		}
+		name := cl.ClientName
+		if name == "" {
+			name = cl.ClientID
+		}
+		seen[cl.ClientID] = len(data.Consents)
+		data.Consents = append(data.Consents, accountConsent{
+			ClientID:   cl.ClientID,
+			ClientName: name,
+			Scopes:     c.GrantScope,
+			GrantedAt:  c.HandledAt,
+		})
+	}
+	sort.Slice(data.Consents, func(i, j int) bool { return data.Consents[i].ClientName < data.Consents[j].ClientName })
+
+	if err := s.tmplAccount.ExecuteTemplate(w, "layout", data); err != nil {
+		log.Printf("account template render: %v", err)
+	}
+}
+
+// accountPost does the shared checks for the account forms and returns the
+// browser's sessions with the active one.
+func (s *Server) accountPost(w http.ResponseWriter, r *http.Request) (*sessionJar, *bridgeSession, bool) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return nil, nil, false
+	}
+	jar := s.readSessions(r)
+	sess, ok := jar.active()
+	if !ok {
+		http.Redirect(w, r, "/account", http.StatusSeeOther)
+		return nil, nil, false
+	}
+	if err := r.ParseForm(); err != nil {
+		s.renderError(w, r, errBadRequest("The submitted form could not be read."), nil)
+		return nil, nil, false
+	}
+	if !s.verifyCSRF(r, "account", sess.Sub, r.Form.Get("csrf")) {
+		s.renderCSRFError(w, r)
+		return nil, nil, false
+	}
+	return jar, sess, true
+}
+
+func (s *Server) handleRevokeConsent(w http.ResponseWriter, r *http.Request) {
+	_, sess, ok := s.accountPost(w, r)
+	if !ok {
+		return
+	}
+	sub := sess.Sub
+	clientID := r.Form.Get("client_id")
+	if clientID == "" {
+		s.renderError(w, r, errBadRequest("No application was selected."), nil)
+		return
+	}
+	if err := s.hyd.RevokeConsentSessions(sub, clientID); err != nil {
+		s.renderError(w, r, err, nil)
+		return
+	}
+	log.Printf("account: sub=%s revoked consent for client=%s", sub, clientID)
+	http.Redirect(w, r, "/account?notice=revoked", http.StatusSeeOther)
+}
+
+// handleRevokeSessions signs the active account out everywhere: Hydra login
+// sessions (so no client can silently re-authenticate) plus its bridge
+// session. Other accounts in this browser stay signed in.
+func (s *Server) handleRevokeSessions(w http.ResponseWriter, r *http.Request) {
+	jar, sess, ok := s.accountPost(w, r)
+	if !ok {
+		return
+	}
+	if err := s.hyd.RevokeLoginSessions(sess.Sub); err != nil {
+		s.renderError(w, r, err, nil)
+		return
+	}
+	sub := sess.Sub
+	jar.remove(sess.Sid)
+	s.writeSessions(w, jar)
+	log.Printf("account: sub=%s revoked all login sessions", sub)
+	http.Redirect(w, r, "/account?notice=signed-out", http.StatusSeeOther)
+}
+
+// handleSwitchAccount makes another signed-in account the active one.
+func (s *Server) handleSwitchAccount(w http.ResponseWriter, r *http.Request) {
+	jar, _, ok := s.accountPost(w, r)
+	if !ok {
+		return
+	}
+	jar.use(r.Form.Get("sid"))
+	s.writeSessions(w, jar)
+	http.Redirect(w, r, "/account", http.StatusSeeOther)
+}
+
+// handleSignOutAccount removes one account from this browser only. Hydra
+// login sessions are left alone; use "sign out everywhere" for that.
+func (s *Server) handleSignOutAccount(w http.ResponseWriter, r *http.Request) {
+	jar, _, ok := s.accountPost(w, r)
+	if !ok {
+		return
+	}
+	gone, ok := jar.remove(r.Form.Get("sid"))
+	if !ok {
+		http.Redirect(w, r, "/account", http.StatusSeeOther)
+		return
+	}
+	s.writeSessions(w, jar)
+	log.Printf("account: sub=%s signed out of this browser", gone.Sub)
+	http.Redirect(w, r, "/account?notice=account-removed", http.StatusSeeOther)
+}
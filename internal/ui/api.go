@@ -0,0 +1,391 @@
+package ui
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/nduyhai/hydra-bridge/internal/hydra"
+	"github.com/nduyhai/hydra-bridge/internal/plugins"
+)
+
+// JSON API for SPAs that render login/consent themselves. It runs the same
+// plugin + Hydra logic as the HTML handlers.
+//
+// CSRF: GET responses carry csrf_token, bound to the __bridge_csrf cookie like
+// the HTML forms. POSTs must send it back in X-CSRF-Token and use
+// Content-Type: application/json, which a cross-site <form> cannot do.
+
+const csrfHeader = "X-CSRF-Token"
+
+type apiClient struct {
+	ClientID   string `json:"client_id"`
+	ClientName string `json:"client_name,omitempty"`
+	ClientURI  string `json:"client_uri,omitempty"`
+}
+
+type apiProvider struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name"`
+	IconURL     string `json:"icon_url,omitempty"`
+}
+
+type apiLoginContext struct {
+	Challenge string        `json:"login_challenge"`
+	Client    apiClient     `json:"client"`
+	Provider  string        `json:"provider,omitempty"` // empty: let the user pick from providers
+	Providers []apiProvider `json:"providers"`
+	LoginHint string        `json:"login_hint,omitempty"`
+	CSRFToken string        `json:"csrf_token"`
+}
+
+// apiAccountChoice asks the SPA to let the user pick one of the accounts
+// signed in in this browser. It answers by fetching the login context
+// again with account=<account> (or account=new to sign in anew).
+type apiAccountChoice struct {
+	Challenge     string       `json:"login_challenge"`
+	Client        apiClient    `json:"client"`
+	ChooseAccount bool         `json:"choose_account"`
+	Accounts      []apiAccount `json:"accounts"`
+	Selected      string       `json:"selected,omitempty"` // account matching login_hint
+}
+
+type apiAccount struct {
+	Account string `json:"account"`
+	Name    string `json:"name"`
+	Email   string `json:"email,omitempty"`
+	Active  bool   `json:"active,omitempty"`
+}
+
+type apiLoginSubmit struct {
+	Challenge string `json:"login_challenge"`
+	Provider  string `json:"provider"`
+	Username  string `json:"username"`
+	Password  string `json:"password"`
+}
+
+type apiConsentContext struct {
+	Challenge      string         `json:"consent_challenge"`
+	Client         apiClient      `json:"client"`
+	RequestedScope []string       `json:"requested_scope"`
+	User           map[string]any `json:"user,omitempty"`
+	CSRFToken      string         `json:"csrf_token"`
+}
+
+type apiConsentSubmit struct {
+	Challenge  string   `json:"consent_challenge"`
+	Accept     bool     `json:"accept"`
+	GrantScope []string `json:"grant_scope"`
+}
+
+type apiRedirect struct {
+	RedirectTo string `json:"redirect_to"`
+}
+
+type apiError struct {
+	Error         string `json:"error"`
+	Description   string `json:"error_description,omitempty"`
+	RedirectTo    string `json:"redirect_to,omitempty"`
+	CorrelationID string `json:"correlation_id,omitempty"`
+}
+
+func toAPIClient(c hydra.Client) apiClient {
+	return apiClient{ClientID: c.ClientID, ClientName: c.ClientName, ClientURI: c.ClientURI}
+}
+
+// apiFail is the JSON twin of renderError.
+func (s *Server) apiFail(w http.ResponseWriter, r *http.Request, err error) {
+	cid := correlationID(r)
+	log.Printf("api error cid=%s %s %s: %v", cid, r.Method, r.URL.Path, err)
+
+	out := apiError{CorrelationID: cid}
+	status := http.StatusInternalServerError
+	switch classifyError(err) {
+	case errKindBadRequest:
+		status = http.StatusBadRequest
+		out.Error = "invalid_request"
+		out.Description = err.Error()
+	case errKindRestart:
+		status = http.StatusGone
+		out.Error = "request_expired"
+		out.Description = "The login request expired or was already used. Restart the login."
+		var he *hydra.APIError
+		if errors.As(err, &he) {
+			out.RedirectTo = he.RedirectTo
+		}
+	case errKindUpstream:
+		status = http.StatusBadGateway
+		out.Error = "temporarily_unavailable"
+		out.Description = "The sign-in service is unavailable. Try again later."
+	default:
+		out.Error = "server_error"
+	}
+	w.Header().Set("X-Request-Id", cid)
+	writeJSON(w, status, out)
+}
+
+func (s *Server) originAllowed(r *http.Request, origin string) bool {
+	u, err := url.Parse(origin)
+	if err == nil && u.Host == r.Host {
+		return true // same origin
+	}
+	return slices.Contains(s.cfg.APIAllowedOrigins, origin)
+}
+
+// api wraps JSON endpoints with CORS and the content-type check.
+func (s *Server) api(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if origin := r.Header.Get("Origin"); origin != "" {
+			if !s.originAllowed(r, origin) {
+				writeJSON(w, http.StatusForbidden, apiError{Error: "origin_not_allowed"})
+				return
+			}
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+			w.Header().Add("Vary", "Origin")
+		}
+		if r.Method == http.MethodOptions {
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, "+csrfHeader)
+			w.Header().Set("Access-Control-Max-Age", "600")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if r.Method == http.MethodPost {
+			mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+			if mt != "application/json" {
+				writeJSON(w, http.StatusUnsupportedMediaType, apiError{Error: "invalid_request", Description: "expected application/json"})
+				return
+			}
+		}
+		h(w, r)
+	}
+}
+
+// bridgeURL makes the bridge's own paths (MFA, terms, password change)
+// absolute, so an SPA on another origin sends the browser to the bridge.
+// Hydra's redirects are already absolute and pass through.
+func (s *Server) bridgeURL(redir string) string {
+	if strings.HasPrefix(redir, "/") && !strings.HasPrefix(redir, "//") {
+		return strings.TrimSuffix(s.cfg.PublicURL, "/") + redir
+	}
+	return redir
+}
+
+func decodeJSON(w http.ResponseWriter, r *http.Request, v any) error {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return errBadRequest("The request body is not valid JSON.")
+	}
+	return nil
+}
+
+func (s *Server) handleAPILogin(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		ch := r.URL.Query().Get("login_challenge")
+		if ch == "" {
+			s.apiFail(w, r, errBadRequest("missing login_challenge"))
+			return
+		}
+		req, err := s.hyd.GetLoginRequest(ch)
+		if err != nil {
+			s.apiFail(w, r, err)
+			return
+		}
+
+		hint := r.URL.Query().Get("login_hint")
+		if hint == "" {
+			hint = req.OIDCContext.LoginHint
+		}
+
+		// SSO: same as the HTML flow, no credentials needed
+		jar := s.readSessions(r)
+		sess, choose := pickSession(jar, req, r.URL.Query().Get("account"), hint)
+		if choose {
+			out := apiAccountChoice{Challenge: ch, Client: toAPIClient(req.Client), ChooseAccount: true}
+			for _, o := range jar.options() {
+				out.Accounts = append(out.Accounts, apiAccount{Account: o.Sid, Name: o.Name, Email: o.Email, Active: o.Active})
+			}
+			if m := jar.matchHint(hint); m != nil {
+				out.Selected = m.Sid
+			}
+			writeJSON(w, http.StatusOK, out)
+			return
+		}
+		if sess != nil {
+			redir, usable, err := s.finishSSO(w, r, ch, req, sess)
+			if err != nil {
+				s.apiFail(w, r, err)
+				return
+			}
+			if usable {
+				writeJSON(w, http.StatusOK, apiRedirect{RedirectTo: s.bridgeURL(redir)})
+				return
+			}
+		}
+		provider := r.URL.Query().Get("provider")
+		if provider == "" {
+			provider = s.pickProvider(req.Client, hint)
+		}
+		var providers []apiProvider
+		for _, o := range providerOptions(s.allowedProviders(req.Client)) {
+			providers = append(providers, apiProvider{Name: o.Name, DisplayName: o.DisplayName, IconURL: o.IconURL})
+		}
+		writeJSON(w, http.StatusOK, apiLoginContext{
+			Challenge: ch,
+			Client:    toAPIClient(req.Client),
+			Provider:  provider,
+			Providers: providers,
+			LoginHint: hint,
+			CSRFToken: s.issueCSRF(w, r, "login", ch),
+		})
+
+	case http.MethodPost:
+		var in apiLoginSubmit
+		if err := decodeJSON(w, r, &in); err != nil {
+			s.apiFail(w, r, err)
+			return
+		}
+		if in.Challenge == "" {
+			s.apiFail(w, r, errBadRequest("missing login_challenge"))
+			return
+		}
+		if !s.verifyCSRF(r, "login", in.Challenge, r.Header.Get(csrfHeader)) {
+			writeJSON(w, http.StatusForbidden, apiError{Error: "csrf_invalid", Description: "Fetch the login context again for a fresh token."})
+			return
+		}
+
+		req, err := s.hyd.GetLoginRequest(in.Challenge)
+		if err != nil {
+			s.apiFail(w, r, err)
+			return
+		}
+
+		res, err := s.authenticate(r, req.Client, in.Provider, plugins.Credentials{
+			Username: in.Username,
+			Password: in.Password,
+		})
+		if err != nil {
+			if classifyError(err) == errKindBadRequest {
+				s.apiFail(w, r, err)
+				return
+			}
+			logAuthFailure(in.Provider, err)
+			status, code, msg := authFailure(err)
+			out := apiError{Error: code, Description: msg}
+			provider := in.Provider
+			if provider == "" {
+				provider = s.cfg.DefaultProv
+			}
+			if _, ok := s.passwordChanger(provider); ok && errors.Is(err, plugins.ErrPasswordExpired) {
+				// The SPA sends the browser to the bridge's change-password page.
+				out.RedirectTo = s.bridgeURL(s.startPasswordChange(w, req, provider, in.Username))
+			}
+			writeJSON(w, status, out)
+			return
+		}
+
+		provider := in.Provider
+		if provider == "" {
+			provider = s.cfg.DefaultProv
+		}
+		redir, err := s.finishLogin(w, r, in.Challenge, req, provider, res)
+		if err != nil {
+			s.apiFail(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, apiRedirect{RedirectTo: s.bridgeURL(redir)})
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) handleAPIConsent(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		ch := r.URL.Query().Get("consent_challenge")
+		if ch == "" {
+			s.apiFail(w, r, errBadRequest("missing consent_challenge"))
+			return
+		}
+		req, err := s.hyd.GetConsentRequest(ch)
+		if err != nil {
+			s.apiFail(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, apiConsentContext{
+			Challenge:      ch,
+			Client:         toAPIClient(req.Client),
+			RequestedScope: req.RequestedScope,
+			User:           consentClaims(req),
+			CSRFToken:      s.issueCSRF(w, r, "consent", ch),
+		})
+
+	case http.MethodPost:
+		var in apiConsentSubmit
+		if err := decodeJSON(w, r, &in); err != nil {
+			s.apiFail(w, r, err)
+			return
+		}
+		if in.Challenge == "" {
+			s.apiFail(w, r, errBadRequest("missing consent_challenge"))
+			return
+		}
+		if !s.verifyCSRF(r, "consent", in.Challenge, r.Header.Get(csrfHeader)) {
+			writeJSON(w, http.StatusForbidden, apiError{Error: "csrf_invalid", Description: "Fetch the consent context again for a fresh token."})
+			return
+		}
+
+		if !in.Accept {
+			redir, err := s.hyd.RejectConsentRequest(in.Challenge, hydra.RejectRequestBody{
+				Error:            "access_denied",
+				ErrorDescription: "The resource owner denied the request",
+			})
+			if err != nil {
+				s.apiFail(w, r, err)
+				return
+			}
+			writeJSON(w, http.StatusOK, apiRedirect{RedirectTo: redir.RedirectTo})
+			return
+		}
+
+		req, err := s.hyd.GetConsentRequest(in.Challenge)
+		if err != nil {
+			s.apiFail(w, r, err)
+			return
+		}
+		grant := req.RequestedScope
+		if in.GrantScope != nil {
+			for _, sc := range in.GrantScope {
+				if !slices.Contains(req.RequestedScope, sc) {
+					s.apiFail(w, r, errBadRequest("grant_scope contains a scope that was not requested: "+sc))
+					return
+				}
+			}
+			grant = in.GrantScope
+		}
+
+		redir, err := s.acceptConsent(w, r, req, grant, consentClaims(req))
+		if err != nil {
+			s.apiFail(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, apiRedirect{RedirectTo: redir.RedirectTo})
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// ParseOrigins splits a comma/space separated origin list.
+func ParseOrigins(v string) []string {
+	return strings.FieldsFunc(v, func(r rune) bool { return r == ',' || r == ' ' })
+}
@@ -1,15 +1,16 @@
 package ui
 
 import (
-	"encoding/base64"
-	"encoding/json"
 	"fmt"
+	"log"
 	"net/http"
 
+	"github.com/nduyhai/hydra-bridge/internal/hooks"
 	"github.com/nduyhai/hydra-bridge/internal/hydra"
 )
 
 type consentPageData struct {
+	pageMeta
 	ConsentChallenge string
 	ClientID         string
 	ClientName       string
@@ -19,6 +20,68 @@ type consentPageData struct {
 	CSRF             string
 }
 
+// consentClaims returns the user's claims from the login context we gave
+// Hydra when accepting the login. Nothing the browser sends is trusted for
+// what ends up in tokens.
+func consentClaims(req *hydra.ConsentRequest) map[string]any {
+	userClaims := make(map[string]any, len(req.Context))
+	for k, v := range req.Context {
+		if k != sidClaim {
+			userClaims[k] = v
+		}
+	}
+	return userClaims
+}
+
+// sidClaim carries the bridge session id. Hydra reserves "sid" for its own
+// login session id, so ours gets a distinct name.
+const sidClaim = "bridge_sid"
+
+// acceptConsent grants scopes and injects the user's claims into the tokens,
+// after the before_accept_consent hooks had their say.
+func (s *Server) acceptConsent(w http.ResponseWriter, r *http.Request, req *hydra.ConsentRequest, grant []string, userClaims map[string]any) (*hydra.RedirectResponse, error) {
+	hr, err := s.hooks.Run(r.Context(), hooks.Request{
+		Event:    hooks.BeforeAcceptConsent,
+		Subject:  req.Subject,
+		ClientID: req.Client.ClientID,
+		Scopes:   grant,
+		Claims:   userClaims,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if hr.Denied {
+		log.Printf("hooks: deny consent sub=%s client=%s: %s", req.Subject, req.Client.ClientID, hr.Description)
+		return s.hyd.RejectConsentRequest(req.Challenge, hydra.RejectRequestBody{
+			Error:            hr.Error,
+			ErrorDescription: hr.Description,
+			StatusCode:       http.StatusForbidden,
+		})
+	}
+
+	idToken := hooks.Merge(hr.Claims, hr.IDToken)
+	accessToken := hooks.Merge(hr.Claims, hr.AccessToken)
+	if sid, ok := req.Context[sidClaim].(string); ok && sid != "" {
+		idToken = hooks.Merge(idToken, map[string]any{sidClaim: sid})
+		accessToken = hooks.Merge(accessToken, map[string]any{sidClaim: sid})
+	}
+
+	// Inject claims into tokens (id_token + access_token)
+	redir, err := s.hyd.AcceptConsentRequest(req.Challenge, hydra.AcceptConsentRequestBody{
+		GrantScope:  grant,
+		Remember:    true,
+		RememberFor: 86400,
+		Session: hydra.ConsentSession{
+			IDToken:     idToken,
+			AccessToken: accessToken,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return redir, nil
+}
+
 func (s *Server) handleConsent(w http.ResponseWriter, r *http.Request) {
 	// Challenge comes from query on GET, from form on POST
 	ch := r.URL.Query().Get("consent_challenge")
@@ -30,71 +93,54 @@ func (s *Server) handleConsent(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if ch == "" {
-		http.Error(w, "missing consent_challenge", http.StatusBadRequest)
+		s.renderError(w, r, errBadRequest("The consent request is missing its challenge."), nil)
 		return
 	}
 
-	// Read user claims from cookie (set after login)
-	userClaims := map[string]any{}
-	if c, err := r.Cookie(userInfoCookie); err == nil {
-		if raw, err := base64.RawURLEncoding.DecodeString(c.Value); err == nil {
-			_ = json.Unmarshal(raw, &userClaims)
-		}
-	}
-
 	switch r.Method {
 	case http.MethodGet:
 		req, err := s.hyd.GetConsentRequest(ch)
 		if err != nil {
-			http.Error(w, err.Error(), 500)
+			s.renderError(w, r, err, nil)
 			return
 		}
 
+		userClaims := consentClaims(req)
+		s.allowFraming(w, r, req.Client.ClientID)
 		data := consentPageData{
+			pageMeta:         s.meta(r),
 			ConsentChallenge: ch,
 			ClientID:         req.Client.ClientID,
 			ClientName:       req.Client.ClientName,
 			RequestedScope:   req.RequestedScope,
 			Name:             fmt.Sprint(userClaims["name"]),
 			Email:            fmt.Sprint(userClaims["email"]),
-			CSRF:             csrfToken(s.cfg.CookieAuth, ch),
+			CSRF:             s.issueCSRF(w, r, "consent", ch),
 		}
 
 		if err := s.tmplConsent.ExecuteTemplate(w, "layout", data); err != nil {
-			http.Error(w, "template render error: "+err.Error(), 500)
+			s.renderError(w, r, err, &req.Client)
 			return
 		}
 
 	case http.MethodPost:
-		if r.Form.Get("csrf") != csrfToken(s.cfg.CookieAuth, ch) {
-			http.Error(w, "csrf invalid", 403)
+		if !s.verifyCSRF(r, "consent", ch, r.Form.Get("csrf")) {
+			s.renderCSRFError(w, r)
 			return
 		}
 
 		req, err := s.hyd.GetConsentRequest(ch)
 		if err != nil {
-			http.Error(w, err.Error(), 500)
+			s.renderError(w, r, err, nil)
 			return
 		}
 
-		// Inject claims into tokens (id_token + access_token)
-		redir, err := s.hyd.AcceptConsentRequest(ch, hydra.AcceptConsentRequestBody{
-			GrantScope:  req.RequestedScope,
-			Remember:    true,
-			RememberFor: 86400,
-			Session: hydra.ConsentSession{
-				IDToken:     userClaims, // add extra fields here
-				AccessToken: userClaims,
-			},
-		})
+		redir, err := s.acceptConsent(w, r, req, req.RequestedScope, consentClaims(req))
 		if err != nil {
-			http.Error(w, err.Error(), 500)
+			s.renderError(w, r, err, &req.Client)
 			return
 		}
 
-		// Clean up cookie after consent is done
-		s.deleteCookie(w, userInfoCookie)
-
 		http.Redirect(w, r, redir.RedirectTo, http.StatusFound)
 
 	default:
@@ -0,0 +1,94 @@
+package ui
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const csrfCookie = "__bridge_csrf" // random per-browser value the tokens are bound to
+
+// CSRF tokens look like "<exp>.<mac>" where
+//
+//	mac = HMAC-SHA256(CookieAuth, "csrf|" + cookie + "|" + purpose + "|" + binding + "|" + exp)
+//
+// cookie ties the token to this browser, purpose ("login", "consent", ...)
+// stops a token minted for one form being replayed on another, and binding
+// is usually the Hydra challenge. A leaked challenge URL alone is useless.
+
+func (s *Server) csrfMAC(cookie, purpose, binding string, exp int64) []byte {
+	mac := hmac.New(sha256.New, []byte(s.cfg.CookieAuth))
+	mac.Write([]byte("csrf|" + cookie + "|" + purpose + "|" + binding + "|" + strconv.FormatInt(exp, 10)))
+	return mac.Sum(nil)
+}
+
+// csrfCookieValue returns the browser's CSRF cookie, minting one if needed.
+func (s *Server) csrfCookieValue(w http.ResponseWriter, r *http.Request) string {
+	if c, err := r.Cookie(csrfCookie); err == nil && len(c.Value) >= 32 {
+		return c.Value
+	}
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+	v := base64.RawURLEncoding.EncodeToString(b)
+	// Browser-session cookie; pin it on the request so a second token issued
+	// in the same response binds to the same value.
+	http.SetCookie(w, &http.Cookie{
+		Name:     csrfCookie,
+		Value:    v,
+		Path:     "/",
+		Domain:   s.cfg.CookieDomain,
+		HttpOnly: true,
+		Secure:   s.cfg.CookieSecure,
+		SameSite: s.cfg.SameSiteMode(),
+	})
+	pinCookie(r, csrfCookie, v)
+	return v
+}
+
+// pinCookie makes name=value the only cookie of that name on r. AddCookie
+// alone would leave an older (say, truncated) value first in line for
+// r.Cookie.
+func pinCookie(r *http.Request, name, value string) {
+	kept := []*http.Cookie{}
+	for _, c := range r.Cookies() {
+		if c.Name != name {
+			kept = append(kept, c)
+		}
+	}
+	r.Header.Del("Cookie")
+	for _, c := range kept {
+		r.AddCookie(c)
+	}
+	r.AddCookie(&http.Cookie{Name: name, Value: value})
+}
+
+func (s *Server) issueCSRF(w http.ResponseWriter, r *http.Request, purpose, binding string) string {
+	cookie := s.csrfCookieValue(w, r)
+	exp := time.Now().Add(s.cfg.CSRFTTL()).Unix()
+	return strconv.FormatInt(exp, 10) + "." + base64.RawURLEncoding.EncodeToString(s.csrfMAC(cookie, purpose, binding, exp))
+}
+
+func (s *Server) verifyCSRF(r *http.Request, purpose, binding, token string) bool {
+	c, err := r.Cookie(csrfCookie)
+	if err != nil || c.Value == "" {
+		return false
+	}
+	expStr, macStr, ok := strings.Cut(token, ".")
+	if !ok {
+		return false
+	}
+	exp, err := strconv.ParseInt(expStr, 10, 64)
+	if err != nil || time.Now().Unix() > exp {
+		return false
+	}
+	got, err := base64.RawURLEncoding.DecodeString(macStr)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(got, s.csrfMAC(c.Value, purpose, binding, exp))
+}
@@ -0,0 +1,118 @@
+package ui
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCSRF(t *testing.T) {
+	s := &Server{cfg: Config{CookieAuth: "test-cookie-auth-key"}}
+	const cookie = "0123456789abcdef0123456789abcdef0123456789a"
+
+	tests := []struct {
+		name    string
+		cookie  string // cookie the verifying request carries
+		purpose string
+		binding string
+		token   func(valid string) string
+		want    bool
+	}{
+		{name: "valid", cookie: cookie, purpose: "login", binding: "ch1", want: true},
+		{name: "other purpose", cookie: cookie, purpose: "consent", binding: "ch1"},
+		{name: "other binding", cookie: cookie, purpose: "login", binding: "ch2"},
+		{name: "other browser", cookie: strings.Repeat("x", 43), purpose: "login", binding: "ch1"},
+		{name: "no cookie", purpose: "login", binding: "ch1"},
+		{name: "empty token", cookie: cookie, purpose: "login", binding: "ch1",
+			token: func(string) string { return "" }},
+		{name: "no dot", cookie: cookie, purpose: "login", binding: "ch1",
+			token: func(v string) string { return strings.Replace(v, ".", "", 1) }},
+		{name: "tampered mac", cookie: cookie, purpose: "login", binding: "ch1",
+			token: func(v string) string { return v[:len(v)-2] + "AA" }},
+		{name: "extended expiry", cookie: cookie, purpose: "login", binding: "ch1",
+			token: func(v string) string {
+				_, mac, _ := strings.Cut(v, ".")
+				return strconv.FormatInt(time.Now().Add(48*time.Hour).Unix(), 10) + "." + mac
+			}},
+		{name: "expired", cookie: cookie, purpose: "login", binding: "ch1",
+			token: func(string) string {
+				exp := time.Now().Add(-time.Minute).Unix()
+				return strconv.FormatInt(exp, 10) + "." + "x"
+			}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issue := httptest.NewRequest(http.MethodGet, "/login", nil)
+			issue.AddCookie(&http.Cookie{Name: csrfCookie, Value: cookie})
+			token := s.issueCSRF(httptest.NewRecorder(), issue, "login", "ch1")
+			if tt.token != nil {
+				token = tt.token(token)
+			}
+
+			verify := httptest.NewRequest(http.MethodPost, "/login", nil)
+			if tt.cookie != "" {
+				verify.AddCookie(&http.Cookie{Name: csrfCookie, Value: tt.cookie})
+			}
+			if got := s.verifyCSRF(verify, tt.purpose, tt.binding, token); got != tt.want {
+				t.Errorf("verifyCSRF = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCSRFCookieValue(t *testing.T) {
+	s := &Server{cfg: Config{CookieAuth: "test-cookie-auth-key"}}
+	long := strings.Repeat("a", 43)
+
+	tests := []struct {
+		name   string
+		cookie string // existing cookie; "" for none
+		minted bool
+	}{
+		{name: "kept", cookie: long},
+		{name: "missing", minted: true},
+		{name: "too short", cookie: "short", minted: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/login", nil)
+			r.AddCookie(&http.Cookie{Name: "other", Value: "1"})
+			if tt.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: csrfCookie, Value: tt.cookie})
+			}
+			w := httptest.NewRecorder()
+
+			v := s.csrfCookieValue(w, r)
+			set := w.Result().Cookies()
+			if tt.minted != (len(set) == 1) {
+				t.Fatalf("Set-Cookie count = %d, minted %v", len(set), tt.minted)
+			}
+			if !tt.minted {
+				if v != tt.cookie {
+					t.Errorf("value = %q, want existing %q", v, tt.cookie)
+				}
+				return
+			}
+			if len(v) < 32 || set[0].Value != v {
+				t.Errorf("minted %q, Set-Cookie %q", v, set[0].Value)
+			}
+			// A second token in the same response must bind to the new
+			// value, and other cookies must survive.
+			if c, _ := r.Cookie(csrfCookie); c == nil || c.Value != v {
+				t.Errorf("request cookie = %v, want %q", c, v)
+			}
+			if n := strings.Count(r.Header.Get("Cookie"), csrfCookie+"="); n != 1 {
+				t.Errorf("request carries %d CSRF cookies, want 1", n)
+			}
+			if _, err := r.Cookie("other"); err != nil {
+				t.Errorf("other cookie lost: %v", err)
+			}
+			if v2 := s.csrfCookieValue(httptest.NewRecorder(), r); v2 != v {
+				t.Errorf("second call = %q, want %q", v2, v)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package ui
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/nduyhai/hydra-bridge/internal/hydra"
+)
+
+type devicePageData struct {
+	pageMeta
+	DeviceChallenge string
+	UserCode        string
+	CSRF            string
+	Error           string
+	Success         bool
+}
+
+// handleDevice is the target for Hydra's URLS_DEVICE_VERIFICATION (RFC 8628).
+// The user types the code shown on their TV/CLI; once Hydra accepts it the
+// browser continues through the normal /login and /consent pages, so an
+// existing bridge session is reused there.
+func (s *Server) handleDevice(w http.ResponseWriter, r *http.Request) {
+	ch := r.URL.Query().Get("device_challenge")
+
+	switch r.Method {
+	case http.MethodGet:
+		if ch == "" {
+			// Opened directly (e.g. typed from the TV screen): let Hydra
+			// create the challenge and send the browser back here.
+			u := strings.TrimSuffix(s.cfg.HydraPublic, "/") + "/oauth2/device/verify"
+			if code := r.URL.Query().Get("user_code"); code != "" {
+				u += "?" + url.Values{"user_code": {code}}.Encode()
+			}
+			http.Redirect(w, r, u, http.StatusFound)
+			return
+		}
+		s.renderDevice(w, r, http.StatusOK, devicePageData{
+			DeviceChallenge: ch,
+			UserCode:        r.URL.Query().Get("user_code"),
+		})
+
+	case http.MethodPost:
+		if err := r.ParseForm(); err != nil {
+			s.renderError(w, r, errBadRequest("The submitted form could not be read."), nil)
+			return
+		}
+		if ch == "" {
+			ch = r.Form.Get("device_challenge")
+		}
+		if ch == "" {
+			s.renderError(w, r, errBadRequest("The device request is missing its challenge."), nil)
+			return
+		}
+		if !s.verifyCSRF(r, "device", ch, r.Form.Get("csrf")) {
+			s.renderCSRFError(w, r)
+			return
+		}
+
+		code := strings.TrimSpace(r.Form.Get("user_code"))
+		if code == "" {
+			s.renderDevice(w, r, http.StatusBadRequest, devicePageData{
+				DeviceChallenge: ch,
+				Error:           "Please enter the code shown on your device.",
+			})
+			return
+		}
+
+		redir, err := s.hyd.AcceptUserCodeRequest(ch, hydra.AcceptUserCodeRequestBody{UserCode: code})
+		if err != nil {
+			// Hydra answers 4xx for unknown, used or expired codes; let the
+			// user retry rather than showing the generic error page.
+			var he *hydra.APIError
+			if errors.As(err, &he) && he.StatusCode < 500 {
+				log.Printf("device: user code rejected: %v", err)
+				s.renderDevice(w, r, http.StatusBadRequest, devicePageData{
+					DeviceChallenge: ch,
+					UserCode:        code,
+					Error:           "That code is not valid or has expired. Check your device and try again.",
+				})
+				return
+			}
+			s.renderError(w, r, err, nil)
+			return
+		}
+
+		http.Redirect(w, r, redir.RedirectTo, http.StatusFound)
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// handleDeviceSuccess is the target for Hydra's URLS_DEVICE_SUCCESS.
+func (s *Server) handleDeviceSuccess(w http.ResponseWriter, r *http.Request) {
+	s.renderDevice(w, r, http.StatusOK, devicePageData{Success: true})
+}
+
+func (s *Server) renderDevice(w http.ResponseWriter, r *http.Request, status int, data devicePageData) {
+	data.pageMeta = s.meta(r)
+	if !data.Success {
+		data.CSRF = s.issueCSRF(w, r, "device", data.DeviceChallenge)
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := s.tmplDevice.ExecuteTemplate(w, "layout", data); err != nil {
+		log.Printf("device template render: %v", err)
+	}
+}
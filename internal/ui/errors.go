@@ -0,0 +1,157 @@
+package ui
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/nduyhai/hydra-bridge/internal/hooks"
+	"github.com/nduyhai/hydra-bridge/internal/hydra"
+	"github.com/nduyhai/hydra-bridge/internal/plugins"
+)
+
+type errorPageData struct {
+	pageMeta
+	Title         string
+	Message       string
+	Hint          string
+	CorrelationID string
+	RestartURL    string
+}
+
+type errorKind int
+
+const (
+	errKindInternal   errorKind = iota // our bug / unknown
+	errKindBadRequest                  // malformed request from the browser
+	errKindRestart                     // challenge expired or already used
+	errKindUpstream                    // Hydra or a plugin backend failed
+)
+
+// badRequestError carries a message that is safe to show to end users.
+type badRequestError struct{ msg string }
+
+func (e badRequestError) Error() string { return e.msg }
+
+func errBadRequest(msg string) error { return badRequestError{msg: msg} }
+
+func classifyError(err error) errorKind {
+	var br badRequestError
+	if errors.As(err, &br) {
+		return errKindBadRequest
+	}
+	var hk *hooks.Error
+	if errors.As(err, &hk) {
+		return errKindUpstream
+	}
+	if errors.Is(err, plugins.ErrUnavailable) {
+		return errKindUpstream
+	}
+	var he *hydra.APIError
+	if errors.As(err, &he) {
+		switch {
+		case he.StatusCode == http.StatusNotFound, he.StatusCode == http.StatusGone:
+			return errKindRestart
+		case strings.Contains(strings.ToLower(he.Description), "expired"):
+			return errKindRestart
+		case he.StatusCode >= 500:
+			return errKindUpstream
+		}
+		return errKindInternal
+	}
+	return errKindInternal
+}
+
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// correlationID reuses a sane X-Request-Id from the proxy, or mints one.
+func correlationID(r *http.Request) string {
+	if id := r.Header.Get("X-Request-Id"); requestIDPattern.MatchString(id) {
+		return id
+	}
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// renderError logs the real error with a correlation ID and shows the user a
+// friendly page. client may be nil when the challenge could not be resolved.
+func (s *Server) renderError(w http.ResponseWriter, r *http.Request, err error, client *hydra.Client) {
+	cid := correlationID(r)
+	log.Printf("error cid=%s %s %s: %v", cid, r.Method, r.URL.Path, err)
+
+	data := errorPageData{CorrelationID: cid}
+	status := http.StatusInternalServerError
+
+	switch classifyError(err) {
+	case errKindBadRequest:
+		status = http.StatusBadRequest
+		data.Title = "Invalid request"
+		data.Message = err.Error()
+	case errKindRestart:
+		status = http.StatusGone
+		data.Title = "Your sign-in session has expired"
+		data.Message = "This sign-in link has expired or was already used."
+		data.Hint = "Please return to the application and start the login again."
+		var he *hydra.APIError
+		if errors.As(err, &he) && he.RedirectTo != "" {
+			data.RestartURL = he.RedirectTo
+		} else if client != nil {
+			data.RestartURL = client.ClientURI
+		}
+	case errKindUpstream:
+		status = http.StatusBadGateway
+		data.Title = "Service temporarily unavailable"
+		data.Message = "We could not reach the sign-in service. Please try again in a moment."
+	default:
+		data.Title = "Something went wrong"
+		data.Message = "An unexpected error occurred while processing your request."
+	}
+
+	s.renderErrorPage(w, r, status, data)
+}
+
+func (s *Server) renderErrorPage(w http.ResponseWriter, r *http.Request, status int, data errorPageData) {
+	data.pageMeta = s.meta(r)
+	w.Header().Set("X-Request-Id", data.CorrelationID)
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := s.tmplError.ExecuteTemplate(w, "layout", data); err != nil {
+		log.Printf("error cid=%s template render: %v", data.CorrelationID, err)
+	}
+}
+
+func (s *Server) renderCSRFError(w http.ResponseWriter, r *http.Request) {
+	s.renderErrorPage(w, r, http.StatusForbidden, errorPageData{
+		Title:         "Form expired",
+		Message:       "Your form session is no longer valid. Please go back and try again.",
+		CorrelationID: correlationID(r),
+	})
+}
+
+// handleError is the target for Hydra's URLS_ERROR. Hydra sends the OAuth2
+// error triple in the query string.
+func (s *Server) handleError(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	cid := correlationID(r)
+	log.Printf("hydra error cid=%s error=%q description=%q hint=%q",
+		cid, q.Get("error"), q.Get("error_description"), q.Get("error_hint"))
+
+	data := errorPageData{
+		Title:         "Sign-in could not be completed",
+		Message:       q.Get("error_description"),
+		Hint:          q.Get("error_hint"),
+		CorrelationID: cid,
+	}
+	if data.Message == "" {
+		data.Message = "The authorization request was rejected."
+	}
+	if code := q.Get("error"); code != "" {
+		data.Title = data.Title + " (" + code + ")"
+	}
+	s.renderErrorPage(w, r, http.StatusBadRequest, data)
+}
@@ -0,0 +1,118 @@
+package ui
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/nduyhai/hydra-bridge/internal/plugins"
+)
+
+// dependencyStatus is public (readyz is unauthenticated), so failure
+// details stay in the log: they carry upstream bodies and internal URLs.
+type dependencyStatus struct {
+	Name      string `json:"name"`
+	Status    string `json:"status"` // "up" | "down"
+	LatencyMS int64  `json:"latency_ms"`
+}
+
+type readinessReport struct {
+	Status    string             `json:"status"` // "ready" | "unready" | "draining"
+	CheckedAt time.Time          `json:"checked_at"`
+	Checks    []dependencyStatus `json:"checks"`
+}
+
+// healthCache keeps the last readiness report so frequent probes (several
+// replicas x kubelet + LB) don't turn into load on Hydra and the login API.
+type healthCache struct {
+	mu     sync.Mutex
+	report *readinessReport
+}
+
+type healthCheck struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+func (s *Server) healthChecks() []healthCheck {
+	checks := []healthCheck{{name: "hydra_admin", check: s.hyd.CheckHealth}}
+	for _, p := range s.reg.All() {
+		if hc, ok := p.(plugins.HealthChecker); ok {
+			checks = append(checks, healthCheck{name: "plugin:" + p.Name(), check: hc.CheckHealth})
+		}
+	}
+	return checks
+}
+
+func (s *Server) readiness(ctx context.Context) readinessReport {
+	// Holding the lock while checking means concurrent probes wait for one
+	// round of checks instead of each firing their own.
+	s.health.mu.Lock()
+	defer s.health.mu.Unlock()
+
+	if r := s.health.report; r != nil && time.Since(r.CheckedAt) < s.cfg.HealthCacheTTL() {
+		return *r
+	}
+
+	checks := s.healthChecks()
+	results := make([]dependencyStatus, len(checks))
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c healthCheck) {
+			defer wg.Done()
+			start := time.Now()
+			st := dependencyStatus{Name: c.name, Status: "up"}
+			if err := c.check(ctx); err != nil {
+				st.Status = "down"
+				log.Printf("readyz: %s down: %v", c.name, err)
+			}
+			st.LatencyMS = time.Since(start).Milliseconds()
+			results[i] = st
+		}(i, c)
+	}
+	wg.Wait()
+
+	report := readinessReport{Status: "ready", CheckedAt: time.Now(), Checks: results}
+	for _, r := range results {
+		if r.Status != "up" {
+			report.Status = "unready"
+			break
+		}
+	}
+	s.health.report = &report
+	return report
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// handleLivez only says the process is serving; it must not depend on
+// Hydra, otherwise a Hydra outage restarts every bridge pod.
+func (s *Server) handleLivez(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	if s.draining.Load() {
+		writeJSON(w, http.StatusServiceUnavailable, readinessReport{Status: "draining", CheckedAt: time.Now()})
+		return
+	}
+	report := s.readiness(r.Context())
+	status := http.StatusOK
+	if report.Status != "ready" {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, report)
+}
@@ -0,0 +1,391 @@
+package ui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/nduyhai/hydra-bridge/internal/identity"
+	"github.com/nduyhai/hydra-bridge/internal/plugins"
+)
+
+// Account linking. A provider identity is linked to the signed-in account
+// only after the user proves both sides: the account by a recent sign-in
+// (or by re-authenticating with the provider it was signed in with), the
+// new identity by signing in with it.
+
+const (
+	purposeLink   = "link"
+	purposeReauth = "reauth"
+)
+
+// accountLink is one sign-in method on the account page.
+type accountLink struct {
+	Provider    string
+	DisplayName string
+	Primary     bool // the identity the account was created from
+	LinkedAt    time.Time
+}
+
+type linkPageData struct {
+	pageMeta
+	AccountName  string
+	Provider     string // provider being linked
+	ProviderName string
+	CSRF         string
+	Error        string
+
+	// Step 1 when the sign-in is not recent: confirm the current account.
+	Reauth         bool
+	ReauthName     string
+	ReauthRedirect bool // upstream sign-in instead of a password form
+	CannotReauth   bool // e.g. email-link accounts; sign in again from an app
+
+	Redirect bool // step 2 is an upstream sign-in instead of a password form
+	Username string
+}
+
+// verifyIdentity runs a plugin without client restrictions or subject
+// mapping; the result carries the plugin's own subject. Password attempts
+// go through the lockout.
+func (s *Server) verifyIdentity(r *http.Request, provider string, cred plugins.Credentials) (*plugins.AuthResult, error) {
+	p, err := s.reg.Get(provider)
+	if err != nil {
+		return nil, errBadRequest("The selected sign-in provider is not available.")
+	}
+
+	// Lockout only applies to passwords; tokens and codes are single use.
+	var key string
+	if cred.Username != "" && cred.Password != "" {
+		key = lockKey(provider, cred.Username)
+		if s.lock.locked(key) {
+			return nil, errBridgeLocked
+		}
+	}
+
+	ctx, cancel := s.ctx(r)
+	defer cancel()
+	res, err := p.Authenticate(ctx, cred)
+	if key != "" {
+		switch {
+		case err == nil:
+			s.lock.reset(key)
+		case errors.Is(err, plugins.ErrInvalidCredentials):
+			if s.lock.fail(key) {
+				log.Printf("lockout: provider=%s user=%q locked for %s", provider, cred.Username, s.lock.period)
+			}
+		}
+	}
+	return res, err
+}
+
+// recentlySignedIn reports whether sess is fresh enough to link identities.
+func (s *Server) recentlySignedIn(sess *bridgeSession) bool {
+	return time.Since(time.Unix(sess.Iat, 0)) <= s.cfg.LinkReauth()
+}
+
+// signInMethods lists the identities that sign in to sess.Sub. Without any
+// stored link that is just the one the session was created with.
+func (s *Server) signInMethods(ctx context.Context, sess *bridgeSession) ([]identity.Link, error) {
+	links, err := s.ids.Links(ctx, sess.Sub)
+	if err != nil || len(links) > 0 || sess.Provider == "" {
+		return links, err
+	}
+	return []identity.Link{{Subject: sess.Sub, Provider: sess.Provider, ExternalID: sess.Sub}}, nil
+}
+
+// linkable reports whether provider can be linked to sess: it must take
+// credentials or redirect (email links prove an address, not an identity)
+// and not be linked already.
+func (s *Server) linkable(ctx context.Context, sess *bridgeSession, provider string) bool {
+	p, err := s.reg.Get(provider)
+	if err != nil {
+		return false
+	}
+	if _, ok := p.(plugins.LinkSender); ok {
+		return false
+	}
+	methods, err := s.signInMethods(ctx, sess)
+	if err != nil {
+		return false
+	}
+	for _, m := range methods {
+		if m.Provider == provider {
+			return false
+		}
+	}
+	return true
+}
+
+// linkIdentity ties provider/externalID to the session's subject.
+func (s *Server) linkIdentity(ctx context.Context, sess *bridgeSession, provider, externalID string) error {
+	links, err := s.ids.Links(ctx, sess.Sub)
+	if err != nil {
+		return err
+	}
+	// First link: record the identity the account came from, so the
+	// account page can list it next to the new one.
+	if len(links) == 0 && sess.Provider != "" {
+		if err := s.ids.Link(ctx, identity.Link{Subject: sess.Sub, Provider: sess.Provider, ExternalID: sess.Sub}); err != nil {
+			return err
+		}
+	}
+	return s.ids.Link(ctx, identity.Link{Subject: sess.Sub, Provider: provider, ExternalID: externalID})
+}
+
+func linkErrorMessage(err error) string {
+	switch {
+	case errors.Is(err, identity.ErrLinkedElsewhere):
+		return "That sign-in is already linked to another account."
+	case errors.Is(err, identity.ErrProviderLinked):
+		return "Your account already has a sign-in with this provider. Unlink it first."
+	default:
+		return "The sign-in method could not be linked. Please try again."
+	}
+}
+
+func linkPageURL(provider string) string {
+	return "/account/link?" + url.Values{"provider": {provider}}.Encode()
+}
+
+func (s *Server) renderLink(w http.ResponseWriter, r *http.Request, status int, sess *bridgeSession, provider, errMsg string) {
+	w.Header().Set("Cache-Control", "no-store")
+	data := linkPageData{
+		pageMeta:     s.meta(r),
+		AccountName:  sessionName(sess),
+		Provider:     provider,
+		ProviderName: s.providerLabel(provider),
+		CSRF:         s.issueCSRF(w, r, "account", sess.Sub),
+		Error:        errMsg,
+	}
+	if !s.recentlySignedIn(sess) {
+		data.Reauth = true
+		data.ReauthName = s.providerLabel(sess.Provider)
+		p, err := s.reg.Get(sess.Provider)
+		if err != nil {
+			data.CannotReauth = true
+		} else if _, ok := p.(plugins.LinkSender); ok {
+			data.CannotReauth = true
+		} else {
+			_, data.ReauthRedirect = p.(plugins.Redirector)
+		}
+		data.Username, _ = sess.Claims["preferred_username"].(string)
+	} else {
+		_, data.Redirect = s.redirector(provider)
+	}
+	w.WriteHeader(status)
+	if err := s.tmplLink.ExecuteTemplate(w, "layout", data); err != nil {
+		log.Printf("link template render: %v", err)
+	}
+}
+
+func sessionName(sess *bridgeSession) string {
+	for _, k := range []string{"name", "email", "preferred_username"} {
+		if v, _ := sess.Claims[k].(string); v != "" {
+			return v
+		}
+	}
+	return sess.Sub
+}
+
+// handleLink shows the link steps (GET) and links a provider identity
+// (POST): upstream providers via a redirect, the others with a password.
+func (s *Server) handleLink(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		sess, ok := s.readSessionFromRequest(r)
+		if !ok {
+			http.Redirect(w, r, "/account", http.StatusSeeOther)
+			return
+		}
+		provider := r.URL.Query().Get("provider")
+		ctx, cancel := s.ctx(r)
+		defer cancel()
+		if !s.linkable(ctx, sess, provider) {
+			s.renderError(w, r, errBadRequest("This sign-in method can't be linked to your account."), nil)
+			return
+		}
+		s.renderLink(w, r, http.StatusOK, sess, provider, "")
+		return
+	}
+
+	_, sess, ok := s.accountPost(w, r)
+	if !ok {
+		return
+	}
+	provider := r.Form.Get("provider")
+	ctx, cancel := s.ctx(r)
+	defer cancel()
+	if !s.linkable(ctx, sess, provider) {
+		s.renderError(w, r, errBadRequest("This sign-in method can't be linked to your account."), nil)
+		return
+	}
+	if !s.recentlySignedIn(sess) {
+		http.Redirect(w, r, linkPageURL(provider), http.StatusSeeOther)
+		return
+	}
+	if rd, ok := s.redirector(provider); ok {
+		s.startOAuth(w, r, oauthState{Purpose: purposeLink, Sid: sess.Sid, Provider: provider}, rd)
+		return
+	}
+
+	res, err := s.verifyIdentity(r, provider, plugins.Credentials{
+		Username: r.Form.Get("username"),
+		Password: r.Form.Get("password"),
+	})
+	if err != nil {
+		log.Printf("link: sub=%s provider=%s sign-in failed: %v", sess.Sub, provider, err)
+		status, _, msg := authFailure(err)
+		s.renderLink(w, r, status, sess, provider, msg)
+		return
+	}
+	if err := s.linkIdentity(ctx, sess, provider, res.Subject); err != nil {
+		log.Printf("link: sub=%s provider=%s: %v", sess.Sub, provider, err)
+		s.renderLink(w, r, http.StatusConflict, sess, provider, linkErrorMessage(err))
+		return
+	}
+	log.Printf("link: sub=%s linked provider=%s", sess.Sub, provider)
+	http.Redirect(w, r, "/account?notice=linked", http.StatusSeeOther)
+}
+
+// handleReauth confirms the signed-in account with the provider it was
+// signed in with, then returns to the link page for form value "next".
+func (s *Server) handleReauth(w http.ResponseWriter, r *http.Request) {
+	jar, sess, ok := s.accountPost(w, r)
+	if !ok {
+		return
+	}
+	next := r.Form.Get("next")
+	if rd, ok := s.redirector(sess.Provider); ok {
+		s.startOAuth(w, r, oauthState{Purpose: purposeReauth, Sid: sess.Sid, Provider: sess.Provider, Next: next}, rd)
+		return
+	}
+	if _, ok := s.linkSender(sess.Provider); ok {
+		s.renderError(w, r, errBadRequest("Sign in again from an application to confirm it's you."), nil)
+		return
+	}
+
+	res, err := s.verifyIdentity(r, sess.Provider, plugins.Credentials{
+		Username: r.Form.Get("username"),
+		Password: r.Form.Get("password"),
+	})
+	if err == nil && !s.sameAccount(r, sess, res) {
+		err = fmt.Errorf("signed in as a different account: %w", plugins.ErrInvalidCredentials)
+	}
+	if err != nil {
+		log.Printf("reauth: sub=%s provider=%s failed: %v", sess.Sub, sess.Provider, err)
+		status, _, msg := authFailure(err)
+		s.renderLink(w, r, status, sess, next, msg)
+		return
+	}
+	sess.Iat = time.Now().Unix()
+	s.writeSessions(w, jar)
+	http.Redirect(w, r, linkPageURL(next), http.StatusSeeOther)
+}
+
+// sameAccount reports whether a plugin result signs in to sess.Sub.
+func (s *Server) sameAccount(r *http.Request, sess *bridgeSession, res *plugins.AuthResult) bool {
+	ctx, cancel := s.ctx(r)
+	defer cancel()
+	sub, err := identity.Subject(ctx, s.ids, sess.Provider, res.Subject)
+	return err == nil && sub == sess.Sub
+}
+
+// finishAccountOAuth completes link and re-authentication round-trips.
+func (s *Server) finishAccountOAuth(w http.ResponseWriter, r *http.Request, st *oauthState) {
+	jar := s.readSessions(r)
+	sess, ok := jar.active()
+	if !ok || sess.Sid != st.Sid {
+		s.renderError(w, r, errBadRequest("You were signed out or switched accounts while linking. Please start again."), nil)
+		return
+	}
+	if e := r.URL.Query().Get("error"); e != "" {
+		log.Printf("oauth: %s provider=%s returned error=%s", st.Purpose, st.Provider, e)
+		http.Redirect(w, r, "/account", http.StatusSeeOther)
+		return
+	}
+	res, err := s.verifyIdentity(r, st.Provider, plugins.Credentials{
+		Token:    r.URL.Query().Get("code"),
+		Verifier: st.Verifier,
+	})
+	if err != nil {
+		log.Printf("oauth: %s provider=%s sub=%s failed: %v", st.Purpose, st.Provider, sess.Sub, err)
+		s.renderError(w, r, errBadRequest("We could not sign you in with "+s.providerLabel(st.Provider)+"."), nil)
+		return
+	}
+
+	switch st.Purpose {
+	case purposeReauth:
+		if !s.sameAccount(r, sess, res) {
+			s.renderError(w, r, errBadRequest("You signed in as a different account. Use the account you're linking to."), nil)
+			return
+		}
+		sess.Iat = time.Now().Unix()
+		s.writeSessions(w, jar)
+		http.Redirect(w, r, linkPageURL(st.Next), http.StatusSeeOther)
+
+	case purposeLink:
+		ctx, cancel := s.ctx(r)
+		defer cancel()
+		if err := s.linkIdentity(ctx, sess, st.Provider, res.Subject); err != nil {
+			log.Printf("link: sub=%s provider=%s: %v", sess.Sub, st.Provider, err)
+			s.renderError(w, r, errBadRequest(linkErrorMessage(err)), nil)
+			return
+		}
+		log.Printf("link: sub=%s linked provider=%s", sess.Sub, st.Provider)
+		http.Redirect(w, r, "/account?notice=linked", http.StatusSeeOther)
+
+	default:
+		s.renderError(w, r, errBadRequest("Unknown sign-in round-trip."), nil)
+	}
+}
+
+// handleUnlink removes a linked identity from the active account. The
+// identity the account was created from can't be unlinked.
+func (s *Server) handleUnlink(w http.ResponseWriter, r *http.Request) {
+	_, sess, ok := s.accountPost(w, r)
+	if !ok {
+		return
+	}
+	provider := r.Form.Get("provider")
+	ctx, cancel := s.ctx(r)
+	defer cancel()
+	if err := s.ids.Unlink(ctx, sess.Sub, provider); err != nil {
+		if errors.Is(err, identity.ErrNotLinked) {
+			s.renderError(w, r, errBadRequest("This sign-in method can't be unlinked."), nil)
+			return
+		}
+		s.renderError(w, r, err, nil)
+		return
+	}
+	log.Printf("link: sub=%s unlinked provider=%s", sess.Sub, provider)
+	http.Redirect(w, r, "/account?notice=unlinked", http.StatusSeeOther)
+}
+
+// accountLinks fills the sign-in methods section of the account page.
+func (s *Server) accountLinks(r *http.Request, sess *bridgeSession) (methods []accountLink, linkable []providerOption) {
+	ctx, cancel := s.ctx(r)
+	defer cancel()
+	links, err := s.signInMethods(ctx, sess)
+	if err != nil {
+		log.Printf("account: sub=%s list links: %v", sess.Sub, err)
+		return nil, nil
+	}
+	for _, l := range links {
+		methods = append(methods, accountLink{
+			Provider:    l.Provider,
+			DisplayName: s.providerLabel(l.Provider),
+			Primary:     l.Primary(),
+			LinkedAt:    l.LinkedAt,
+		})
+	}
+	for _, o := range providerOptions(s.reg.All()) {
+		if s.linkable(ctx, sess, o.Name) {
+			linkable = append(linkable, o)
+		}
+	}
+	return methods, linkable
+}
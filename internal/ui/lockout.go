@@ -0,0 +1,128 @@
+package ui
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nduyhai/hydra-bridge/internal/plugins"
+)
+
+// lockout refuses password sign-ins for a provider/username pair after too
+// many wrong passwords in a row. Only plugins.ErrInvalidCredentials counts:
+// a backend outage says nothing about the password. The counters are per
+// process, like the OTP store.
+type lockout struct {
+	max    int           // failures before locking; 0 disables
+	period time.Duration // how long the lock lasts and failures are remembered
+
+	mu    sync.Mutex
+	state map[string]*lockState
+}
+
+type lockState struct {
+	fails int
+	last  time.Time
+	until time.Time
+}
+
+// totpMaxFailures is how many wrong authenticator codes a subject gets
+// before the second factor is refused for the lockout period. Unlike the
+// password lockout it can't be turned off: a 6-digit code falls to guessing.
+const totpMaxFailures = 5
+
+func newLockout(max int, period time.Duration) *lockout {
+	return &lockout{max: max, period: period, state: map[string]*lockState{}}
+}
+
+func lockKey(provider, username string) string {
+	return provider + "|" + strings.ToLower(strings.TrimSpace(username))
+}
+
+// locked reports whether key is currently locked.
+func (l *lockout) locked(key string) bool {
+	if l.max <= 0 {
+		return false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	st := l.state[key]
+	return st != nil && time.Now().Before(st.until)
+}
+
+// fail records a wrong password and reports whether key is now locked.
+func (l *lockout) fail(key string) bool {
+	if l.max <= 0 {
+		return false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	for k, st := range l.state {
+		if now.Sub(st.last) > l.period && now.After(st.until) {
+			delete(l.state, k)
+		}
+	}
+	st := l.state[key]
+	if st == nil {
+		st = &lockState{}
+		l.state[key] = st
+	}
+	st.fails++
+	st.last = now
+	if st.fails >= l.max {
+		st.fails = 0
+		st.until = now.Add(l.period)
+		return true
+	}
+	return false
+}
+
+func (l *lockout) reset(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.state, key)
+}
+
+// errBridgeLocked is returned instead of calling the plugin while locked.
+var errBridgeLocked = &plugins.Error{Code: plugins.CodeAccountLocked, Err: errors.New("too many failed sign-ins")}
+
+// authFailure turns a failed Authenticate into the HTTP status, JSON API
+// error code and message shown to the user.
+func authFailure(err error) (status int, code, msg string) {
+	switch plugins.ErrorCode(err) {
+	case plugins.CodeAccountLocked:
+		return http.StatusLocked, string(plugins.CodeAccountLocked),
+			"This account is locked. Try again later or contact support."
+	case plugins.CodePasswordExpired:
+		return http.StatusUnauthorized, string(plugins.CodePasswordExpired),
+			"Your password has expired. Use \"Forgot password?\" to choose a new one."
+	case plugins.CodeMFARequired:
+		return http.StatusUnauthorized, string(plugins.CodeMFARequired),
+			"This account needs two-step verification, which this sign-in method can't provide. Choose another way to sign in."
+	case plugins.CodePasswordRejected:
+		return http.StatusUnprocessableEntity, string(plugins.CodePasswordRejected),
+			"That password can't be used. Choose a different one."
+	case plugins.CodeAccountExists:
+		return http.StatusConflict, string(plugins.CodeAccountExists),
+			"An account with this email already exists. Sign in or reset your password instead."
+	case plugins.CodeUnavailable:
+		return http.StatusServiceUnavailable, "temporarily_unavailable",
+			"Sign-in is temporarily unavailable. Please try again in a moment."
+	default:
+		// Invalid credentials, and plain errors from plugins that predate
+		// the typed errors.
+		return http.StatusUnauthorized, string(plugins.CodeInvalidCredentials), "Invalid credentials"
+	}
+}
+
+// logAuthFailure keeps outages visible in the logs; wrong passwords are
+// routine.
+func logAuthFailure(provider string, err error) {
+	if plugins.ErrorCode(err) != plugins.CodeInvalidCredentials {
+		log.Printf("login: provider=%s: %v", provider, err)
+	}
+}
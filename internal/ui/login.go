@@ -2,32 +2,51 @@ package ui
 
 import (
 	"crypto/hmac"
+	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base64"
-	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
 	"strings"
 	"time"
 
 	"github.com/nduyhai/hydra-bridge/internal/hydra"
+	"github.com/nduyhai/hydra-bridge/internal/identity"
 	"github.com/nduyhai/hydra-bridge/internal/plugins"
+	"github.com/nduyhai/hydra-bridge/internal/policy"
 )
 
 type loginPageData struct {
+	pageMeta
 	LoginChallenge string
 	ClientID       string
 	ClientName     string
 	Provider       string
+	LoginHint      string
+	CanChoose      bool // more than one provider; show "use another method"
+	Passwordless   bool // provider mails a sign-in link instead of taking a password
+	LinkSent       bool
+	CanReset       bool // provider supports the forgot-password flow
+	CanRegister    bool // provider can create accounts
 	CSRF           string
 	Error          string
 }
 
-// Minimal session payload. You can add "sid", "iat", etc.
+// Minimal session payload.
 type bridgeSession struct {
-	Sub    string                 `json:"sub"`
-	Claims map[string]interface{} `json:"claims,omitempty"`
-	Iat    int64                  `json:"iat"`
-	Exp    int64                  `json:"exp"`
+	Sid      string                 `json:"sid,omitempty"` // bridge session id, propagated to Hydra and tokens
+	Sub      string                 `json:"sub"`
+	Claims   map[string]interface{} `json:"claims,omitempty"`
+	Provider string                 `json:"prov,omitempty"`
+	AMR      []string               `json:"amr,omitempty"`
+	ACR      string                 `json:"acr,omitempty"`
+	Iat      int64                  `json:"iat"`
+	Exp      int64                  `json:"exp"`
+}
+
+func (b *bridgeSession) authResult() *plugins.AuthResult {
+	return &plugins.AuthResult{Subject: b.Sub, Claims: b.Claims, AMR: b.AMR}
 }
 
 // --- Cookie helpers (HMAC-signed) ---
@@ -62,34 +81,108 @@ func (s *Server) verifyCookieValue(v string) ([]byte, bool) {
 	return payload, true
 }
 
+// readSessionFromRequest returns the active account of this browser.
 func (s *Server) readSessionFromRequest(r *http.Request) (*bridgeSession, bool) {
-	c, err := r.Cookie(bridgeSessionCookie)
-	if err != nil || c.Value == "" {
-		return nil, false
+	return s.readSessions(r).active()
+}
+
+// acceptSSO accepts the Hydra login for an existing bridge session and makes
+// it the active account.
+func (s *Server) acceptSSO(w http.ResponseWriter, r *http.Request, ch string, sess *bridgeSession) (*hydra.RedirectResponse, error) {
+	jar := s.readSessions(r)
+	if jar.Active != sess.Sid {
+		jar.use(sess.Sid)
+		s.writeSessions(w, jar)
 	}
-	payload, ok := s.verifyCookieValue(c.Value)
-	if !ok {
-		return nil, false
+
+	ttl := s.cfg.SessionTTL()
+
+	return s.hyd.AcceptLoginRequest(ch, hydra.AcceptLoginRequestBody{
+		Subject:                   sess.Sub,
+		Remember:                  true,
+		RememberFor:               int(ttl.Seconds()), // align with the bridge session
+		Context:                   loginContext(sess.Claims, sess.Sid),
+		ACR:                       policy.ACRFor(sess.AMR),
+		AMR:                       sess.AMR,
+		IdentityProviderSessionID: sess.Sid,
+	})
+}
+
+// loginContext is what Hydra hands back to us on the consent request:
+// the user's claims plus our session id.
+func loginContext(claims map[string]interface{}, sid string) map[string]interface{} {
+	ctx := make(map[string]interface{}, len(claims)+1)
+	for k, v := range claims {
+		ctx[k] = v
 	}
-	var sess bridgeSession
-	if err := json.Unmarshal(payload, &sess); err != nil {
-		return nil, false
+	if sid != "" {
+		ctx[sidClaim] = sid
 	}
-	// expiry check
-	if sess.Exp > 0 && time.Now().Unix() > sess.Exp {
-		return nil, false
+	return ctx
+}
+
+func newSessionID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// authenticate runs the named plugin (DefaultProv when empty), provided the
+// client is allowed to use it, and resolves the result to the stable subject.
+func (s *Server) authenticate(r *http.Request, client hydra.Client, provider string, cred plugins.Credentials) (*plugins.AuthResult, error) {
+	if provider == "" {
+		provider = s.cfg.DefaultProv
 	}
-	if sess.Sub == "" {
-		return nil, false
+	if !s.providerAllowed(client, provider) {
+		return nil, errBadRequest("The selected sign-in provider is not available.")
+	}
+	res, err := s.verifyIdentity(r, provider, cred)
+	if err != nil {
+		return nil, err
+	}
+
+	// Hydra only ever sees the stable subject; linked identities map to it.
+	ctx, cancel := s.ctx(r)
+	defer cancel()
+	if res.Subject, err = identity.Subject(ctx, s.ids, provider, res.Subject); err != nil {
+		return nil, err
 	}
-	return &sess, true
+	return res, nil
 }
 
-// Optional: keep consent cookie fresh / keep short-lived claims cookie updated.
-func (s *Server) setUserInfoCookie(w http.ResponseWriter, claims map[string]interface{}) {
-	claimsJSON, _ := json.Marshal(claims)
-	claimsB64 := base64.RawURLEncoding.EncodeToString(claimsJSON)
-	s.setShortCookie(w, userInfoCookie, claimsB64, 1800) // 30 minutes
+// acceptLogin adds a bridge session for a fresh authentication to the
+// browser's accounts and accepts the Hydra login request.
+func (s *Server) acceptLogin(w http.ResponseWriter, r *http.Request, ch, provider string, res *plugins.AuthResult) (*hydra.RedirectResponse, error) {
+	// ----- Create / refresh Bridge SSO session cookie (SOURCE OF TRUTH) -----
+	ttl := s.cfg.SessionTTL()
+	if ttl <= 0 {
+		ttl = time.Duration(bridgeSessionTTLDays) * 24 * time.Hour
+	}
+	now := time.Now().Unix()
+	sess := bridgeSession{
+		Sid:      newSessionID(),
+		Sub:      res.Subject,
+		Claims:   res.Claims,
+		Provider: provider,
+		AMR:      res.AMR,
+		ACR:      policy.ACRFor(res.AMR),
+		Iat:      now,
+		Exp:      now + int64(ttl.Seconds()),
+	}
+	jar := s.readSessions(r)
+	jar.add(sess)
+	s.writeSessions(w, jar)
+
+	// Accept login in Hydra
+	return s.hyd.AcceptLoginRequest(ch, hydra.AcceptLoginRequestBody{
+		Subject:                   res.Subject, // OIDC sub
+		Remember:                  true,
+		RememberFor:               int(ttl.Seconds()),
+		Context:                   loginContext(res.Claims, sess.Sid),
+		ACR:                       sess.ACR,
+		AMR:                       res.AMR,
+		IdentityProviderSessionID: sess.Sid,
+	})
 }
 
 // ------------------- Updated handleLogin -------------------
@@ -97,68 +190,91 @@ func (s *Server) setUserInfoCookie(w http.ResponseWriter, claims map[string]inte
 func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
 	ch := r.URL.Query().Get("login_challenge")
 	if ch == "" {
-		http.Error(w, "missing login_challenge", http.StatusBadRequest)
+		s.renderError(w, r, errBadRequest("The login request is missing its challenge."), nil)
 		return
 	}
 
-	provider := r.URL.Query().Get("provider")
-	if provider == "" {
-		provider = s.cfg.DefaultProv
-	}
-
 	switch r.Method {
 	case http.MethodGet:
 		// Always fetch the login request first (for client info + redirect_to, skip, etc.)
 		req, err := s.hyd.GetLoginRequest(ch)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			s.renderError(w, r, err, nil)
 			return
 		}
 
-		// ----- SSO: if a bridge session cookie exists, auto-accept login -----
-		if sess, ok := s.readSessionFromRequest(r); ok {
-			// Keep a short-lived user-info cookie fresh for consent page rendering
-			if sess.Claims != nil {
-				s.setUserInfoCookie(w, sess.Claims)
-			}
-
-			ttl := s.cfg.SessionTTL()
+		hint := r.URL.Query().Get("login_hint")
+		if hint == "" {
+			hint = req.OIDCContext.LoginHint
+		}
 
-			redir, err := s.hyd.AcceptLoginRequest(ch, hydra.AcceptLoginRequestBody{
-				Subject:     sess.Sub,
-				Remember:    true,
-				RememberFor: int(ttl.Seconds()), // align with the bridge session
-				Context:     sess.Claims,
-			})
+		// ----- SSO: reuse one of the browser's bridge sessions -----
+		jar := s.readSessions(r)
+		sess, choose := pickSession(jar, req, r.URL.Query().Get("account"), hint)
+		if choose {
+			s.renderAccountChooser(w, r, ch, req, jar, hint)
+			return
+		}
+		if sess != nil {
+			redir, usable, err := s.finishSSO(w, r, ch, req, sess)
 			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+				s.renderError(w, r, err, &req.Client)
+				return
+			}
+			if usable {
+				http.Redirect(w, r, redir, http.StatusFound)
 				return
 			}
+			// too old for this client's policy -> fall through to a fresh login
+		}
+
+		// No SSO session -> pick a provider (or let the user choose)
+		provider := r.URL.Query().Get("provider")
+		if provider == "" && r.URL.Query().Get("choose") == "" {
+			provider = s.pickProvider(req.Client, hint)
+		}
+		if provider == "" {
+			s.renderProviderChooser(w, r, ch, req, hint, "")
+			return
+		}
+		if !s.providerAllowed(req.Client, provider) {
+			s.renderError(w, r, errBadRequest("The selected sign-in provider is not available."), &req.Client)
+			return
+		}
 
-			http.Redirect(w, r, redir.RedirectTo, http.StatusFound)
+		// Social providers sign in upstream; no form to show.
+		if rd, ok := s.redirector(provider); ok {
+			s.startOAuth(w, r, oauthState{Challenge: ch, Provider: provider}, rd)
 			return
 		}
 
-		// No SSO session -> show login page
+		// -> show login page
+		s.allowFraming(w, r, req.Client.ClientID)
 		data := loginPageData{
+			pageMeta:       s.meta(r),
 			LoginChallenge: ch,
 			ClientID:       req.Client.ClientID,
 			ClientName:     req.Client.ClientName,
 			Provider:       provider,
-			CSRF:           csrfToken(s.cfg.CookieAuth, ch),
+			LoginHint:      hint,
+			CanChoose:      len(s.allowedProviders(req.Client)) > 1,
+			CSRF:           s.issueCSRF(w, r, "login", ch),
 		}
+		_, data.Passwordless = s.linkSender(provider)
+		_, data.CanReset = s.passwordResetter(provider)
+		_, data.CanRegister = s.registrar(provider)
 		if err := s.tmplLogin.ExecuteTemplate(w, "layout", data); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			s.renderError(w, r, err, nil)
 			return
 		}
 
 	case http.MethodPost:
 		if err := r.ParseForm(); err != nil {
-			http.Error(w, "bad form", http.StatusBadRequest)
+			s.renderError(w, r, errBadRequest("The submitted form could not be read."), nil)
 			return
 		}
-		if r.Form.Get("csrf") != csrfToken(s.cfg.CookieAuth, ch) {
-			http.Error(w, "csrf invalid", http.StatusForbidden)
+		if !s.verifyCSRF(r, "login", ch, r.Form.Get("csrf")) {
+			s.renderCSRFError(w, r)
 			return
 		}
 
@@ -166,71 +282,56 @@ func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
 		if pluginName == "" {
 			pluginName = s.cfg.DefaultProv
 		}
-		p, err := s.reg.Get(pluginName)
+
+		req, err := s.hyd.GetLoginRequest(ch)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			s.renderError(w, r, err, nil)
 			return
 		}
 
-		ctx, cancel := s.ctx(r)
-		defer cancel()
-
-		res, err := p.Authenticate(ctx, plugins.Credentials{
+		res, err := s.authenticate(r, req.Client, pluginName, plugins.Credentials{
 			Username: r.Form.Get("username"),
 			Password: r.Form.Get("password"),
 		})
 		if err != nil {
-			req, _ := s.hyd.GetLoginRequest(ch)
+			if classifyError(err) == errKindBadRequest {
+				s.renderError(w, r, err, &req.Client)
+				return
+			}
+			if _, ok := s.passwordChanger(pluginName); ok && errors.Is(err, plugins.ErrPasswordExpired) {
+				http.Redirect(w, r, s.startPasswordChange(w, req, pluginName, r.Form.Get("username")), http.StatusSeeOther)
+				return
+			}
+			logAuthFailure(pluginName, err)
+			status, _, msg := authFailure(err)
+			s.allowFraming(w, r, req.Client.ClientID)
 			data := loginPageData{
+				pageMeta:       s.meta(r),
 				LoginChallenge: ch,
 				ClientID:       req.Client.ClientID,
 				ClientName:     req.Client.ClientName,
 				Provider:       pluginName,
-				CSRF:           csrfToken(s.cfg.CookieAuth, ch),
-				Error:          "Invalid credentials",
+				LoginHint:      r.Form.Get("username"),
+				CanChoose:      len(s.allowedProviders(req.Client)) > 1,
+				CSRF:           s.issueCSRF(w, r, "login", ch),
+				Error:          msg,
 			}
-			w.WriteHeader(http.StatusUnauthorized)
+			_, data.CanReset = s.passwordResetter(pluginName)
+			_, data.CanRegister = s.registrar(pluginName)
+			w.WriteHeader(status)
 			if err := s.tmplLogin.ExecuteTemplate(w, "layout", data); err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
+				log.Printf("login template render: %v", err)
 			}
 			return
 		}
 
-		// ----- Create / refresh Bridge SSO session cookie (SOURCE OF TRUTH) -----
-		ttl := s.cfg.SessionTTL()
-		if ttl <= 0 {
-			ttl = time.Duration(bridgeSessionTTLDays) * 24 * time.Hour
-		}
-		now := time.Now().Unix()
-		sess := bridgeSession{
-			Sub:    res.Subject,
-			Claims: res.Claims,
-			Iat:    now,
-			Exp:    now + int64(ttl.Seconds()),
-		}
-		payload, _ := json.Marshal(sess)
-		signed := s.signCookieValue(payload)
-
-		// name + value + ttl
-		s.setSessionCookie(w, bridgeSessionCookie, signed, ttl)
-
-		// Short-lived cookie for consent UI (optional but handy)
-		s.setUserInfoCookie(w, res.Claims)
-
-		// Accept login in Hydra
-		redir, err := s.hyd.AcceptLoginRequest(ch, hydra.AcceptLoginRequestBody{
-			Subject:     res.Subject, // OIDC sub
-			Remember:    true,
-			RememberFor: int(ttl.Seconds()),
-			Context:     res.Claims,
-		})
+		redir, err := s.finishLogin(w, r, ch, req, pluginName, res)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			s.renderError(w, r, err, &req.Client)
 			return
 		}
 
-		http.Redirect(w, r, redir.RedirectTo, http.StatusFound)
+		http.Redirect(w, r, redir, http.StatusFound)
 
 	default:
 		w.WriteHeader(http.StatusMethodNotAllowed)
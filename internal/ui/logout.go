@@ -0,0 +1,183 @@
+package ui
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/nduyhai/hydra-bridge/internal/hydra"
+)
+
+type logoutPageData struct {
+	pageMeta
+	LogoutChallenge string
+	ClientName      string
+	CSRF            string
+	Cancelled       bool
+	OtherAccounts   bool // offer signing out every account in this browser
+
+	// After sign-out: RP front-channel logout URIs to load in hidden iframes
+	// before moving on to ContinueURL.
+	SignedOut   bool
+	Frames      []string
+	ContinueURL string
+}
+
+// frontChannelFrames builds the OIDC Front-Channel Logout URIs of every
+// client the subject consented to. iss/sid are added when the client asks
+// for them; sid is Hydra's session id, the one RPs saw in their ID tokens.
+func (s *Server) frontChannelFrames(req *hydra.LogoutRequest) (frames, origins []string) {
+	if req.Subject == "" {
+		return nil, nil
+	}
+	sessions, err := s.hyd.ListConsentSessions(req.Subject)
+	if err != nil {
+		log.Printf("logout: list consent sessions sub=%s: %v", req.Subject, err)
+		return nil, nil
+	}
+	seen := map[string]bool{}
+	for _, cs := range sessions {
+		c := cs.ConsentRequest.Client
+		if c.FrontchannelLogoutURI == "" || seen[c.ClientID] {
+			continue
+		}
+		seen[c.ClientID] = true
+		u, err := url.Parse(c.FrontchannelLogoutURI)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") {
+			continue
+		}
+		if c.FrontchannelLogoutSessionRequired {
+			q := u.Query()
+			q.Set("iss", s.cfg.HydraPublic)
+			q.Set("sid", req.SessionID)
+			u.RawQuery = q.Encode()
+		}
+		frames = append(frames, u.String())
+		origins = append(origins, u.Scheme+"://"+u.Host)
+	}
+	return frames, origins
+}
+
+// logoutMatches reports whether the logout request is about sess: same
+// subject, or the bridge session id we gave Hydra when accepting the login.
+// req.SessionID is Hydra's own sid and never equals ours.
+func logoutMatches(req *hydra.LogoutRequest, sess bridgeSession) bool {
+	return (req.Subject != "" && sess.Sub == req.Subject) ||
+		(req.IdentityProviderSessionID != "" && sess.Sid == req.IdentityProviderSessionID)
+}
+
+// allowFrameSources lets this response embed iframes from origins.
+func (s *Server) allowFrameSources(w http.ResponseWriter, origins []string) {
+	if len(origins) == 0 {
+		return
+	}
+	csp := w.Header().Get("Content-Security-Policy")
+	w.Header().Set("Content-Security-Policy", csp+"; frame-src "+strings.Join(origins, " "))
+}
+
+// handleLogout is the target for Hydra's URLS_LOGOUT. GET asks the user to
+// confirm, POST ends the bridge session and accepts (or rejects) the logout.
+func (s *Server) handleLogout(w http.ResponseWriter, r *http.Request) {
+	ch := r.URL.Query().Get("logout_challenge")
+	if r.Method == http.MethodPost {
+		_ = r.ParseForm()
+		if ch == "" {
+			ch = r.Form.Get("logout_challenge")
+		}
+	}
+	if ch == "" {
+		s.renderError(w, r, errBadRequest("The logout request is missing its challenge."), nil)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		req, err := s.hyd.GetLogoutRequest(ch)
+		if err != nil {
+			s.renderError(w, r, err, nil)
+			return
+		}
+		data := logoutPageData{
+			pageMeta:        s.meta(r),
+			LogoutChallenge: ch,
+			CSRF:            s.issueCSRF(w, r, "logout", ch),
+		}
+		if jar := s.readSessions(r); len(jar.Sessions) > 1 {
+			data.OtherAccounts = true
+		}
+		if req.Client != nil {
+			data.ClientName = req.Client.ClientName
+		}
+		if err := s.tmplLogout.ExecuteTemplate(w, "layout", data); err != nil {
+			s.renderError(w, r, err, nil)
+			return
+		}
+
+	case http.MethodPost:
+		if !s.verifyCSRF(r, "logout", ch, r.Form.Get("csrf")) {
+			s.renderCSRFError(w, r)
+			return
+		}
+
+		confirm := r.Form.Get("confirm")
+		if confirm != "yes" && confirm != "all" {
+			if err := s.hyd.RejectLogoutRequest(ch); err != nil {
+				s.renderError(w, r, err, nil)
+				return
+			}
+			data := logoutPageData{pageMeta: s.meta(r), Cancelled: true}
+			if err := s.tmplLogout.ExecuteTemplate(w, "layout", data); err != nil {
+				s.renderError(w, r, err, nil)
+			}
+			return
+		}
+
+		req, err := s.hyd.GetLogoutRequest(ch)
+		if err != nil {
+			s.renderError(w, r, err, nil)
+			return
+		}
+		// Collect front-channel targets before accepting: afterwards Hydra
+		// may already have dropped the consent sessions.
+		frames, origins := s.frontChannelFrames(req)
+
+		// Bridge session is the source of truth, so drop it first. Other
+		// accounts signed in in this browser are kept unless the user asked
+		// to sign them all out; a logout that names neither a subject nor
+		// one of our sessions removes nothing.
+		jar := s.readSessions(r)
+		for _, sess := range slices.Clone(jar.Sessions) {
+			if confirm == "all" || logoutMatches(req, sess) {
+				jar.remove(sess.Sid)
+			}
+		}
+		s.writeSessions(w, jar)
+
+		// Accepting also makes Hydra send back-channel logout tokens.
+		redir, err := s.hyd.AcceptLogoutRequest(ch)
+		if err != nil {
+			s.renderError(w, r, err, nil)
+			return
+		}
+		if len(frames) == 0 {
+			http.Redirect(w, r, redir.RedirectTo, http.StatusFound)
+			return
+		}
+
+		s.allowFrameSources(w, origins)
+		data := logoutPageData{
+			pageMeta:    s.meta(r),
+			SignedOut:   true,
+			Frames:      frames,
+			ContinueURL: redir.RedirectTo,
+		}
+		if err := s.tmplLogout.ExecuteTemplate(w, "layout", data); err != nil {
+			log.Printf("logout template render: %v", err)
+		}
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
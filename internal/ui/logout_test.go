@@ -0,0 +1,31 @@
+package ui
+
+import (
+	"testing"
+
+	"github.com/nduyhai/hydra-bridge/internal/hydra"
+)
+
+func TestLogoutMatches(t *testing.T) {
+	sess := bridgeSession{Sub: "u1", Sid: "bridge-sid"}
+
+	tests := []struct {
+		name string
+		req  hydra.LogoutRequest
+		want bool
+	}{
+		{name: "same subject", req: hydra.LogoutRequest{Subject: "u1"}, want: true},
+		{name: "other subject", req: hydra.LogoutRequest{Subject: "u2"}},
+		{name: "bridge session id", req: hydra.LogoutRequest{IdentityProviderSessionID: "bridge-sid"}, want: true},
+		{name: "other bridge session", req: hydra.LogoutRequest{IdentityProviderSessionID: "other"}},
+		{name: "hydra sid is not ours", req: hydra.LogoutRequest{SessionID: "bridge-sid"}},
+		{name: "nothing named", req: hydra.LogoutRequest{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := logoutMatches(&tt.req, sess); got != tt.want {
+				t.Errorf("logoutMatches = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package ui
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"log"
+	"net/http"
+	netmail "net/mail"
+	"net/url"
+	"strings"
+
+	"github.com/nduyhai/hydra-bridge/internal/hydra"
+	"github.com/nduyhai/hydra-bridge/internal/plugins"
+)
+
+// browserBinding is derived from the per-browser CSRF cookie so a sign-in
+// link only works in the browser that asked for it.
+func (s *Server) browserBinding(cookie string) string {
+	if cookie == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, []byte(s.cfg.CookieAuth))
+	mac.Write([]byte("browser|" + cookie))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// linkSender returns the provider as a LinkSender if it is one.
+func (s *Server) linkSender(provider string) (plugins.LinkSender, bool) {
+	p, err := s.reg.Get(provider)
+	if err != nil {
+		return nil, false
+	}
+	ls, ok := p.(plugins.LinkSender)
+	return ls, ok
+}
+
+func (s *Server) magicCallbackURL(ch, provider string) string {
+	return strings.TrimSuffix(s.cfg.PublicURL, "/") + "/login/magic/callback?" +
+		url.Values{"login_challenge": {ch}, "provider": {provider}}.Encode()
+}
+
+func (s *Server) renderPasswordless(w http.ResponseWriter, r *http.Request, status int, ch string, req *hydra.LoginRequest, provider, email string, sent bool, msg string) {
+	s.allowFraming(w, r, req.Client.ClientID)
+	data := loginPageData{
+		pageMeta:       s.meta(r),
+		LoginChallenge: ch,
+		ClientID:       req.Client.ClientID,
+		ClientName:     req.Client.ClientName,
+		Provider:       provider,
+		LoginHint:      email,
+		CanChoose:      len(s.allowedProviders(req.Client)) > 1,
+		Passwordless:   true,
+		LinkSent:       sent,
+		CSRF:           s.issueCSRF(w, r, "login", ch),
+		Error:          msg,
+	}
+	w.WriteHeader(status)
+	if err := s.tmplLogin.ExecuteTemplate(w, "layout", data); err != nil {
+		log.Printf("login template render: %v", err)
+	}
+}
+
+// handleMagicLinkSend emails a sign-in link for the pending login challenge.
+func (s *Server) handleMagicLinkSend(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		s.renderError(w, r, errBadRequest("The submitted form could not be read."), nil)
+		return
+	}
+	ch := r.Form.Get("login_challenge")
+	if ch == "" {
+		s.renderError(w, r, errBadRequest("The login request is missing its challenge."), nil)
+		return
+	}
+	if !s.verifyCSRF(r, "login", ch, r.Form.Get("csrf")) {
+		s.renderCSRFError(w, r)
+		return
+	}
+	req, err := s.hyd.GetLoginRequest(ch)
+	if err != nil {
+		s.renderError(w, r, err, nil)
+		return
+	}
+
+	provider := r.Form.Get("provider")
+	ls, ok := s.linkSender(provider)
+	if !ok || !s.providerAllowed(req.Client, provider) {
+		s.renderError(w, r, errBadRequest("The selected sign-in provider is not available."), &req.Client)
+		return
+	}
+
+	email := strings.TrimSpace(r.Form.Get("email"))
+	addr, err := netmail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		s.renderPasswordless(w, r, http.StatusBadRequest, ch, req, provider, email, false, "Please enter a valid email address.")
+		return
+	}
+
+	ctx, cancel := s.ctx(r)
+	defer cancel()
+	err = ls.SendLink(ctx, plugins.LinkRequest{
+		Email:       addr.Address,
+		Challenge:   ch,
+		Binding:     s.browserBinding(s.csrfCookieValue(w, r)),
+		CallbackURL: s.magicCallbackURL(ch, provider),
+	})
+	switch {
+	case errors.Is(err, plugins.ErrLinkThrottled):
+		s.renderPasswordless(w, r, http.StatusTooManyRequests, ch, req, provider, email, true, "We just sent you a link. Please wait a minute before asking for another one.")
+		return
+	case errors.Is(err, plugins.ErrUnavailable):
+		log.Printf("magic-link: send failed: %v", err)
+		_, _, msg := authFailure(err)
+		s.renderPasswordless(w, r, http.StatusServiceUnavailable, ch, req, provider, email, false, msg)
+		return
+	case err != nil:
+		s.renderError(w, r, err, &req.Client)
+		return
+	}
+	s.renderPasswordless(w, r, http.StatusOK, ch, req, provider, email, true, "")
+}
+
+// handleMagicLinkCallback is where the emailed link lands. It resumes the
+// Hydra login challenge the link was issued for.
+func (s *Server) handleMagicLinkCallback(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	ch, provider, token := q.Get("login_challenge"), q.Get("provider"), q.Get("token")
+	if ch == "" || token == "" {
+		s.renderError(w, r, errBadRequest("This sign-in link is incomplete."), nil)
+		return
+	}
+	req, err := s.hyd.GetLoginRequest(ch)
+	if err != nil {
+		s.renderError(w, r, err, nil)
+		return
+	}
+	if _, ok := s.linkSender(provider); !ok {
+		s.renderError(w, r, errBadRequest("The selected sign-in provider is not available."), &req.Client)
+		return
+	}
+
+	var cookie string
+	if c, err := r.Cookie(csrfCookie); err == nil {
+		cookie = c.Value
+	}
+	res, err := s.authenticate(r, req.Client, provider, plugins.Credentials{
+		Token:     token,
+		Challenge: ch,
+		Binding:   s.browserBinding(cookie),
+	})
+	if err != nil {
+		if classifyError(err) == errKindBadRequest {
+			s.renderError(w, r, err, &req.Client)
+			return
+		}
+		log.Printf("magic-link: callback rejected: %v", err)
+		s.renderError(w, r, errBadRequest("This sign-in link is invalid, has expired or was already used. "+
+			"Links only work in the browser where you requested them; please ask for a new one."), &req.Client)
+		return
+	}
+
+	redir, err := s.finishLogin(w, r, ch, req, provider, res)
+	if err != nil {
+		s.renderError(w, r, err, &req.Client)
+		return
+	}
+	http.Redirect(w, r, redir, http.StatusFound)
+}
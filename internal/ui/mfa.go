@@ -0,0 +1,362 @@
+package ui
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/nduyhai/hydra-bridge/internal/otp"
+	"github.com/nduyhai/hydra-bridge/internal/plugins"
+	"github.com/nduyhai/hydra-bridge/internal/policy"
+)
+
+const (
+	pendingLoginCookie = "__bridge_pending" // primary auth done, waiting for another step
+	pendingLoginTTL    = 10 * time.Minute
+)
+
+// pendingLogin is the signed state between the password step and any
+// follow-up step (second factor etc.). It is bound to one login challenge.
+type pendingLogin struct {
+	Challenge string                 `json:"ch"`
+	Provider  string                 `json:"prov"`
+	Sub       string                 `json:"sub"`
+	Claims    map[string]interface{} `json:"claims,omitempty"`
+	AMR       []string               `json:"amr,omitempty"`
+	Factor    string                 `json:"factor,omitempty"` // second factor picked on the MFA page
+	Session   string                 `json:"sid,omitempty"`    // bridge session an SSO login reuses
+	Stage     string                 `json:"stage"`            // step the login is parked at; see stageMFA
+	Exp       int64                  `json:"exp"`
+}
+
+// Steps a login can be parked at. Each page only resumes logins parked at
+// its own step, so the terms page can't be used to skip the second factor.
+const (
+	stageMFA   = "mfa"
+	stageTerms = "terms"
+)
+
+func (p *pendingLogin) authResult() *plugins.AuthResult {
+	return &plugins.AuthResult{Subject: p.Sub, Claims: p.Claims, AMR: p.AMR}
+}
+
+// mfaFactor is one way to pass the second step.
+type mfaFactor struct {
+	ID    string // "totp", "email" or "sms"
+	Label string
+	Hint  string // masked destination for codes we send
+}
+
+type mfaPageData struct {
+	pageMeta
+	LoginChallenge string
+	ClientName     string
+	Factors        []mfaFactor // shown when no factor is picked yet
+	Factor         *mfaFactor
+	CanSwitch      bool
+	CSRF           string
+	Error          string
+}
+
+func (s *Server) setPendingLogin(w http.ResponseWriter, p pendingLogin) {
+	p.Exp = time.Now().Add(pendingLoginTTL).Unix()
+	payload, _ := json.Marshal(p)
+	s.setShortCookie(w, pendingLoginCookie, s.signCookieValue(payload), int(pendingLoginTTL.Seconds()))
+}
+
+func (s *Server) readPendingLogin(r *http.Request, ch, stage string) (*pendingLogin, bool) {
+	c, err := r.Cookie(pendingLoginCookie)
+	if err != nil || c.Value == "" {
+		return nil, false
+	}
+	payload, ok := s.verifyCookieValue(c.Value)
+	if !ok {
+		return nil, false
+	}
+	var p pendingLogin
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return nil, false
+	}
+	if p.Challenge != ch || p.Stage != stage || time.Now().Unix() > p.Exp || p.Sub == "" {
+		return nil, false
+	}
+	return &p, true
+}
+
+func mfaURL(ch string) string {
+	return "/login/mfa?" + url.Values{"login_challenge": {ch}}.Encode()
+}
+
+// otpDestination is where a code for ch can go, from the user's claims.
+// Addresses the backend marked unverified are skipped.
+func otpDestination(claims map[string]interface{}, ch otp.Channel) string {
+	addrClaim, verifiedClaim := "email", "email_verified"
+	if ch == otp.SMS {
+		addrClaim, verifiedClaim = "phone_number", "phone_number_verified"
+	}
+	if v, ok := claims[verifiedClaim].(bool); ok && !v {
+		return ""
+	}
+	addr, _ := claims[addrClaim].(string)
+	return addr
+}
+
+func maskEmail(e string) string {
+	local, domain, ok := strings.Cut(e, "@")
+	if !ok || local == "" {
+		return "your email"
+	}
+	r, _ := utf8.DecodeRuneInString(local)
+	return string(r) + "•••@" + domain
+}
+
+func maskPhone(p string) string {
+	if len(p) <= 4 {
+		return "your phone"
+	}
+	return "•••" + p[len(p)-4:]
+}
+
+// mfaFactors lists the second factors available for this user: TOTP when
+// the provider can verify it, and emailed/texted codes when a transport is
+// configured and the claims carry an address.
+func (s *Server) mfaFactors(provider string, claims map[string]interface{}) []mfaFactor {
+	var out []mfaFactor
+	if p, err := s.reg.Get(provider); err == nil {
+		if _, ok := p.(plugins.TOTPVerifier); ok {
+			out = append(out, mfaFactor{ID: "totp", Label: "Use your authenticator app"})
+		}
+	}
+	if to := otpDestination(claims, otp.Email); to != "" && s.otp.Has(otp.Email) {
+		out = append(out, mfaFactor{ID: string(otp.Email), Label: "Email me a code", Hint: maskEmail(to)})
+	}
+	if to := otpDestination(claims, otp.SMS); to != "" && s.otp.Has(otp.SMS) {
+		out = append(out, mfaFactor{ID: string(otp.SMS), Label: "Text me a code", Hint: maskPhone(to)})
+	}
+	return out
+}
+
+func findFactor(factors []mfaFactor, id string) *mfaFactor {
+	for i := range factors {
+		if factors[i].ID == id {
+			return &factors[i]
+		}
+	}
+	return nil
+}
+
+// startMFA parks the login and sends the user to the second-factor page.
+// If the user has no usable second factor the login is rejected, since the
+// policy demands one.
+func (s *Server) startMFA(w http.ResponseWriter, ch, provider string, res *plugins.AuthResult) (string, error) {
+	if len(s.mfaFactors(provider, res.Claims)) > 0 {
+		s.setPendingLogin(w, pendingLogin{
+			Challenge: ch,
+			Provider:  provider,
+			Sub:       res.Subject,
+			Claims:    res.Claims,
+			AMR:       res.AMR,
+			Stage:     stageMFA,
+		})
+		return mfaURL(ch), nil
+	}
+	return s.rejectLogin(ch, policy.Decision{
+		Error:       "access_denied",
+		Description: "Multi-factor authentication is required but not available for this account.",
+	})
+}
+
+// pickFactor records the chosen factor and, for sent codes, sends one.
+func (s *Server) pickFactor(ctx context.Context, w http.ResponseWriter, p *pendingLogin, f *mfaFactor) error {
+	p.Factor = f.ID
+	s.setPendingLogin(w, *p)
+	if f.ID == "totp" {
+		return nil
+	}
+	ch := otp.Channel(f.ID)
+	return s.otp.Send(ctx, p.Challenge, ch, otpDestination(p.Claims, ch))
+}
+
+func (s *Server) handleMFA(w http.ResponseWriter, r *http.Request) {
+	ch := r.URL.Query().Get("login_challenge")
+	if ch == "" {
+		s.renderError(w, r, errBadRequest("The login request is missing its challenge."), nil)
+		return
+	}
+	pending, ok := s.readPendingLogin(r, ch, stageMFA)
+	if !ok {
+		s.renderError(w, r, errBadRequest("Your sign-in took too long. Please start again."), nil)
+		return
+	}
+	req, err := s.hyd.GetLoginRequest(ch)
+	if err != nil {
+		s.renderError(w, r, err, nil)
+		return
+	}
+	factors := s.mfaFactors(pending.Provider, pending.Claims)
+
+	render := func(status int, msg string) {
+		s.allowFraming(w, r, req.Client.ClientID)
+		data := mfaPageData{
+			pageMeta:       s.meta(r),
+			LoginChallenge: ch,
+			ClientName:     req.Client.ClientName,
+			Factor:         findFactor(factors, pending.Factor),
+			CanSwitch:      len(factors) > 1,
+			CSRF:           s.issueCSRF(w, r, "mfa", ch),
+			Error:          msg,
+		}
+		if data.Factor == nil {
+			data.Factors = factors
+		}
+		w.WriteHeader(status)
+		if err := s.tmplMFA.ExecuteTemplate(w, "layout", data); err != nil {
+			log.Printf("mfa template render: %v", err)
+		}
+	}
+
+	ctx, cancel := s.ctx(r)
+	defer cancel()
+
+	// sendFailed renders the outcome of sending a code; it reports whether
+	// the page was already written.
+	sendFailed := func(err error) bool {
+		switch {
+		case err == nil:
+			return false
+		case errors.Is(err, otp.ErrThrottled):
+			render(http.StatusTooManyRequests, "A code was just sent. Please wait a moment before asking for another one.")
+		default:
+			log.Printf("mfa: send code sub=%s: %v", pending.Sub, err)
+			render(http.StatusBadGateway, "We couldn't send your code. Please try again or use another method.")
+		}
+		return true
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		if r.URL.Query().Get("switch") != "" {
+			pending.Factor = ""
+		} else if pending.Factor == "" && len(factors) == 1 {
+			if sendFailed(s.pickFactor(ctx, w, pending, &factors[0])) {
+				return
+			}
+		}
+		render(http.StatusOK, "")
+
+	case http.MethodPost:
+		if err := r.ParseForm(); err != nil {
+			s.renderError(w, r, errBadRequest("The submitted form could not be read."), nil)
+			return
+		}
+		if !s.verifyCSRF(r, "mfa", ch, r.Form.Get("csrf")) {
+			s.renderCSRFError(w, r)
+			return
+		}
+
+		// picking a factor, or asking for the code again
+		if id := r.Form.Get("factor"); id != "" {
+			f := findFactor(factors, id)
+			if f == nil {
+				render(http.StatusBadRequest, "That verification method is not available.")
+				return
+			}
+			if sendFailed(s.pickFactor(ctx, w, pending, f)) {
+				return
+			}
+			render(http.StatusOK, "")
+			return
+		}
+
+		if findFactor(factors, pending.Factor) == nil {
+			render(http.StatusBadRequest, "Choose how you want to verify.")
+			return
+		}
+		code := strings.TrimSpace(r.Form.Get("code"))
+		var amr []string
+		switch pending.Factor {
+		case "totp":
+			p, err := s.reg.Get(pending.Provider)
+			if err != nil {
+				s.renderError(w, r, err, &req.Client)
+				return
+			}
+			tv, ok := p.(plugins.TOTPVerifier)
+			if !ok {
+				s.renderError(w, r, errBadRequest("This sign-in method does not support a second factor."), &req.Client)
+				return
+			}
+			// Counted per subject, not per challenge: a fresh login must
+			// not buy another round of guesses.
+			key := lockKey("totp|"+pending.Provider, pending.Sub)
+			tooMany := func() {
+				s.deleteCookie(w, pendingLoginCookie)
+				s.renderError(w, r, errBadRequest("Too many incorrect codes. Please sign in again later."), &req.Client)
+			}
+			if s.totpLock.locked(key) {
+				tooMany()
+				return
+			}
+			if err := tv.VerifyTOTP(ctx, pending.Sub, code); err != nil {
+				log.Printf("mfa: verify failed sub=%s: %v", pending.Sub, err)
+				if errors.Is(err, plugins.ErrUnavailable) {
+					render(http.StatusServiceUnavailable, "We couldn't check your code right now. Please try again in a moment.")
+					return
+				}
+				if s.totpLock.fail(key) {
+					log.Printf("mfa: too many wrong TOTP codes sub=%s", pending.Sub)
+					tooMany()
+					return
+				}
+				render(http.StatusUnauthorized, "Invalid code")
+				return
+			}
+			s.totpLock.reset(key)
+			amr = []string{"otp", "mfa"}
+
+		case string(otp.Email), string(otp.SMS):
+			err := s.otp.Verify(ch, code)
+			switch {
+			case errors.Is(err, otp.ErrTooManyAttempts):
+				s.deleteCookie(w, pendingLoginCookie)
+				s.renderError(w, r, errBadRequest("Too many incorrect codes. Please sign in again."), &req.Client)
+				return
+			case errors.Is(err, otp.ErrNoCode):
+				render(http.StatusUnauthorized, "This code has expired. Send a new one.")
+				return
+			case err != nil:
+				log.Printf("mfa: verify failed sub=%s: %v", pending.Sub, err)
+				render(http.StatusUnauthorized, "Invalid code")
+				return
+			}
+			amr = []string{"otp", "mfa"}
+			if pending.Factor == string(otp.SMS) {
+				amr = []string{"sms", "mfa"}
+			}
+
+		default:
+			render(http.StatusBadRequest, "Choose how you want to verify.")
+			return
+		}
+
+		res := pending.authResult()
+		res.AMR = append(res.AMR, amr...)
+		s.deleteCookie(w, pendingLoginCookie)
+
+		redir, err := s.completeLogin(w, r, ch, req, pending.Provider, res)
+		if err != nil {
+			s.renderError(w, r, err, &req.Client)
+			return
+		}
+		http.Redirect(w, r, redir, http.StatusFound)
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
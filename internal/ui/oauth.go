@@ -0,0 +1,168 @@
+package ui
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/nduyhai/hydra-bridge/internal/plugins"
+)
+
+const (
+	oauthStateCookie = "__bridge_oauth"
+	oauthStateTTL    = 10 * time.Minute
+)
+
+// oauthState is the signed round-trip state of a social login: which login
+// challenge it belongs to, the state parameter and the PKCE verifier.
+// Account-page round-trips (linking, re-authentication) carry no challenge
+// but the bridge session they act on.
+type oauthState struct {
+	Challenge string `json:"ch,omitempty"`
+	Purpose   string `json:"purpose,omitempty"` // "", purposeLink or purposeReauth
+	Sid       string `json:"sid,omitempty"`
+	Next      string `json:"next,omitempty"` // provider to link after re-authentication
+	Provider  string `json:"prov"`
+	State     string `json:"state"`
+	Verifier  string `json:"cv"`
+	Exp       int64  `json:"exp"`
+}
+
+// redirector returns the provider as a Redirector if it is one.
+func (s *Server) redirector(provider string) (plugins.Redirector, bool) {
+	p, err := s.reg.Get(provider)
+	if err != nil {
+		return nil, false
+	}
+	rd, ok := p.(plugins.Redirector)
+	return rd, ok
+}
+
+// OAuthCallbackPath is where upstream providers send the user back; the
+// full URL must be registered with each provider.
+const OAuthCallbackPath = "/login/oauth/callback"
+
+// startOAuth sends the browser to the upstream provider st.Provider.
+func (s *Server) startOAuth(w http.ResponseWriter, r *http.Request, st oauthState, rd plugins.Redirector) {
+	st.State = newSessionID()
+	st.Verifier = newSessionID() + newSessionID() // 43+ chars, RFC 7636 4.1
+	st.Exp = time.Now().Add(oauthStateTTL).Unix()
+	payload, _ := json.Marshal(st)
+
+	// The callback is a cross-site navigation, so the cookie must be at
+	// least Lax even when the bridge is configured with Strict.
+	sameSite := s.cfg.SameSiteMode()
+	if sameSite == http.SameSiteStrictMode {
+		sameSite = http.SameSiteLaxMode
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     oauthStateCookie,
+		Value:    s.signCookieValue(payload),
+		Path:     "/",
+		Domain:   s.cfg.CookieDomain,
+		HttpOnly: true,
+		Secure:   s.cfg.CookieSecure,
+		SameSite: sameSite,
+		MaxAge:   int(oauthStateTTL.Seconds()),
+	})
+
+	sum := sha256.Sum256([]byte(st.Verifier))
+	http.Redirect(w, r, rd.AuthCodeURL(st.State, base64.RawURLEncoding.EncodeToString(sum[:])), http.StatusFound)
+}
+
+func (s *Server) readOAuthState(r *http.Request, state string) (*oauthState, bool) {
+	c, err := r.Cookie(oauthStateCookie)
+	if err != nil || c.Value == "" {
+		return nil, false
+	}
+	payload, ok := s.verifyCookieValue(c.Value)
+	if !ok {
+		return nil, false
+	}
+	var st oauthState
+	if err := json.Unmarshal(payload, &st); err != nil {
+		return nil, false
+	}
+	if time.Now().Unix() > st.Exp || subtle.ConstantTimeCompare([]byte(st.State), []byte(state)) != 1 {
+		return nil, false
+	}
+	return &st, true
+}
+
+// handleOAuthCallback finishes a social login and resumes the Hydra login
+// challenge it was started for.
+func (s *Server) handleOAuthCallback(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	st, ok := s.readOAuthState(r, q.Get("state"))
+	if !ok {
+		s.renderError(w, r, errBadRequest("This sign-in attempt has expired or was started in another browser. Please start again."), nil)
+		return
+	}
+	s.deleteCookie(w, oauthStateCookie) // one use
+	if st.Purpose != "" {
+		s.finishAccountOAuth(w, r, st)
+		return
+	}
+
+	req, err := s.hyd.GetLoginRequest(st.Challenge)
+	if err != nil {
+		s.renderError(w, r, err, nil)
+		return
+	}
+
+	if e := q.Get("error"); e != "" {
+		log.Printf("oauth: provider=%s returned error=%s: %s", st.Provider, e, q.Get("error_description"))
+		msg := "Sign-in was cancelled or failed. Choose a way to continue."
+		s.renderProviderChooser(w, r, st.Challenge, req, "", msg)
+		return
+	}
+	code := q.Get("code")
+	if code == "" {
+		s.renderError(w, r, errBadRequest("The provider did not return an authorization code."), &req.Client)
+		return
+	}
+
+	res, err := s.authenticate(r, req.Client, st.Provider, plugins.Credentials{
+		Token:    code,
+		Verifier: st.Verifier,
+	})
+	if err != nil {
+		if classifyError(err) == errKindBadRequest {
+			s.renderError(w, r, err, &req.Client)
+			return
+		}
+		log.Printf("oauth: provider=%s sign-in rejected: %v", st.Provider, err)
+		msg := "We could not sign you in with " + s.providerLabel(st.Provider) + "."
+		if errors.Is(err, plugins.ErrUnavailable) {
+			_, _, msg = authFailure(err)
+		}
+		s.renderProviderChooser(w, r, st.Challenge, req, "", msg)
+		return
+	}
+
+	redir, err := s.finishLogin(w, r, st.Challenge, req, st.Provider, res)
+	if err != nil {
+		s.renderError(w, r, err, &req.Client)
+		return
+	}
+	http.Redirect(w, r, redir, http.StatusFound)
+}
+
+// providerLabel is the provider's display name, falling back to its id.
+func (s *Server) providerLabel(provider string) string {
+	if p, err := s.reg.Get(provider); err == nil {
+		if d, ok := p.(plugins.Describer); ok && d.DisplayName() != "" {
+			return d.DisplayName()
+		}
+	}
+	return provider
+}
@@ -0,0 +1,221 @@
+package ui
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	netmail "net/mail"
+	"net/url"
+	"time"
+
+	"github.com/nduyhai/hydra-bridge/internal/hydra"
+	"github.com/nduyhai/hydra-bridge/internal/plugins"
+)
+
+const (
+	passwordChangeCookie = "__bridge_pwchange"
+	passwordChangeTTL    = 10 * time.Minute
+)
+
+// passwordChange is the signed state of a forced password change: who has
+// to change it and which login challenge to resume afterwards. The old
+// password is not kept; the user types it again.
+type passwordChange struct {
+	Challenge string `json:"ch"`
+	Provider  string `json:"prov"`
+	Username  string `json:"user"`
+	Email     string `json:"email,omitempty"` // also kept out of the new password
+	Exp       int64  `json:"exp"`
+}
+
+type passwordPageData struct {
+	pageMeta
+	LoginChallenge string
+	ClientName     string
+	Username       string
+	Rules          []string
+	Problems       []string
+	CSRF           string
+	Error          string
+}
+
+// passwordChanger returns the provider as a PasswordChanger if it is one.
+func (s *Server) passwordChanger(provider string) (plugins.PasswordChanger, bool) {
+	p, err := s.reg.Get(provider)
+	if err != nil {
+		return nil, false
+	}
+	pc, ok := p.(plugins.PasswordChanger)
+	return pc, ok
+}
+
+func passwordURL(ch string) string {
+	return "/login/password?" + url.Values{"login_challenge": {ch}}.Encode()
+}
+
+// startPasswordChange remembers who must change their password and returns
+// the page to send them to.
+func (s *Server) startPasswordChange(w http.ResponseWriter, req *hydra.LoginRequest, provider, username string) string {
+	payload, _ := json.Marshal(passwordChange{
+		Challenge: req.Challenge,
+		Provider:  provider,
+		Username:  username,
+		Email:     hintedEmail(req),
+		Exp:       time.Now().Add(passwordChangeTTL).Unix(),
+	})
+	s.setShortCookie(w, passwordChangeCookie, s.signCookieValue(payload), int(passwordChangeTTL.Seconds()))
+	return passwordURL(req.Challenge)
+}
+
+// hintedEmail is the address the client named in login_hint, if any. The
+// sign-in failed, so there are no claims yet; this is the only email we
+// may know besides the username.
+func hintedEmail(req *hydra.LoginRequest) string {
+	a, err := netmail.ParseAddress(req.OIDCContext.LoginHint)
+	if err != nil {
+		return ""
+	}
+	return a.Address
+}
+
+func (s *Server) readPasswordChange(r *http.Request, ch string) (*passwordChange, bool) {
+	c, err := r.Cookie(passwordChangeCookie)
+	if err != nil || c.Value == "" {
+		return nil, false
+	}
+	payload, ok := s.verifyCookieValue(c.Value)
+	if !ok {
+		return nil, false
+	}
+	var pc passwordChange
+	if err := json.Unmarshal(payload, &pc); err != nil {
+		return nil, false
+	}
+	if pc.Challenge != ch || time.Now().Unix() > pc.Exp || pc.Username == "" {
+		return nil, false
+	}
+	return &pc, true
+}
+
+func (s *Server) renderPassword(w http.ResponseWriter, r *http.Request, status int, ch, clientName, username string, problems []string, msg string) {
+	w.Header().Set("Cache-Control", "no-store")
+	data := passwordPageData{
+		pageMeta:       s.meta(r),
+		LoginChallenge: ch,
+		ClientName:     clientName,
+		Username:       username,
+		Rules:          s.cfg.PasswordPolicy.Rules(),
+		Problems:       problems,
+		CSRF:           s.issueCSRF(w, r, "password", ch),
+		Error:          msg,
+	}
+	w.WriteHeader(status)
+	if err := s.tmplPassword.ExecuteTemplate(w, "layout", data); err != nil {
+		log.Printf("password template render: %v", err)
+	}
+}
+
+// handlePasswordChange is the change-password step of the login flow. It
+// is reached when a plugin reports ErrPasswordExpired and resumes the Hydra
+// login challenge once the backend accepted the new password.
+func (s *Server) handlePasswordChange(w http.ResponseWriter, r *http.Request) {
+	ch := r.URL.Query().Get("login_challenge")
+	if ch == "" {
+		s.renderError(w, r, errBadRequest("The login request is missing its challenge."), nil)
+		return
+	}
+	pc, ok := s.readPasswordChange(r, ch)
+	if !ok {
+		s.renderError(w, r, errBadRequest("Your password change session expired. Please sign in again."), nil)
+		return
+	}
+	req, err := s.hyd.GetLoginRequest(ch)
+	if err != nil {
+		s.renderError(w, r, err, nil)
+		return
+	}
+	pcr, ok := s.passwordChanger(pc.Provider)
+	if !ok || !s.providerAllowed(req.Client, pc.Provider) {
+		s.renderError(w, r, errBadRequest("The selected sign-in provider is not available."), &req.Client)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		s.renderPassword(w, r, http.StatusOK, ch, req.Client.ClientName, pc.Username, nil, "")
+
+	case http.MethodPost:
+		if err := r.ParseForm(); err != nil {
+			s.renderError(w, r, errBadRequest("The submitted form could not be read."), nil)
+			return
+		}
+		if !s.verifyCSRF(r, "password", ch, r.Form.Get("csrf")) {
+			s.renderCSRFError(w, r)
+			return
+		}
+		current, next := r.Form.Get("current_password"), r.Form.Get("new_password")
+		render := func(status int, problems []string, msg string) {
+			s.renderPassword(w, r, status, ch, req.Client.ClientName, pc.Username, problems, msg)
+		}
+
+		if next != r.Form.Get("confirm_password") {
+			render(http.StatusBadRequest, nil, "The new passwords don't match.")
+			return
+		}
+		if next == current {
+			render(http.StatusBadRequest, nil, "Choose a password different from your current one.")
+			return
+		}
+		if problems := s.cfg.PasswordPolicy.Check(next, pc.Username, pc.Email); len(problems) > 0 {
+			render(http.StatusBadRequest, problems, "")
+			return
+		}
+
+		key := lockKey(pc.Provider, pc.Username)
+		if s.lock.locked(key) {
+			_, _, msg := authFailure(errBridgeLocked)
+			render(http.StatusLocked, nil, msg)
+			return
+		}
+		ctx, cancel := s.ctx(r)
+		defer cancel()
+		err := pcr.ChangePassword(ctx, plugins.PasswordChange{
+			Username:    pc.Username,
+			OldPassword: current,
+			NewPassword: next,
+		})
+		if err != nil {
+			logAuthFailure(pc.Provider, err)
+			status, _, msg := authFailure(err)
+			if errors.Is(err, plugins.ErrInvalidCredentials) {
+				s.lock.fail(key)
+				msg = "Your current password is incorrect."
+			}
+			render(status, nil, msg)
+			return
+		}
+		s.lock.reset(key)
+		s.deleteCookie(w, passwordChangeCookie)
+		log.Printf("password: provider=%s user=%q changed an expired password", pc.Provider, pc.Username)
+
+		res, err := s.authenticate(r, req.Client, pc.Provider, plugins.Credentials{
+			Username: pc.Username,
+			Password: next,
+		})
+		if err != nil {
+			logAuthFailure(pc.Provider, err)
+			s.renderError(w, r, errBadRequest("Your password was changed, but signing in failed. Please sign in with your new password."), &req.Client)
+			return
+		}
+		redir, err := s.finishLogin(w, r, ch, req, pc.Provider, res)
+		if err != nil {
+			s.renderError(w, r, err, &req.Client)
+			return
+		}
+		http.Redirect(w, r, redir, http.StatusFound)
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
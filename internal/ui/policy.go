@@ -0,0 +1,166 @@
+package ui
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/nduyhai/hydra-bridge/internal/hooks"
+	"github.com/nduyhai/hydra-bridge/internal/hydra"
+	"github.com/nduyhai/hydra-bridge/internal/plugins"
+	"github.com/nduyhai/hydra-bridge/internal/policy"
+)
+
+func (s *Server) policyFor(c hydra.Client) policy.Policy {
+	return s.policies.For(c.ClientID, c.Metadata)
+}
+
+// requestedACR returns the client's acr_values. Hydra normally hands them
+// over in oidc_context; otherwise they are read from the original request.
+func requestedACR(req *hydra.LoginRequest) []string {
+	if len(req.OIDCContext.ACRValues) > 0 {
+		return req.OIDCContext.ACRValues
+	}
+	u, err := url.Parse(req.RequestURL)
+	if err != nil {
+		return nil
+	}
+	return strings.Fields(u.Query().Get("acr_values"))
+}
+
+// rejectLogin sends the policy's OAuth2 error back to the client via Hydra.
+func (s *Server) rejectLogin(ch string, d policy.Decision) (string, error) {
+	redir, err := s.hyd.RejectLoginRequest(ch, hydra.RejectRequestBody{
+		Error:            d.Error,
+		ErrorDescription: d.Description,
+		StatusCode:       http.StatusForbidden,
+	})
+	if err != nil {
+		return "", err
+	}
+	return redir.RedirectTo, nil
+}
+
+// hookDecision turns a hook's deny into the policy shape rejectLogin takes.
+func hookDecision(hr hooks.Result) policy.Decision {
+	return policy.Decision{Error: hr.Error, Description: hr.Description}
+}
+
+// finishLogin is where every fresh authentication ends up: it runs the
+// after_authenticate hooks and continues with completeLogin. It returns
+// where to send the browser next.
+func (s *Server) finishLogin(w http.ResponseWriter, r *http.Request, ch string, req *hydra.LoginRequest, provider string, res *plugins.AuthResult) (string, error) {
+	hr, err := s.hooks.Run(r.Context(), hooks.Request{
+		Event:    hooks.AfterAuthenticate,
+		Subject:  res.Subject,
+		ClientID: req.Client.ClientID,
+		Provider: provider,
+		AMR:      res.AMR,
+		Claims:   res.Claims,
+	})
+	if err != nil {
+		return "", err
+	}
+	if hr.Denied {
+		log.Printf("hooks: deny sub=%s client=%s: %s", res.Subject, req.Client.ClientID, hr.Description)
+		return s.rejectLogin(ch, hookDecision(hr))
+	}
+	res.Claims = hr.Claims
+	return s.completeLogin(w, r, ch, req, provider, res)
+}
+
+// completeLogin applies the client's policy and then either rejects, asks
+// for a second factor, or creates the bridge session and accepts the login.
+// The second-factor step comes back here once the code checks out.
+func (s *Server) completeLogin(w http.ResponseWriter, r *http.Request, ch string, req *hydra.LoginRequest, provider string, res *plugins.AuthResult) (string, error) {
+	dec := s.policyFor(req.Client).Evaluate(policy.Input{Provider: provider, Claims: res.Claims, AMR: res.AMR, ACRValues: requestedACR(req)})
+	if !dec.Allowed {
+		log.Printf("policy: deny sub=%s client=%s: %s", res.Subject, req.Client.ClientID, dec.Description)
+		return s.rejectLogin(ch, dec)
+	}
+	if dec.NeedMFA {
+		return s.startMFA(w, ch, provider, res)
+	}
+
+	hr, err := s.beforeAcceptLogin(r, req, provider, res)
+	if err != nil {
+		return "", err
+	}
+	if hr.Denied {
+		return s.rejectLogin(ch, hookDecision(hr))
+	}
+	res.Claims = hr.Claims
+
+	if redir, ok, err := s.termsGate(w, r, ch, req, provider, res, ""); err != nil || ok {
+		return redir, err
+	}
+
+	redir, err := s.acceptLogin(w, r, ch, provider, res)
+	if err != nil {
+		return "", err
+	}
+	return redir.RedirectTo, nil
+}
+
+// finishSSO is finishLogin for an existing bridge session. usable is false
+// when the session is too old for this client and the user must log in again.
+func (s *Server) finishSSO(w http.ResponseWriter, r *http.Request, ch string, req *hydra.LoginRequest, sess *bridgeSession) (redirectTo string, usable bool, err error) {
+	// Hydra already remembers a subject for this browser and will only
+	// accept that one.
+	if req.Skip && req.Subject != "" && req.Subject != sess.Sub {
+		return "", true, errBadRequest("This application is already signed in with another account in this browser. Sign out of it first to switch accounts.")
+	}
+	pol := s.policyFor(req.Client)
+	if !pol.SessionUsable(sess.Iat, time.Now()) {
+		return "", false, nil
+	}
+
+	res := sess.authResult()
+	dec := pol.Evaluate(policy.Input{Provider: sess.Provider, Claims: sess.Claims, AMR: sess.AMR, ACRValues: requestedACR(req)})
+	if !dec.Allowed {
+		redir, err := s.rejectLogin(ch, dec)
+		return redir, true, err
+	}
+	if dec.NeedMFA {
+		// step up the existing session (policy or acr_values) instead of
+		// asking for the password again
+		redir, err := s.startMFA(w, ch, sess.Provider, res)
+		return redir, true, err
+	}
+
+	hr, err := s.beforeAcceptLogin(r, req, sess.Provider, res)
+	if err != nil {
+		return "", true, err
+	}
+	if hr.Denied {
+		redir, err := s.rejectLogin(ch, hookDecision(hr))
+		return redir, true, err
+	}
+	// patches apply to this login only; the stored session keeps its claims
+	patched := *sess
+	patched.Claims = hr.Claims
+
+	res.Claims = hr.Claims
+	if redir, ok, err := s.termsGate(w, r, ch, req, sess.Provider, res, sess.Sid); err != nil || ok {
+		return redir, true, err
+	}
+
+	redir, err := s.acceptSSO(w, r, ch, &patched)
+	if err != nil {
+		return "", true, err
+	}
+	return redir.RedirectTo, true, nil
+}
+
+func (s *Server) beforeAcceptLogin(r *http.Request, req *hydra.LoginRequest, provider string, res *plugins.AuthResult) (hooks.Result, error) {
+	return s.hooks.Run(r.Context(), hooks.Request{
+		Event:    hooks.BeforeAcceptLogin,
+		Subject:  res.Subject,
+		ClientID: req.Client.ClientID,
+		Provider: provider,
+		AMR:      res.AMR,
+		Claims:   res.Claims,
+	})
+}
@@ -0,0 +1,181 @@
+package ui
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/nduyhai/hydra-bridge/internal/hydra"
+	"github.com/nduyhai/hydra-bridge/internal/plugins"
+)
+
+type providerOption struct {
+	Name        string
+	DisplayName string
+	IconURL     string
+	Initial     string // fallback badge when there is no icon
+}
+
+type providersPageData struct {
+	pageMeta
+	LoginChallenge string
+	ClientName     string
+	Providers      []providerOption
+	Discovery      bool // show the "continue with email" box
+	LoginHint      string
+	CSRF           string
+	Error          string
+}
+
+// allowedProviders returns the registered plugins this client may use,
+// honouring both CLIENT_PROVIDERS and the client's policy.
+func (s *Server) allowedProviders(client hydra.Client) []plugins.AuthPlugin {
+	all := s.reg.All()
+	allow, restricted := s.cfg.ClientProviders[client.ClientID]
+	pol := s.policyFor(client)
+	out := make([]plugins.AuthPlugin, 0, len(all))
+	for _, p := range all {
+		if restricted && !slices.Contains(allow, p.Name()) {
+			continue
+		}
+		if !pol.ProviderAllowed(p.Name()) {
+			continue
+		}
+		out = append(out, p)
+	}
+	return out
+}
+
+func (s *Server) providerAllowed(client hydra.Client, name string) bool {
+	for _, p := range s.allowedProviders(client) {
+		if p.Name() == name {
+			return true
+		}
+	}
+	return false
+}
+
+func providerOptions(ps []plugins.AuthPlugin) []providerOption {
+	out := make([]providerOption, 0, len(ps))
+	for _, p := range ps {
+		o := providerOption{Name: p.Name(), DisplayName: p.Name()}
+		if d, ok := p.(plugins.Describer); ok {
+			o.DisplayName = d.DisplayName()
+			o.IconURL = d.IconURL()
+		}
+		o.Initial = initial(o.DisplayName)
+		out = append(out, o)
+	}
+	return out
+}
+
+// initial is the upper-cased first letter of s for avatar badges. It works
+// on runes so names that start with a multi-byte letter aren't cut in half.
+func initial(s string) string {
+	r, size := utf8.DecodeRuneInString(s)
+	if size == 0 {
+		return ""
+	}
+	return strings.ToUpper(string(r))
+}
+
+// discoverProvider maps the email's domain (or a parent domain) to a provider.
+func (s *Server) discoverProvider(email string) (string, bool) {
+	_, domain, ok := strings.Cut(strings.ToLower(strings.TrimSpace(email)), "@")
+	if !ok {
+		return "", false
+	}
+	for domain != "" {
+		if p, ok := s.cfg.ProviderDomains[domain]; ok {
+			return p, true
+		}
+		_, domain, _ = strings.Cut(domain, ".")
+	}
+	return "", false
+}
+
+// pickProvider chooses a provider without asking the user, or returns ""
+// when the chooser has to be shown.
+func (s *Server) pickProvider(client hydra.Client, loginHint string) string {
+	if p, ok := s.discoverProvider(loginHint); ok && s.providerAllowed(client, p) {
+		return p
+	}
+	allowed := s.allowedProviders(client)
+	if len(allowed) == 1 {
+		return allowed[0].Name()
+	}
+	return ""
+}
+
+func (s *Server) renderProviderChooser(w http.ResponseWriter, r *http.Request, ch string, req *hydra.LoginRequest, loginHint, errMsg string) {
+	s.allowFraming(w, r, req.Client.ClientID)
+	data := providersPageData{
+		pageMeta:       s.meta(r),
+		LoginChallenge: ch,
+		ClientName:     req.Client.ClientName,
+		Providers:      providerOptions(s.allowedProviders(req.Client)),
+		Discovery:      len(s.cfg.ProviderDomains) > 0,
+		LoginHint:      loginHint,
+		CSRF:           s.issueCSRF(w, r, "discover", ch),
+		Error:          errMsg,
+	}
+	if errMsg != "" {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	if err := s.tmplProviders.ExecuteTemplate(w, "layout", data); err != nil {
+		log.Printf("providers template render: %v", err)
+	}
+}
+
+func loginURL(ch, provider, loginHint string) string {
+	q := url.Values{"login_challenge": {ch}}
+	if provider != "" {
+		q.Set("provider", provider)
+	}
+	if loginHint != "" {
+		q.Set("login_hint", loginHint)
+	}
+	return "/login?" + q.Encode()
+}
+
+// handleDiscover is the home-realm discovery step: the user types an email
+// and we route them to the provider that owns that domain.
+func (s *Server) handleDiscover(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		s.renderError(w, r, errBadRequest("The submitted form could not be read."), nil)
+		return
+	}
+	ch := r.Form.Get("login_challenge")
+	if ch == "" {
+		s.renderError(w, r, errBadRequest("The login request is missing its challenge."), nil)
+		return
+	}
+	if !s.verifyCSRF(r, "discover", ch, r.Form.Get("csrf")) {
+		s.renderCSRFError(w, r)
+		return
+	}
+
+	req, err := s.hyd.GetLoginRequest(ch)
+	if err != nil {
+		s.renderError(w, r, err, nil)
+		return
+	}
+
+	email := strings.TrimSpace(r.Form.Get("email"))
+	provider, ok := s.discoverProvider(email)
+	if !ok {
+		provider = s.cfg.DefaultProv
+	}
+	if !s.providerAllowed(req.Client, provider) {
+		s.renderProviderChooser(w, r, ch, req, email, "We couldn't find a sign-in method for that email. Please pick one below.")
+		return
+	}
+	http.Redirect(w, r, loginURL(ch, provider, email), http.StatusFound)
+}
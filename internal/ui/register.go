@@ -0,0 +1,338 @@
+package ui
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/nduyhai/hydra-bridge/internal/hydra"
+	"github.com/nduyhai/hydra-bridge/internal/identity"
+	"github.com/nduyhai/hydra-bridge/internal/otp"
+	"github.com/nduyhai/hydra-bridge/internal/plugins"
+	"github.com/nduyhai/hydra-bridge/internal/registration"
+)
+
+const (
+	registerCookie = "__bridge_register"
+	registerTTL    = 30 * time.Minute
+)
+
+// registerState is the signed state of a sign-up in progress: the address
+// a code was sent to and whether the code has been entered. Form values
+// are not kept; the details form is submitted in one go.
+type registerState struct {
+	Challenge string `json:"ch"`
+	Provider  string `json:"prov"`
+	Email     string `json:"email"`
+	Verified  bool   `json:"ok,omitempty"`
+	Exp       int64  `json:"exp"`
+}
+
+type registerField struct {
+	registration.Field
+	Value   string
+	Problem string
+}
+
+type registerPageData struct {
+	pageMeta
+	LoginChallenge string
+	ClientName     string
+	Provider       string
+	Details        bool // email is known; show the code and the rest of the form
+	Email          string
+	Verified       bool
+	Fields         []registerField // every field but email
+	Rules          []string
+	Notice         string
+	CSRF           string
+	Error          string
+}
+
+// registrar returns the provider as a Registrar if it is one and sign-up
+// is switched on.
+func (s *Server) registrar(provider string) (plugins.Registrar, bool) {
+	if s.signup == nil {
+		return nil, false
+	}
+	p, err := s.reg.Get(provider)
+	if err != nil {
+		return nil, false
+	}
+	rg, ok := p.(plugins.Registrar)
+	return rg, ok
+}
+
+func registerURL(ch, provider string) string {
+	return "/login/register?" + url.Values{"login_challenge": {ch}, "provider": {provider}}.Encode()
+}
+
+// registerCodeKey keys the emailed code to the login challenge, so one
+// sign-up has at most one live code.
+func registerCodeKey(ch string) string { return "register|" + ch }
+
+func (s *Server) writeRegisterState(w http.ResponseWriter, st registerState) {
+	st.Exp = time.Now().Add(registerTTL).Unix()
+	payload, _ := json.Marshal(st)
+	s.setShortCookie(w, registerCookie, s.signCookieValue(payload), int(registerTTL.Seconds()))
+}
+
+func (s *Server) readRegisterState(r *http.Request, ch, provider string) (*registerState, bool) {
+	c, err := r.Cookie(registerCookie)
+	if err != nil || c.Value == "" {
+		return nil, false
+	}
+	payload, ok := s.verifyCookieValue(c.Value)
+	if !ok {
+		return nil, false
+	}
+	var st registerState
+	if err := json.Unmarshal(payload, &st); err != nil {
+		return nil, false
+	}
+	if st.Challenge != ch || st.Provider != provider || time.Now().Unix() > st.Exp || st.Email == "" {
+		return nil, false
+	}
+	return &st, true
+}
+
+func (s *Server) renderRegister(w http.ResponseWriter, r *http.Request, status int, data registerPageData, values, problems map[string]string) {
+	w.Header().Set("Cache-Control", "no-store")
+	data.pageMeta = s.meta(r)
+	data.Rules = s.cfg.PasswordPolicy.Rules()
+	data.CSRF = s.issueCSRF(w, r, "register", data.LoginChallenge)
+	for _, f := range s.signup.Fields {
+		if f.Type == registration.Email {
+			continue
+		}
+		rf := registerField{Field: f, Value: values[f.Name], Problem: problems[f.Name]}
+		if f.Type == registration.Password {
+			rf.Value = "" // never echoed back
+		}
+		data.Fields = append(data.Fields, rf)
+	}
+	w.WriteHeader(status)
+	if err := s.tmplRegister.ExecuteTemplate(w, "layout", data); err != nil {
+		log.Printf("register template render: %v", err)
+	}
+}
+
+// handleRegister is the sign-up form. It first confirms the email address
+// with an emailed code, then creates the account through the provider's
+// Registrar and resumes the Hydra login challenge as the new user.
+func (s *Server) handleRegister(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	ch, provider := q.Get("login_challenge"), q.Get("provider")
+	if ch == "" {
+		s.renderError(w, r, errBadRequest("The login request is missing its challenge."), nil)
+		return
+	}
+	if provider == "" {
+		provider = s.cfg.DefaultProv
+	}
+	req, err := s.hyd.GetLoginRequest(ch)
+	if err != nil {
+		s.renderError(w, r, err, nil)
+		return
+	}
+	rg, ok := s.registrar(provider)
+	if !ok || !s.providerAllowed(req.Client, provider) {
+		s.renderError(w, r, errBadRequest("Creating an account is not available for this sign-in method."), &req.Client)
+		return
+	}
+	data := registerPageData{LoginChallenge: ch, ClientName: req.Client.ClientName, Provider: provider}
+
+	switch r.Method {
+	case http.MethodGet:
+		if q.Get("restart") != "" {
+			s.signupCodes.Discard(registerCodeKey(ch))
+			s.deleteCookie(w, registerCookie)
+		} else if st, ok := s.readRegisterState(r, ch, provider); ok {
+			data.Details, data.Email, data.Verified = true, st.Email, st.Verified
+			if !st.Verified {
+				data.Notice = "We sent a code to " + st.Email + ". Enter it below with the rest of your details."
+			}
+		}
+		s.renderRegister(w, r, http.StatusOK, data, nil, nil)
+
+	case http.MethodPost:
+		if err := r.ParseForm(); err != nil {
+			s.renderError(w, r, errBadRequest("The submitted form could not be read."), nil)
+			return
+		}
+		if !s.verifyCSRF(r, "register", ch, r.Form.Get("csrf")) {
+			s.renderCSRFError(w, r)
+			return
+		}
+		switch r.Form.Get("step") {
+		case "email":
+			s.registerEmail(w, r, data)
+		case "resend":
+			st, ok := s.readRegisterState(r, ch, provider)
+			if !ok {
+				http.Redirect(w, r, registerURL(ch, provider), http.StatusSeeOther)
+				return
+			}
+			data.Details, data.Email = true, st.Email
+			if msg, status := s.sendRegisterCode(r, ch, st.Email); msg != "" {
+				data.Error = msg
+				s.renderRegister(w, r, status, data, nil, nil)
+				return
+			}
+			data.Notice = "We sent a new code to " + st.Email + "."
+			s.renderRegister(w, r, http.StatusOK, data, nil, nil)
+		case "details":
+			st, ok := s.readRegisterState(r, ch, provider)
+			if !ok {
+				http.Redirect(w, r, registerURL(ch, provider), http.StatusSeeOther)
+				return
+			}
+			s.registerDetails(w, r, data, req, rg, st)
+		default:
+			s.renderError(w, r, errBadRequest("The submitted form could not be read."), &req.Client)
+		}
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// sendRegisterCode mails a verification code and returns a message and
+// status for the user when it could not.
+func (s *Server) sendRegisterCode(r *http.Request, ch, email string) (string, int) {
+	ctx, cancel := s.ctx(r)
+	defer cancel()
+	err := s.signupCodes.Send(ctx, registerCodeKey(ch), otp.Email, email)
+	switch {
+	case errors.Is(err, otp.ErrThrottled):
+		return "We just sent you a code. Please wait a minute before asking for another one.", http.StatusTooManyRequests
+	case err != nil:
+		log.Printf("register: send code failed: %v", err)
+		return "We couldn't send the code right now. Please try again in a moment.", http.StatusServiceUnavailable
+	}
+	return "", 0
+}
+
+// registerEmail checks the address and mails it a code. Whether the
+// address already has an account only shows once the form is submitted,
+// after the code proved the user owns it.
+func (s *Server) registerEmail(w http.ResponseWriter, r *http.Request, data registerPageData) {
+	f, _ := s.signup.Field("email")
+	email := strings.TrimSpace(r.Form.Get("email"))
+	data.Email = email
+	if msg := f.Check(email); msg != "" {
+		data.Error = msg
+		s.renderRegister(w, r, http.StatusBadRequest, data, nil, nil)
+		return
+	}
+	if msg, status := s.sendRegisterCode(r, data.LoginChallenge, email); msg != "" {
+		data.Error = msg
+		s.renderRegister(w, r, status, data, nil, nil)
+		return
+	}
+	s.writeRegisterState(w, registerState{Challenge: data.LoginChallenge, Provider: data.Provider, Email: email})
+	http.Redirect(w, r, registerURL(data.LoginChallenge, data.Provider), http.StatusSeeOther)
+}
+
+func (s *Server) registerDetails(w http.ResponseWriter, r *http.Request, data registerPageData, req *hydra.LoginRequest, rg plugins.Registrar, st *registerState) {
+	data.Details, data.Email, data.Verified = true, st.Email, st.Verified
+
+	values, problems := s.signup.Validate(func(name string) string {
+		if name == "email" {
+			return st.Email
+		}
+		return r.Form.Get(name)
+	})
+	pw := values["password"]
+	if _, bad := problems["password"]; !bad {
+		if pw != r.Form.Get("confirm_password") {
+			problems["password"] = "The passwords don't match."
+		} else if pp := s.cfg.PasswordPolicy.Check(pw, st.Email, values["name"]); len(pp) > 0 {
+			problems["password"] = strings.Join(pp, " ")
+		}
+	}
+	if len(problems) > 0 {
+		data.Error = "Please fix the highlighted fields."
+		s.renderRegister(w, r, http.StatusBadRequest, data, values, problems)
+		return
+	}
+
+	// The code is checked after the form so a typo elsewhere doesn't use
+	// it up; once it matched, the cookie remembers that for retries.
+	if !st.Verified {
+		err := s.signupCodes.Verify(registerCodeKey(st.Challenge), strings.TrimSpace(r.Form.Get("code")))
+		switch {
+		case errors.Is(err, otp.ErrTooManyAttempts):
+			s.deleteCookie(w, registerCookie)
+			s.renderError(w, r, errBadRequest("Too many incorrect codes. Please start again."), &req.Client)
+			return
+		case errors.Is(err, otp.ErrNoCode):
+			data.Error = "This code has expired. Send a new one."
+			s.renderRegister(w, r, http.StatusUnauthorized, data, values, nil)
+			return
+		case err != nil:
+			data.Error = "Invalid code"
+			s.renderRegister(w, r, http.StatusUnauthorized, data, values, nil)
+			return
+		}
+		st.Verified, data.Verified = true, true
+		s.writeRegisterState(w, *st)
+	}
+
+	fields := map[string]string{}
+	for k, v := range values {
+		if k != "email" && k != "name" && k != "password" {
+			fields[k] = v
+		}
+	}
+	ctx, cancel := s.ctx(r)
+	defer cancel()
+	res, err := rg.Register(ctx, plugins.Registration{
+		Email:    st.Email,
+		Name:     values["name"],
+		Password: pw,
+		Fields:   fields,
+	})
+	if err != nil {
+		logAuthFailure(data.Provider, err)
+		status, _, msg := authFailure(err)
+		if plugins.ErrorCode(err) == "" {
+			status, msg = http.StatusInternalServerError, "We couldn't create your account. Please try again."
+		}
+		data.Error = msg
+		s.renderRegister(w, r, status, data, values, nil)
+		return
+	}
+	s.deleteCookie(w, registerCookie)
+
+	// The address was proven with the code, whatever the backend says.
+	claims := make(map[string]interface{}, len(res.Claims)+2)
+	for k, v := range res.Claims {
+		claims[k] = v
+	}
+	claims["email"] = st.Email
+	claims["email_verified"] = true
+	if _, ok := claims["name"]; !ok && values["name"] != "" {
+		claims["name"] = values["name"]
+	}
+	res.Claims = claims
+	if len(res.AMR) == 0 {
+		res.AMR = []string{"pwd"}
+	}
+	if res.Subject, err = identity.Subject(ctx, s.ids, data.Provider, res.Subject); err != nil {
+		s.renderError(w, r, err, &req.Client)
+		return
+	}
+	log.Printf("register: provider=%s sub=%s account created", data.Provider, res.Subject)
+
+	redir, err := s.finishLogin(w, r, data.LoginChallenge, req, data.Provider, res)
+	if err != nil {
+		s.renderError(w, r, err, &req.Client)
+		return
+	}
+	http.Redirect(w, r, redir, http.StatusFound)
+}
@@ -0,0 +1,298 @@
+package ui
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	netmail "net/mail"
+	"net/url"
+	"strings"
+
+	"github.com/nduyhai/hydra-bridge/internal/mail"
+	"github.com/nduyhai/hydra-bridge/internal/plugins"
+	"github.com/nduyhai/hydra-bridge/internal/reset"
+)
+
+type forgotPageData struct {
+	pageMeta
+	LoginChallenge string
+	ClientName     string
+	Provider       string
+	Email          string
+	Sent           bool
+	CSRF           string
+	Error          string
+}
+
+type resetPageData struct {
+	pageMeta
+	Token    string
+	Username string
+	Rules    []string
+	Problems []string
+	Done     bool
+	CSRF     string
+	Error    string
+}
+
+// passwordResetter returns the provider as a PasswordResetter if it is one
+// and the reset flow is switched on.
+func (s *Server) passwordResetter(provider string) (plugins.PasswordResetter, bool) {
+	if s.resets == nil {
+		return nil, false
+	}
+	p, err := s.reg.Get(provider)
+	if err != nil {
+		return nil, false
+	}
+	pr, ok := p.(plugins.PasswordResetter)
+	return pr, ok
+}
+
+func (s *Server) renderForgot(w http.ResponseWriter, r *http.Request, status int, data forgotPageData) {
+	w.Header().Set("Cache-Control", "no-store")
+	data.pageMeta = s.meta(r)
+	data.CSRF = s.issueCSRF(w, r, "forgot", data.LoginChallenge)
+	w.WriteHeader(status)
+	if err := s.tmplForgot.ExecuteTemplate(w, "layout", data); err != nil {
+		log.Printf("forgot template render: %v", err)
+	}
+}
+
+func (s *Server) renderReset(w http.ResponseWriter, r *http.Request, status int, data resetPageData) {
+	w.Header().Set("Cache-Control", "no-store")
+	data.pageMeta = s.meta(r)
+	data.Rules = s.cfg.PasswordPolicy.Rules()
+	if !data.Done {
+		data.CSRF = s.issueCSRF(w, r, "reset", data.Token)
+	}
+	w.WriteHeader(status)
+	if err := s.tmplReset.ExecuteTemplate(w, "layout", data); err != nil {
+		log.Printf("reset template render: %v", err)
+	}
+}
+
+// handleForgotPassword asks for an email address and mails a reset link.
+// The login challenge is optional; when present the user is signed in to
+// that client once the new password is set. The response is the same
+// whether or not the address has an account.
+func (s *Server) handleForgotPassword(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	ch, provider := q.Get("login_challenge"), q.Get("provider")
+	if provider == "" {
+		provider = s.cfg.DefaultProv
+	}
+	pr, ok := s.passwordResetter(provider)
+	if !ok {
+		s.renderError(w, r, errBadRequest("Password reset is not available for this sign-in method."), nil)
+		return
+	}
+	data := forgotPageData{LoginChallenge: ch, Provider: provider}
+	if ch != "" {
+		req, err := s.hyd.GetLoginRequest(ch)
+		if err != nil {
+			s.renderError(w, r, err, nil)
+			return
+		}
+		if !s.providerAllowed(req.Client, provider) {
+			s.renderError(w, r, errBadRequest("The selected sign-in provider is not available."), &req.Client)
+			return
+		}
+		data.ClientName = req.Client.ClientName
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		data.Email = q.Get("login_hint")
+		s.renderForgot(w, r, http.StatusOK, data)
+
+	case http.MethodPost:
+		if err := r.ParseForm(); err != nil {
+			s.renderError(w, r, errBadRequest("The submitted form could not be read."), nil)
+			return
+		}
+		if !s.verifyCSRF(r, "forgot", ch, r.Form.Get("csrf")) {
+			s.renderCSRFError(w, r)
+			return
+		}
+		data.Email = strings.TrimSpace(r.Form.Get("email"))
+		addr, err := netmail.ParseAddress(data.Email)
+		if err != nil || addr.Address != data.Email {
+			data.Error = "Please enter a valid email address."
+			s.renderForgot(w, r, http.StatusBadRequest, data)
+			return
+		}
+		if err := s.resets.Allow(addr.Address); err != nil {
+			data.Sent = true
+			data.Error = "We just sent you a link. Please wait a minute before asking for another one."
+			s.renderForgot(w, r, http.StatusTooManyRequests, data)
+			return
+		}
+
+		ctx, cancel := s.ctx(r)
+		defer cancel()
+		acct, err := pr.FindAccount(ctx, addr.Address)
+		switch {
+		case errors.Is(err, plugins.ErrInvalidCredentials):
+			log.Printf("reset: provider=%s no account for the requested address", provider)
+		case err != nil:
+			logAuthFailure(provider, err)
+			status, _, msg := authFailure(err)
+			data.Error = msg
+			s.renderForgot(w, r, status, data)
+			return
+		default:
+			token, err := s.resets.Issue(reset.Ticket{
+				Provider:  provider,
+				AccountID: acct.ID,
+				Username:  acct.Username,
+				Email:     addr.Address,
+				Challenge: ch,
+				Binding:   s.browserBinding(s.csrfCookieValue(w, r)),
+			})
+			if err != nil {
+				s.renderError(w, r, err, nil)
+				return
+			}
+			// A failed send is only logged: answering differently would tell
+			// the caller the address has an account.
+			if err := s.mailer.Send(ctx, s.resetMessage(addr.Address, token)); err != nil {
+				log.Printf("reset: mail failed: %v", err)
+			} else {
+				log.Printf("reset: provider=%s user=%q reset link sent", provider, acct.Username)
+			}
+		}
+		data.Sent = true
+		s.renderForgot(w, r, http.StatusOK, data)
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) resetMessage(to, token string) mail.Message {
+	link := strings.TrimSuffix(s.cfg.PublicURL, "/") + "/login/reset?" + url.Values{"token": {token}}.Encode()
+	return mail.Message{
+		To:      to,
+		Subject: "Reset your Tripzy password",
+		Text: fmt.Sprintf("Someone asked to reset the password of your Tripzy account.\n\n"+
+			"Open this link within %d minutes to choose a new one:\n\n%s\n\n"+
+			"If it wasn't you, ignore this email; your password stays the same.\n",
+			int(s.resets.TTL().Minutes()), link),
+	}
+}
+
+// handleResetPassword is where the emailed link lands. The token is only
+// used up once the new password passes the policy; if the browser that
+// asked for the link still has a live login challenge, the login resumes.
+func (s *Server) handleResetPassword(w http.ResponseWriter, r *http.Request) {
+	if s.resets == nil {
+		s.renderError(w, r, errBadRequest("Password reset is not available."), nil)
+		return
+	}
+	token := r.URL.Query().Get("token")
+	if r.Method == http.MethodPost {
+		if err := r.ParseForm(); err != nil {
+			s.renderError(w, r, errBadRequest("The submitted form could not be read."), nil)
+			return
+		}
+		token = r.Form.Get("token")
+	}
+	t, err := s.resets.Check(token)
+	if err != nil {
+		s.renderError(w, r, errBadRequest("This reset link is invalid, has expired or was already used. Please ask for a new one."), nil)
+		return
+	}
+	pr, ok := s.passwordResetter(t.Provider)
+	if !ok {
+		s.renderError(w, r, errBadRequest("Password reset is not available for this sign-in method."), nil)
+		return
+	}
+	data := resetPageData{Token: token, Username: t.Username}
+
+	switch r.Method {
+	case http.MethodGet:
+		s.renderReset(w, r, http.StatusOK, data)
+
+	case http.MethodPost:
+		if !s.verifyCSRF(r, "reset", token, r.Form.Get("csrf")) {
+			s.renderCSRFError(w, r)
+			return
+		}
+		next := r.Form.Get("new_password")
+		if next != r.Form.Get("confirm_password") {
+			data.Error = "The new passwords don't match."
+			s.renderReset(w, r, http.StatusBadRequest, data)
+			return
+		}
+		if data.Problems = s.cfg.PasswordPolicy.Check(next, t.Username, t.Email); len(data.Problems) > 0 {
+			s.renderReset(w, r, http.StatusBadRequest, data)
+			return
+		}
+
+		// Consume before the backend call so two submits can't both use it.
+		t, err := s.resets.Consume(token)
+		if err != nil {
+			s.renderError(w, r, errBadRequest("This reset link is invalid, has expired or was already used. Please ask for a new one."), nil)
+			return
+		}
+		ctx, cancel := s.ctx(r)
+		defer cancel()
+		if err := pr.ResetPassword(ctx, t.AccountID, next); err != nil {
+			s.resets.Restore(token, t)
+			logAuthFailure(t.Provider, err)
+			status, _, msg := authFailure(err)
+			data.Error = msg
+			s.renderReset(w, r, status, data)
+			return
+		}
+		s.lock.reset(lockKey(t.Provider, t.Username))
+		log.Printf("reset: provider=%s user=%q password reset", t.Provider, t.Username)
+
+		if redir, ok := s.resumeAfterReset(w, r, t, next); ok {
+			http.Redirect(w, r, redir, http.StatusFound)
+			return
+		}
+		data.Done = true
+		s.renderReset(w, r, http.StatusOK, data)
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// resumeAfterReset signs the user in to the client they were logging in to
+// when they asked for the link. That only works in the same browser and
+// while Hydra still holds the challenge; otherwise they sign in again.
+func (s *Server) resumeAfterReset(w http.ResponseWriter, r *http.Request, t *reset.Ticket, password string) (string, bool) {
+	if t.Challenge == "" || t.Binding == "" {
+		return "", false
+	}
+	var cookie string
+	if c, err := r.Cookie(csrfCookie); err == nil {
+		cookie = c.Value
+	}
+	if subtle.ConstantTimeCompare([]byte(s.browserBinding(cookie)), []byte(t.Binding)) != 1 {
+		return "", false
+	}
+	req, err := s.hyd.GetLoginRequest(t.Challenge)
+	if err != nil {
+		return "", false
+	}
+	res, err := s.authenticate(r, req.Client, t.Provider, plugins.Credentials{
+		Username: t.Username,
+		Password: password,
+	})
+	if err != nil {
+		logAuthFailure(t.Provider, err)
+		return "", false
+	}
+	redir, err := s.finishLogin(w, r, t.Challenge, req, t.Provider, res)
+	if err != nil {
+		log.Printf("reset: resuming login failed: %v", err)
+		return "", false
+	}
+	return redir, true
+}
@@ -2,25 +2,35 @@ package ui
 
 import (
 	"context"
-	"crypto/sha256"
-	"encoding/base64"
+	"fmt"
 	"html/template"
 	"net/http"
 	"strings"
+	"sync/atomic"
 	"time"
 
+	"github.com/nduyhai/hydra-bridge/internal/audit"
+	"github.com/nduyhai/hydra-bridge/internal/hooks"
 	"github.com/nduyhai/hydra-bridge/internal/hydra"
+	"github.com/nduyhai/hydra-bridge/internal/identity"
+	"github.com/nduyhai/hydra-bridge/internal/mail"
+	"github.com/nduyhai/hydra-bridge/internal/otp"
+	"github.com/nduyhai/hydra-bridge/internal/password"
 	"github.com/nduyhai/hydra-bridge/internal/plugins"
+	"github.com/nduyhai/hydra-bridge/internal/policy"
+	"github.com/nduyhai/hydra-bridge/internal/registration"
+	"github.com/nduyhai/hydra-bridge/internal/reset"
+	"github.com/nduyhai/hydra-bridge/internal/terms"
 )
 
 const (
-	userInfoCookie       = "__bridge_user"    // short-lived claims for consent UI
 	bridgeSessionCookie  = "__bridge_session" // long-lived SSO session cookie
 	bridgeSessionTTLDays = 7                  // example only
 )
 
 type Config struct {
 	Addr        string
+	PublicURL   string // how browsers reach the bridge, for links in emails
 	HydraAdmin  string
 	HydraPublic string
 	LoginAPIURL string
@@ -37,6 +47,61 @@ type Config struct {
 	CookieDomain      string // "" = host-only, or ".tripzy.com"
 	CookieSecure      bool   // true in prod (https)
 	CookieSameSite    string // "lax" (default), "strict", "none"
+
+	// Readiness probe
+	HealthCacheSeconds int // how long /readyz reuses the last dependency check
+
+	// Security headers
+	CSPExtra          string              // extra CSP directives appended as-is
+	FrameAncestors    map[string][]string // client_id -> origins allowed to frame login/consent
+	HSTSMaxAgeSeconds int                 // 0 = no HSTS header
+
+	CSRFTTLSeconds int // lifetime of form CSRF tokens
+
+	// JSON API (SPA-driven login/consent)
+	APIAllowedOrigins []string // exact origins allowed for credentialed CORS
+
+	// Provider selection
+	ProviderDomains map[string]string   // home-realm discovery: email domain -> provider
+	ClientProviders map[string][]string // client_id -> providers it may use (unset = all)
+
+	PolicyFile string // JSON per-client authentication policies ("" = allow all)
+	HooksFile  string // JSON lifecycle webhooks ("" = none)
+
+	LinkReauthSeconds int // how recent a sign-in must be to link another provider
+
+	// Password lockout: after LockoutMaxFailures wrong passwords in a row
+	// the username is refused for LockoutSeconds. 0 failures disables it.
+	LockoutMaxFailures int
+	LockoutSeconds     int
+
+	PasswordPolicy password.Policy // rules for new passwords set through the bridge
+}
+
+// ParseClientLists reads "client-a=x y z;client-b=w" into client -> values.
+func ParseClientLists(v string) map[string][]string {
+	out := map[string][]string{}
+	for _, entry := range strings.Split(v, ";") {
+		id, values, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok || strings.TrimSpace(id) == "" {
+			continue
+		}
+		out[strings.TrimSpace(id)] = strings.Fields(values)
+	}
+	return out
+}
+
+// ParseDomainMap reads "corp.example=saml-corp,acme.com=google".
+func ParseDomainMap(v string) map[string]string {
+	out := map[string]string{}
+	for _, entry := range strings.Split(v, ",") {
+		domain, provider, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok || domain == "" || provider == "" {
+			continue
+		}
+		out[strings.ToLower(strings.TrimSpace(domain))] = strings.TrimSpace(provider)
+	}
+	return out
 }
 
 func (c Config) SameSiteMode() http.SameSite {
@@ -58,15 +123,114 @@ func (c Config) SessionTTL() time.Duration {
 	return time.Duration(c.SessionTTLSeconds) * time.Second
 }
 
+func (c Config) LinkReauth() time.Duration {
+	if c.LinkReauthSeconds <= 0 {
+		return 10 * time.Minute
+	}
+	return time.Duration(c.LinkReauthSeconds) * time.Second
+}
+
+func (c Config) LockoutPeriod() time.Duration {
+	if c.LockoutSeconds <= 0 {
+		return 15 * time.Minute
+	}
+	return time.Duration(c.LockoutSeconds) * time.Second
+}
+
+func (c Config) CSRFTTL() time.Duration {
+	if c.CSRFTTLSeconds <= 0 {
+		return time.Hour
+	}
+	return time.Duration(c.CSRFTTLSeconds) * time.Second
+}
+
+func (c Config) HealthCacheTTL() time.Duration {
+	if c.HealthCacheSeconds <= 0 {
+		return 5 * time.Second
+	}
+	return time.Duration(c.HealthCacheSeconds) * time.Second
+}
+
 type Server struct {
 	cfg         Config
 	hyd         *hydra.AdminClient
 	reg         *plugins.Registry
 	tmplLogin   *template.Template
 	tmplConsent *template.Template
+	tmplError   *template.Template
+	tmplLogout  *template.Template
+
+	tmplProviders *template.Template
+	tmplMFA       *template.Template
+	tmplAccount   *template.Template
+	tmplDevice    *template.Template
+	tmplAccounts  *template.Template
+	tmplLink      *template.Template
+	tmplPassword  *template.Template
+	tmplForgot    *template.Template
+	tmplReset     *template.Template
+	tmplRegister  *template.Template
+	tmplTerms     *template.Template
+
+	policies *policy.Engine
+	hooks    *hooks.Runner
+	otp      *otp.Service // emailed/texted second-factor codes; nil = off
+	ids      identity.Store
+	lock     *lockout
+	totpLock *lockout       // wrong authenticator codes; always on
+	resets   *reset.Service // forgot-password tokens; nil = off
+	mailer   mail.Sender
+
+	signup      *registration.Schema // sign-up form; nil = off
+	signupCodes *otp.Service         // email verification codes for sign-up
+
+	terms      *terms.Set // documents to accept before login; nil = no gate
+	termsStore terms.Store
+	audit      audit.Logger
+
+	draining atomic.Bool // set on SIGTERM so probes go unready before we stop
+	health   healthCache
+}
+
+// Option configures optional Server dependencies.
+type Option func(*Server)
+
+// WithOTP enables emailed/texted one-time codes as second factors.
+func WithOTP(svc *otp.Service) Option {
+	return func(s *Server) { s.otp = svc }
+}
+
+// WithIdentities sets the account-linking store (in memory by default).
+func WithIdentities(st identity.Store) Option {
+	return func(s *Server) { s.ids = st }
+}
+
+// WithPasswordReset enables the forgot-password flow; links go out
+// through sender.
+func WithPasswordReset(svc *reset.Service, sender mail.Sender) Option {
+	return func(s *Server) { s.resets, s.mailer = svc, sender }
+}
+
+// WithRegistration enables the sign-up form with the given schema; codes
+// confirm the email address.
+func WithRegistration(schema *registration.Schema, codes *otp.Service) Option {
+	return func(s *Server) { s.signup, s.signupCodes = schema, codes }
+}
+
+// WithTerms gates logins on accepting the current version of each
+// document; acceptances go to st and to the audit log.
+func WithTerms(set *terms.Set, st terms.Store) Option {
+	return func(s *Server) { s.terms, s.termsStore = set, st }
+}
+
+// WithAudit sets where audit events go (the process log by default).
+func WithAudit(l audit.Logger) Option {
+	return func(s *Server) { s.audit = l }
 }
 
-func NewServer(cfg Config, hyd *hydra.AdminClient, reg *plugins.Registry) *Server {
+// NewServer builds the UI server. It fails when the policy or hooks file
+// can't be loaded.
+func NewServer(cfg Config, hyd *hydra.AdminClient, reg *plugins.Registry, opts ...Option) (*Server, error) {
 	tmplLogin := template.Must(template.ParseFiles(
 		"/app/web/templates/layout.html",
 		"/app/web/templates/login.html",
@@ -76,24 +240,142 @@ func NewServer(cfg Config, hyd *hydra.AdminClient, reg *plugins.Registry) *Serve
 		"/app/web/templates/layout.html",
 		"/app/web/templates/consent.html",
 	))
-	return &Server{cfg: cfg, hyd: hyd, reg: reg, tmplConsent: tmplConsent, tmplLogin: tmplLogin}
+
+	tmplError := template.Must(template.ParseFiles(
+		"/app/web/templates/layout.html",
+		"/app/web/templates/error.html",
+	))
+
+	tmplLogout := template.Must(template.ParseFiles(
+		"/app/web/templates/layout.html",
+		"/app/web/templates/logout.html",
+	))
+
+	tmplProviders := template.Must(template.ParseFiles(
+		"/app/web/templates/layout.html",
+		"/app/web/templates/providers.html",
+	))
+
+	tmplMFA := template.Must(template.ParseFiles(
+		"/app/web/templates/layout.html",
+		"/app/web/templates/mfa.html",
+	))
+
+	tmplAccount := template.Must(template.ParseFiles(
+		"/app/web/templates/layout.html",
+		"/app/web/templates/account.html",
+	))
+
+	tmplDevice := template.Must(template.ParseFiles(
+		"/app/web/templates/layout.html",
+		"/app/web/templates/device.html",
+	))
+
+	tmplAccounts := template.Must(template.ParseFiles(
+		"/app/web/templates/layout.html",
+		"/app/web/templates/accounts.html",
+	))
+	tmplLink := template.Must(template.ParseFiles(
+		"/app/web/templates/layout.html",
+		"/app/web/templates/link.html",
+	))
+	tmplPassword := template.Must(template.ParseFiles(
+		"/app/web/templates/layout.html",
+		"/app/web/templates/password.html",
+	))
+	tmplForgot := template.Must(template.ParseFiles(
+		"/app/web/templates/layout.html",
+		"/app/web/templates/forgot.html",
+	))
+	tmplReset := template.Must(template.ParseFiles(
+		"/app/web/templates/layout.html",
+		"/app/web/templates/reset.html",
+	))
+	tmplRegister := template.Must(template.ParseFiles(
+		"/app/web/templates/layout.html",
+		"/app/web/templates/register.html",
+	))
+	tmplTerms := template.Must(template.ParseFiles(
+		"/app/web/templates/layout.html",
+		"/app/web/templates/terms.html",
+	))
+
+	policies, err := policy.Load(cfg.PolicyFile)
+	if err != nil {
+		return nil, fmt.Errorf("load policies: %w", err)
+	}
+	hookRunner, err := hooks.Load(cfg.HooksFile)
+	if err != nil {
+		return nil, fmt.Errorf("load hooks: %w", err)
+	}
+	s := &Server{
+		cfg: cfg, hyd: hyd, reg: reg,
+		tmplConsent: tmplConsent, tmplLogin: tmplLogin, tmplError: tmplError, tmplLogout: tmplLogout,
+		tmplProviders: tmplProviders, tmplMFA: tmplMFA, tmplAccount: tmplAccount, tmplDevice: tmplDevice,
+		tmplAccounts: tmplAccounts, tmplLink: tmplLink, tmplPassword: tmplPassword,
+		tmplForgot: tmplForgot, tmplReset: tmplReset, tmplRegister: tmplRegister,
+		tmplTerms: tmplTerms,
+		policies:  policies,
+		hooks:     hookRunner,
+		ids:       identity.NewMemoryStore(),
+		audit:     audit.StdLogger{},
+		lock:      newLockout(cfg.LockoutMaxFailures, cfg.LockoutPeriod()),
+		totpLock:  newLockout(totpMaxFailures, cfg.LockoutPeriod()),
+	}
+	for _, o := range opts {
+		o(s)
+	}
+	return s, nil
 }
 
 func (s *Server) Routes() http.Handler {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/login", s.handleLogin)
+	mux.HandleFunc("/login/discover", s.handleDiscover)
+	mux.HandleFunc("/login/mfa", s.handleMFA)
+	mux.HandleFunc("/login/password", s.handlePasswordChange)
+	mux.HandleFunc("/login/forgot", s.handleForgotPassword)
+	mux.HandleFunc("/login/reset", s.handleResetPassword)
+	mux.HandleFunc("/login/register", s.handleRegister)
+	mux.HandleFunc("/login/terms", s.handleTerms)
+	mux.HandleFunc("/login/magic", s.handleMagicLinkSend)
+	mux.HandleFunc("/login/magic/callback", s.handleMagicLinkCallback)
+	mux.HandleFunc(OAuthCallbackPath, s.handleOAuthCallback)
+	mux.HandleFunc("/login/accounts/signout", s.handleAccountSignOut)
 	mux.HandleFunc("/consent", s.handleConsent)
-	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(200) })
-	return mux
+	mux.HandleFunc("/logout", s.handleLogout)
+	mux.HandleFunc("/device", s.handleDevice)
+	mux.HandleFunc("/device/success", s.handleDeviceSuccess)
+	mux.HandleFunc("/account", s.handleAccount)
+	mux.HandleFunc("/account/consents/revoke", s.handleRevokeConsent)
+	mux.HandleFunc("/account/sessions/revoke", s.handleRevokeSessions)
+	mux.HandleFunc("/account/switch", s.handleSwitchAccount)
+	mux.HandleFunc("/account/signout", s.handleSignOutAccount)
+	mux.HandleFunc("/account/link", s.handleLink)
+	mux.HandleFunc("/account/reauth", s.handleReauth)
+	mux.HandleFunc("/account/unlink", s.handleUnlink)
+	mux.HandleFunc("/api/login", s.api(s.handleAPILogin))
+	mux.HandleFunc("/api/consent", s.api(s.handleAPIConsent))
+	mux.HandleFunc("/error", s.handleError)
+	mux.HandleFunc("/healthz", s.handleHealthz)
+	mux.HandleFunc("/livez", s.handleLivez)
+	mux.HandleFunc("/readyz", s.handleReadyz)
+	return s.securityHeaders(mux)
 }
 
-func (s *Server) ctx(r *http.Request) (context.Context, context.CancelFunc) {
-	return context.WithTimeout(r.Context(), 15*time.Second)
+// BeginShutdown flips health checks to unready so load balancers drain us.
+func (s *Server) BeginShutdown() { s.draining.Store(true) }
+
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	if s.draining.Load() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
 }
 
-func csrfToken(secret, challenge string) string {
-	h := sha256.Sum256([]byte(secret + ":" + challenge))
-	return base64.RawURLEncoding.EncodeToString(h[:])
+func (s *Server) ctx(r *http.Request) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(r.Context(), 15*time.Second)
 }
 
 func (s *Server) setShortCookie(
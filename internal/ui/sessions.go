@@ -0,0 +1,303 @@
+package ui
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/nduyhai/hydra-bridge/internal/hydra"
+)
+
+// maxBridgeSessions bounds how many accounts the jar holds; the least
+// recently used account is dropped first.
+const maxBridgeSessions = 4
+
+// maxSessionCookieBytes is what name=value of __bridge_session may take.
+// Browsers silently drop cookies over 4096 bytes, which would sign every
+// account out, so writeSessions evicts accounts until the jar fits.
+const maxSessionCookieBytes = 4000
+
+// sessionJar is the content of __bridge_session: every account signed in
+// in this browser, most recently used first. Active is the sid of the
+// account used when nothing else was chosen.
+type sessionJar struct {
+	Active   string          `json:"active,omitempty"`
+	Sessions []bridgeSession `json:"sessions"`
+}
+
+type accountOption struct {
+	Sid     string
+	Name    string
+	Email   string
+	Initial string
+	Active  bool
+}
+
+type accountsPageData struct {
+	pageMeta
+	LoginChallenge string
+	ClientName     string
+	Accounts       []accountOption
+	Selected       string // sid preselected from login_hint
+	AddURL         string
+	CSRF           string
+}
+
+// readSessions returns the unexpired sessions of this browser. Cookies
+// written before the jar existed hold a single bridgeSession; they are
+// read as a jar of one.
+func (s *Server) readSessions(r *http.Request) *sessionJar {
+	jar := &sessionJar{}
+	c, err := r.Cookie(bridgeSessionCookie)
+	if err != nil || c.Value == "" {
+		return jar
+	}
+	payload, ok := s.verifyCookieValue(c.Value)
+	if !ok {
+		return jar
+	}
+	var raw sessionJar
+	if err := json.Unmarshal(payload, &raw); err != nil || raw.Sessions == nil {
+		var single bridgeSession
+		if err := json.Unmarshal(payload, &single); err != nil {
+			return jar
+		}
+		raw = sessionJar{Sessions: []bridgeSession{single}}
+	}
+
+	now := time.Now().Unix()
+	for _, sess := range raw.Sessions {
+		if sess.Sub == "" || (sess.Exp > 0 && now > sess.Exp) {
+			continue
+		}
+		if sess.Sid == "" {
+			sess.Sid = legacySid(sess)
+		}
+		jar.Sessions = append(jar.Sessions, sess)
+	}
+	jar.Active = raw.Active
+	if jar.find(jar.Active) == nil && len(jar.Sessions) > 0 {
+		jar.Active = jar.Sessions[0].Sid
+	}
+	return jar
+}
+
+// legacySid gives sessions minted before session ids a stable handle.
+func legacySid(sess bridgeSession) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%d", sess.Sub, sess.Iat)))
+	return base64.RawURLEncoding.EncodeToString(sum[:16])
+}
+
+// writeSessions stores the jar; an empty jar removes the cookie. Accounts
+// carry their claims, so a few large ones can outgrow a cookie: the least
+// recently used accounts other than the active one are dropped until it
+// fits.
+func (s *Server) writeSessions(w http.ResponseWriter, jar *sessionJar) {
+	if len(jar.Sessions) == 0 {
+		s.deleteCookie(w, bridgeSessionCookie)
+		return
+	}
+	payload, _ := json.Marshal(jar)
+	value := s.signCookieValue(payload)
+	for len(bridgeSessionCookie)+1+len(value) > maxSessionCookieBytes && len(jar.Sessions) > 1 {
+		i := len(jar.Sessions) - 1
+		if jar.Sessions[i].Sid == jar.Active {
+			i--
+		}
+		log.Printf("sessions: jar too large for a cookie, dropping sub=%s", jar.Sessions[i].Sub)
+		jar.Sessions = slices.Delete(jar.Sessions, i, i+1)
+		payload, _ = json.Marshal(jar)
+		value = s.signCookieValue(payload)
+	}
+	if n := len(bridgeSessionCookie) + 1 + len(value); n > maxSessionCookieBytes {
+		log.Printf("sessions: session of sub=%s is %d bytes; browsers may drop it", jar.Sessions[0].Sub, n)
+	}
+	var exp int64
+	for _, sess := range jar.Sessions {
+		exp = max(exp, sess.Exp)
+	}
+	s.setSessionCookie(w, bridgeSessionCookie, value, time.Until(time.Unix(exp, 0)))
+}
+
+func (j *sessionJar) find(sid string) *bridgeSession {
+	for i := range j.Sessions {
+		if j.Sessions[i].Sid == sid {
+			return &j.Sessions[i]
+		}
+	}
+	return nil
+}
+
+func (j *sessionJar) active() (*bridgeSession, bool) {
+	sess := j.find(j.Active)
+	return sess, sess != nil
+}
+
+// add makes sess the active account, replacing any older session of the
+// same subject.
+func (j *sessionJar) add(sess bridgeSession) {
+	j.Sessions = slices.DeleteFunc(j.Sessions, func(o bridgeSession) bool { return o.Sub == sess.Sub })
+	j.Sessions = append([]bridgeSession{sess}, j.Sessions...)
+	if len(j.Sessions) > maxBridgeSessions {
+		j.Sessions = j.Sessions[:maxBridgeSessions]
+	}
+	j.Active = sess.Sid
+}
+
+// use marks an existing session as active and most recently used.
+func (j *sessionJar) use(sid string) {
+	if sess := j.find(sid); sess != nil {
+		j.add(*sess)
+	}
+}
+
+func (j *sessionJar) remove(sid string) (bridgeSession, bool) {
+	i := slices.IndexFunc(j.Sessions, func(o bridgeSession) bool { return o.Sid == sid })
+	if i < 0 {
+		return bridgeSession{}, false
+	}
+	gone := j.Sessions[i]
+	j.Sessions = slices.Delete(j.Sessions, i, i+1)
+	if j.Active == sid {
+		j.Active = ""
+		if len(j.Sessions) > 0 {
+			j.Active = j.Sessions[0].Sid
+		}
+	}
+	return gone, true
+}
+
+// matchHint finds the session a login_hint refers to: email, preferred
+// username or subject.
+func (j *sessionJar) matchHint(hint string) *bridgeSession {
+	hint = strings.TrimSpace(hint)
+	if hint == "" {
+		return nil
+	}
+	for i := range j.Sessions {
+		sess := &j.Sessions[i]
+		if sess.Sub == hint {
+			return sess
+		}
+		for _, k := range []string{"email", "preferred_username"} {
+			if v, _ := sess.Claims[k].(string); v != "" && strings.EqualFold(v, hint) {
+				return sess
+			}
+		}
+	}
+	return nil
+}
+
+func (j *sessionJar) options() []accountOption {
+	out := make([]accountOption, 0, len(j.Sessions))
+	for _, sess := range j.Sessions {
+		o := accountOption{Sid: sess.Sid, Active: sess.Sid == j.Active}
+		o.Name, _ = sess.Claims["name"].(string)
+		o.Email, _ = sess.Claims["email"].(string)
+		if o.Name == "" {
+			o.Name = sess.Sub
+		}
+		o.Initial = initial(o.Name)
+		out = append(out, o)
+	}
+	return out
+}
+
+// promptValues reads OIDC prompt from the original authorization request;
+// Hydra does not expose it on the login request itself.
+func promptValues(req *hydra.LoginRequest) []string {
+	u, err := url.Parse(req.RequestURL)
+	if err != nil {
+		return nil
+	}
+	return strings.Fields(u.Query().Get("prompt"))
+}
+
+// pickSession decides which bridge session, if any, answers this login
+// request. choose is true when the user has to pick on the account chooser.
+func pickSession(jar *sessionJar, req *hydra.LoginRequest, account, hint string) (sess *bridgeSession, choose bool) {
+	switch {
+	case account == "new":
+		return nil, false
+	case account != "":
+		return jar.find(account), false
+	case len(jar.Sessions) == 0:
+		return nil, false
+	case slices.Contains(promptValues(req), "select_account"):
+		return nil, true
+	}
+	if req.Skip {
+		// Hydra remembers who is signed in to this client; only that
+		// subject can be accepted without a new login.
+		for i := range jar.Sessions {
+			if jar.Sessions[i].Sub == req.Subject {
+				return &jar.Sessions[i], false
+			}
+		}
+	}
+	if m := jar.matchHint(hint); m != nil {
+		return m, false
+	}
+	if hint != "" || len(jar.Sessions) > 1 {
+		return nil, true
+	}
+	active, _ := jar.active()
+	return active, false
+}
+
+func accountURL(ch, account string) string {
+	return "/login?" + url.Values{"login_challenge": {ch}, "account": {account}}.Encode()
+}
+
+func (s *Server) renderAccountChooser(w http.ResponseWriter, r *http.Request, ch string, req *hydra.LoginRequest, jar *sessionJar, hint string) {
+	s.allowFraming(w, r, req.Client.ClientID)
+	data := accountsPageData{
+		pageMeta:       s.meta(r),
+		LoginChallenge: ch,
+		ClientName:     req.Client.ClientName,
+		Accounts:       jar.options(),
+		AddURL:         accountURL(ch, "new"),
+		CSRF:           s.issueCSRF(w, r, "login", ch),
+	}
+	if m := jar.matchHint(hint); m != nil {
+		data.Selected = m.Sid
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	if err := s.tmplAccounts.ExecuteTemplate(w, "layout", data); err != nil {
+		s.renderError(w, r, err, nil)
+	}
+}
+
+// handleAccountSignOut signs one account out of this browser from the
+// chooser, then shows the chooser (or login page) again.
+func (s *Server) handleAccountSignOut(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		s.renderError(w, r, errBadRequest("The submitted form could not be read."), nil)
+		return
+	}
+	ch := r.Form.Get("login_challenge")
+	if ch == "" {
+		s.renderError(w, r, errBadRequest("The login request is missing its challenge."), nil)
+		return
+	}
+	if !s.verifyCSRF(r, "login", ch, r.Form.Get("csrf")) {
+		s.renderCSRFError(w, r)
+		return
+	}
+	jar := s.readSessions(r)
+	if _, ok := jar.remove(r.Form.Get("sid")); ok {
+		s.writeSessions(w, jar)
+	}
+	http.Redirect(w, r, "/login?"+url.Values{"login_challenge": {ch}}.Encode(), http.StatusSeeOther)
+}
@@ -0,0 +1,63 @@
+package ui
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteSessionsFits(t *testing.T) {
+	s := &Server{cfg: Config{CookieAuth: "test-cookie-auth-key"}}
+	exp := time.Now().Add(time.Hour).Unix()
+	session := func(i, claimBytes int) bridgeSession {
+		return bridgeSession{
+			Sid:    fmt.Sprintf("sid%d", i),
+			Sub:    fmt.Sprintf("u%d", i),
+			Claims: map[string]interface{}{"groups": strings.Repeat("g", claimBytes)},
+			Exp:    exp,
+		}
+	}
+
+	tests := []struct {
+		name       string
+		claimBytes int
+		active     int // index of the active account
+		wantSids   []string
+	}{
+		{name: "small jar kept", claimBytes: 50, active: 0, wantSids: []string{"sid0", "sid1", "sid2", "sid3"}},
+		{name: "oldest dropped", claimBytes: 1200, active: 0, wantSids: []string{"sid0", "sid1"}},
+		{name: "active kept even when oldest", claimBytes: 1200, active: 3, wantSids: []string{"sid0", "sid3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jar := &sessionJar{}
+			for i := 0; i < maxBridgeSessions; i++ {
+				jar.Sessions = append(jar.Sessions, session(i, tt.claimBytes))
+			}
+			jar.Active = jar.Sessions[tt.active].Sid
+
+			w := httptest.NewRecorder()
+			s.writeSessions(w, jar)
+			cookies := w.Result().Cookies()
+			if len(cookies) != 1 {
+				t.Fatalf("got %d cookies", len(cookies))
+			}
+			if n := len(cookies[0].Name) + 1 + len(cookies[0].Value); n > maxSessionCookieBytes {
+				t.Errorf("cookie is %d bytes, limit %d", n, maxSessionCookieBytes)
+			}
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.AddCookie(&http.Cookie{Name: cookies[0].Name, Value: cookies[0].Value})
+			var got []string
+			for _, sess := range s.readSessions(r).Sessions {
+				got = append(got, sess.Sid)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.wantSids) {
+				t.Errorf("sessions after write = %v, want %v", got, tt.wantSids)
+			}
+		})
+	}
+}
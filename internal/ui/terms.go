@@ -0,0 +1,208 @@
+package ui
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/nduyhai/hydra-bridge/internal/audit"
+	"github.com/nduyhai/hydra-bridge/internal/hydra"
+	"github.com/nduyhai/hydra-bridge/internal/plugins"
+	"github.com/nduyhai/hydra-bridge/internal/policy"
+	"github.com/nduyhai/hydra-bridge/internal/terms"
+)
+
+type termsPageData struct {
+	pageMeta
+	LoginChallenge string
+	ClientName     string
+	Documents      []terms.Document
+	Updated        bool // some were accepted before in an older version
+	CSRF           string
+	Error          string
+}
+
+func termsURL(ch string) string {
+	return "/login/terms?" + url.Values{"login_challenge": {ch}}.Encode()
+}
+
+// termsGate sends the user to the terms page when the subject has not
+// accepted the current version of every document for this client. sid is
+// the bridge session an SSO login reuses, "" for a fresh sign-in. Hydra's
+// login is only accepted once the terms are agreed.
+func (s *Server) termsGate(w http.ResponseWriter, r *http.Request, ch string, req *hydra.LoginRequest, provider string, res *plugins.AuthResult, sid string) (string, bool, error) {
+	docs := s.terms.For(req.Client.ClientID)
+	if len(docs) == 0 {
+		return "", false, nil
+	}
+	ctx, cancel := s.ctx(r)
+	defer cancel()
+	pending, _, err := terms.Pending(ctx, s.termsStore, docs, res.Subject)
+	if err != nil || len(pending) == 0 {
+		return "", false, err
+	}
+	s.setPendingLogin(w, pendingLogin{
+		Challenge: ch,
+		Provider:  provider,
+		Sub:       res.Subject,
+		Claims:    res.Claims,
+		AMR:       res.AMR,
+		Session:   sid,
+		Stage:     stageTerms,
+	})
+	return termsURL(ch), true, nil
+}
+
+// acceptPendingLogin accepts the Hydra login parked behind the terms page,
+// reusing the bridge session for SSO logins.
+func (s *Server) acceptPendingLogin(w http.ResponseWriter, r *http.Request, ch string, p *pendingLogin) (string, error) {
+	s.deleteCookie(w, pendingLoginCookie)
+	if p.Session == "" {
+		redir, err := s.acceptLogin(w, r, ch, p.Provider, p.authResult())
+		if err != nil {
+			return "", err
+		}
+		return redir.RedirectTo, nil
+	}
+	sess := s.readSessions(r).find(p.Session)
+	if sess == nil || sess.Sub != p.Sub {
+		return "", errBadRequest("Your session ended. Please sign in again.")
+	}
+	// patches apply to this login only; the stored session keeps its claims
+	patched := *sess
+	patched.Claims = p.Claims
+	redir, err := s.acceptSSO(w, r, ch, &patched)
+	if err != nil {
+		return "", err
+	}
+	return redir.RedirectTo, nil
+}
+
+// handleTerms is the terms-of-service step of the login flow. Each
+// acceptance is written to the audit log and the terms store before the
+// Hydra login is accepted; declining rejects the login.
+func (s *Server) handleTerms(w http.ResponseWriter, r *http.Request) {
+	if s.terms == nil {
+		http.NotFound(w, r)
+		return
+	}
+	ch := r.URL.Query().Get("login_challenge")
+	if ch == "" {
+		s.renderError(w, r, errBadRequest("The login request is missing its challenge."), nil)
+		return
+	}
+	p, ok := s.readPendingLogin(r, ch, stageTerms)
+	if !ok {
+		s.renderError(w, r, errBadRequest("Your sign-in session expired. Please sign in again."), nil)
+		return
+	}
+	req, err := s.hyd.GetLoginRequest(ch)
+	if err != nil {
+		s.renderError(w, r, err, nil)
+		return
+	}
+	ctx, cancel := s.ctx(r)
+	defer cancel()
+	pending, updated, err := terms.Pending(ctx, s.termsStore, s.terms.For(req.Client.ClientID), p.Sub)
+	if err != nil {
+		s.renderError(w, r, err, &req.Client)
+		return
+	}
+	render := func(status int, msg string) {
+		w.Header().Set("Cache-Control", "no-store")
+		s.allowFraming(w, r, req.Client.ClientID)
+		data := termsPageData{
+			pageMeta:       s.meta(r),
+			LoginChallenge: ch,
+			ClientName:     req.Client.ClientName,
+			Documents:      pending,
+			Updated:        updated,
+			CSRF:           s.issueCSRF(w, r, "terms", ch),
+			Error:          msg,
+		}
+		w.WriteHeader(status)
+		if err := s.tmplTerms.ExecuteTemplate(w, "layout", data); err != nil {
+			log.Printf("terms template render: %v", err)
+		}
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		if len(pending) == 0 {
+			// accepted meanwhile, e.g. in another tab
+			redir, err := s.acceptPendingLogin(w, r, ch, p)
+			if err != nil {
+				s.renderError(w, r, err, &req.Client)
+				return
+			}
+			http.Redirect(w, r, redir, http.StatusFound)
+			return
+		}
+		render(http.StatusOK, "")
+
+	case http.MethodPost:
+		if err := r.ParseForm(); err != nil {
+			s.renderError(w, r, errBadRequest("The submitted form could not be read."), nil)
+			return
+		}
+		if !s.verifyCSRF(r, "terms", ch, r.Form.Get("csrf")) {
+			s.renderCSRFError(w, r)
+			return
+		}
+		if r.Form.Get("decline") != "" {
+			s.deleteCookie(w, pendingLoginCookie)
+			log.Printf("terms: sub=%s client=%s declined", p.Sub, req.Client.ClientID)
+			redir, err := s.rejectLogin(ch, policy.Decision{
+				Error:       "access_denied",
+				Description: "The terms of service were not accepted.",
+			})
+			if err != nil {
+				s.renderError(w, r, err, &req.Client)
+				return
+			}
+			http.Redirect(w, r, redir, http.StatusFound)
+			return
+		}
+		if r.Form.Get("agree") == "" {
+			render(http.StatusBadRequest, "Please confirm that you agree to continue.")
+			return
+		}
+
+		now := time.Now().UTC()
+		for _, d := range pending {
+			// audit first: an acceptance we can't prove must not count
+			err := s.audit.Record(ctx, audit.Event{
+				Time:     now,
+				Type:     "terms.accepted",
+				Subject:  p.Sub,
+				ClientID: req.Client.ClientID,
+				Details:  map[string]string{"document": d.ID, "version": d.Version, "url": d.URL},
+			})
+			if err == nil {
+				err = s.termsStore.Accept(ctx, terms.Acceptance{
+					Subject:    p.Sub,
+					Document:   d.ID,
+					Version:    d.Version,
+					ClientID:   req.Client.ClientID,
+					AcceptedAt: now,
+				})
+			}
+			if err != nil {
+				log.Printf("terms: recording acceptance failed sub=%s document=%s: %v", p.Sub, d.ID, err)
+				s.renderError(w, r, err, &req.Client)
+				return
+			}
+		}
+
+		redir, err := s.acceptPendingLogin(w, r, ch, p)
+		if err != nil {
+			s.renderError(w, r, err, &req.Client)
+			return
+		}
+		http.Redirect(w, r, redir, http.StatusFound)
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
@@ -1,9 +1,20 @@
 package main
 
 import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type LoginReq struct {
@@ -12,38 +23,126 @@ type LoginReq struct {
 }
 
 type LoginResp struct {
-	OK     bool              `json:"ok"`
-	UserID string            `json:"user_id,omitempty"`
-	Claims map[string]string `json:"claims,omitempty"`
-	Error  string            `json:"error,omitempty"`
+	OK     bool           `json:"ok"`
+	UserID string         `json:"user_id,omitempty"`
+	Claims map[string]any `json:"claims,omitempty"`
+	Error  string         `json:"error,omitempty"`
+}
+
+type TOTPReq struct {
+	UserID string `json:"user_id"`
+	Code   string `json:"code"`
+}
+
+// Demo TOTP secret for user-12345. Add it to any authenticator app
+// (otpauth://totp/Tripzy:hai?secret=JBSWY3DPEHPK3PXP&issuer=Tripzy).
+const demoTOTPSecret = "JBSWY3DPEHPK3PXP"
+
+// totp implements RFC 6238 (SHA1, 30s step, 6 digits).
+func totp(secret string, t time.Time) string {
+	key, _ := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.TrimRight(secret, "="))
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(t.Unix()/30))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	off := sum[len(sum)-1] & 0x0f
+	code := binary.BigEndian.Uint32(sum[off:off+4]) & 0x7fffffff
+	return fmt.Sprintf("%06d", code%1000000)
+}
+
+const demoUserID = "user-12345"
+
+func demoClaims() map[string]any {
+	return map[string]any{
+		"email":        "hai@tripzy.local",
+		"name":         "Nguyen Hai",
+		"groups":       []string{"staff"},
+		"phone_number": "+84901234567",
+	}
+}
+
+// demoHookSecret must match HOOK_BILLING_SECRET on the bridge.
+const demoHookSecret = "demo-hook-secret"
+
+// validHookSignature checks "t=<unix>,v1=<hex>" and rejects stale requests.
+func validHookSignature(header string, body []byte) bool {
+	var ts, sig string
+	for _, part := range strings.Split(header, ",") {
+		k, v, _ := strings.Cut(part, "=")
+		switch k {
+		case "t":
+			ts = v
+		case "v1":
+			sig = v
+		}
+	}
+	t, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || time.Since(time.Unix(t, 0)).Abs() > 5*time.Minute {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(demoHookSecret))
+	mac.Write([]byte(ts + "."))
+	mac.Write(body)
+	return hmac.Equal([]byte(sig), []byte(hex.EncodeToString(mac.Sum(nil))))
 }
 
 func main() {
 	mux := http.NewServeMux()
-	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+	users := newUserStore()
+	mux.HandleFunc("/login", users.handleLogin)
+	mux.HandleFunc("/password/change", users.handlePasswordChange)
+
+	// Used by passwordless plugins to resolve an email to a user.
+	mux.HandleFunc("/users/lookup", users.handleLookup)
+	mux.HandleFunc("/password/reset", users.handlePasswordReset)
+	mux.HandleFunc("/users", users.handleRegister)
+
+	mux.HandleFunc("/mfa/totp/verify", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			w.WriteHeader(http.StatusMethodNotAllowed)
 			return
 		}
-		var req LoginReq
+		var req TOTPReq
 		_ = json.NewDecoder(r.Body).Decode(&req)
 
-		// Demo rule:
-		// username: hai
-		// password: 123
-		if req.Username == "hai" && req.Password == "123" {
-			_ = json.NewEncoder(w).Encode(LoginResp{
-				OK:     true,
-				UserID: "user-12345",
-				Claims: map[string]string{
-					"email": "hai@tripzy.local",
-					"name":  "Nguyen Hai",
-				},
-			})
+		// accept the previous, current and next step to allow for clock skew
+		now := time.Now()
+		if req.UserID == "user-12345" {
+			for _, skew := range []time.Duration{-30 * time.Second, 0, 30 * time.Second} {
+				if hmac.Equal([]byte(req.Code), []byte(totp(demoTOTPSecret, now.Add(skew)))) {
+					_ = json.NewEncoder(w).Encode(LoginResp{OK: true, UserID: req.UserID})
+					return
+				}
+			}
+		}
+		_ = json.NewEncoder(w).Encode(LoginResp{OK: false, Error: "invalid code"})
+	})
+
+	// Stand-in for the billing service: a before_accept_consent hook that
+	// adds entitlements to the access token.
+	mux.HandleFunc("/hooks/entitlements", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if !validHookSignature(r.Header.Get("X-Bridge-Signature"), body) {
+			w.WriteHeader(http.StatusUnauthorized)
 			return
 		}
-		w.WriteHeader(http.StatusUnauthorized)
-		_ = json.NewEncoder(w).Encode(LoginResp{OK: false, Error: "invalid credentials"})
+		var req struct {
+			Subject string `json:"subject"`
+		}
+		_ = json.Unmarshal(body, &req)
+
+		plan := "free"
+		if req.Subject == "user-12345" {
+			plan = "pro"
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"access_token": map[string]any{"plan": plan, "entitlements": []string{"trips:read", "trips:write"}},
+		})
+	})
+
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
 	})
 
 	log.Println("mock-login-api listening on :8090")
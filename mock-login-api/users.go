@@ -0,0 +1,236 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// demoUser is one account in the mock's in-memory user table.
+type demoUser struct {
+	ID       string
+	Username string
+	Password string
+	Claims   map[string]any
+	Locked   bool
+	Expired  bool // must change the password before signing in
+}
+
+type userStore struct {
+	mu    sync.Mutex
+	users []*demoUser
+}
+
+// newUserStore seeds the demo accounts (all with password 123):
+// hai signs in, locked is locked, expired must change its password.
+func newUserStore() *userStore {
+	return &userStore{users: []*demoUser{
+		{ID: demoUserID, Username: "hai", Password: "123", Claims: demoClaims()},
+		{ID: "user-23456", Username: "locked", Password: "123", Locked: true,
+			Claims: map[string]any{"email": "locked@tripzy.local", "name": "Locked Demo"}},
+		{ID: "user-34567", Username: "expired", Password: "123", Expired: true,
+			Claims: map[string]any{"email": "expired@tripzy.local", "name": "Expired Demo"}},
+	}}
+}
+
+// byLogin finds a user by username or email. Callers hold mu.
+func (s *userStore) byLogin(login string) *demoUser {
+	for _, u := range s.users {
+		email, _ := u.Claims["email"].(string)
+		if u.Username == login || (email != "" && strings.EqualFold(email, login)) {
+			return u
+		}
+	}
+	return nil
+}
+
+// byEmail finds a user by email only. Callers hold mu.
+func (s *userStore) byEmail(email string) *demoUser {
+	for _, u := range s.users {
+		if e, _ := u.Claims["email"].(string); e != "" && strings.EqualFold(e, email) {
+			return u
+		}
+	}
+	return nil
+}
+
+// byID finds a user by id. Callers hold mu.
+func (s *userStore) byID(id string) *demoUser {
+	for _, u := range s.users {
+		if u.ID == id {
+			return u
+		}
+	}
+	return nil
+}
+
+type PasswordChangeReq struct {
+	Username    string `json:"username"`
+	OldPassword string `json:"old_password"`
+	NewPassword string `json:"new_password"`
+}
+
+// handleLogin checks a username and password.
+// outage / any -> 503, which the bridge must not count toward lockout.
+func (s *userStore) handleLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req LoginReq
+	_ = json.NewDecoder(r.Body).Decode(&req)
+	if req.Username == "outage" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_ = json.NewEncoder(w).Encode(LoginResp{OK: false, Error: "maintenance"})
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u := s.byLogin(req.Username)
+	switch {
+	case u == nil || u.Password != req.Password:
+		w.WriteHeader(http.StatusUnauthorized)
+		_ = json.NewEncoder(w).Encode(LoginResp{OK: false, Error: "invalid_credentials"})
+	case u.Locked:
+		w.WriteHeader(http.StatusLocked)
+		_ = json.NewEncoder(w).Encode(LoginResp{OK: false, Error: "account_locked"})
+	case u.Expired:
+		_ = json.NewEncoder(w).Encode(LoginResp{OK: false, Error: "password_expired"})
+	default:
+		_ = json.NewEncoder(w).Encode(LoginResp{OK: true, UserID: u.ID, Claims: u.Claims})
+	}
+}
+
+// handlePasswordChange sets a new password after checking the current one.
+// The bridge enforces its own policy first; the mock only refuses reuse.
+func (s *userStore) handlePasswordChange(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req PasswordChangeReq
+	_ = json.NewDecoder(r.Body).Decode(&req)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u := s.byLogin(req.Username)
+	switch {
+	case u == nil || u.Password != req.OldPassword:
+		w.WriteHeader(http.StatusUnauthorized)
+		_ = json.NewEncoder(w).Encode(LoginResp{OK: false, Error: "invalid_credentials"})
+	case u.Locked:
+		w.WriteHeader(http.StatusLocked)
+		_ = json.NewEncoder(w).Encode(LoginResp{OK: false, Error: "account_locked"})
+	case req.NewPassword == u.Password:
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		_ = json.NewEncoder(w).Encode(LoginResp{OK: false, Error: "password_rejected"})
+	default:
+		u.Password = req.NewPassword
+		u.Expired = false
+		_ = json.NewEncoder(w).Encode(LoginResp{OK: true, UserID: u.ID})
+	}
+}
+
+// handleLookup finds an account by email, for magic links and password
+// reset. preferred_username tells the bridge what the user signs in with.
+func (s *userStore) handleLookup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		Email string `json:"email"`
+	}
+	_ = json.NewDecoder(r.Body).Decode(&req)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u := s.byEmail(req.Email)
+	if u == nil {
+		w.WriteHeader(http.StatusNotFound)
+		_ = json.NewEncoder(w).Encode(LoginResp{OK: false, Error: "unknown user"})
+		return
+	}
+	claims := map[string]any{"preferred_username": u.Username}
+	for k, v := range u.Claims {
+		claims[k] = v
+	}
+	_ = json.NewEncoder(w).Encode(LoginResp{OK: true, UserID: u.ID, Claims: claims})
+}
+
+type PasswordResetReq struct {
+	UserID      string `json:"user_id"`
+	NewPassword string `json:"new_password"`
+}
+
+// handlePasswordReset sets a password without the old one; the bridge has
+// already checked the emailed token. A reset also clears an expired
+// password, but not a lock.
+func (s *userStore) handlePasswordReset(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req PasswordResetReq
+	_ = json.NewDecoder(r.Body).Decode(&req)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u := s.byID(req.UserID)
+	switch {
+	case u == nil:
+		w.WriteHeader(http.StatusNotFound)
+		_ = json.NewEncoder(w).Encode(LoginResp{OK: false, Error: "unknown user"})
+	case req.NewPassword == u.Password:
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		_ = json.NewEncoder(w).Encode(LoginResp{OK: false, Error: "password_rejected"})
+	default:
+		u.Password = req.NewPassword
+		u.Expired = false
+		_ = json.NewEncoder(w).Encode(LoginResp{OK: true, UserID: u.ID})
+	}
+}
+
+type RegisterReq struct {
+	Email    string            `json:"email"`
+	Name     string            `json:"name"`
+	Password string            `json:"password"`
+	Fields   map[string]string `json:"fields"`
+}
+
+// handleRegister creates a user who signs in with their email. Custom
+// fields come back as claims so they can be seen in the relying party.
+func (s *userStore) handleRegister(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req RegisterReq
+	_ = json.NewDecoder(r.Body).Decode(&req)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.byLogin(req.Email) != nil {
+		w.WriteHeader(http.StatusConflict)
+		_ = json.NewEncoder(w).Encode(LoginResp{OK: false, Error: "account_exists"})
+		return
+	}
+	claims := map[string]any{"email": req.Email, "email_verified": true}
+	if req.Name != "" {
+		claims["name"] = req.Name
+	}
+	for k, v := range req.Fields {
+		claims[k] = v
+	}
+	u := &demoUser{
+		ID:       "user-" + strconv.Itoa(50000+len(s.users)),
+		Username: req.Email,
+		Password: req.Password,
+		Claims:   claims,
+	}
+	s.users = append(s.users, u)
+	_ = json.NewEncoder(w).Encode(LoginResp{OK: true, UserID: u.ID, Claims: u.Claims})
+}
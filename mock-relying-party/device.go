@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const deviceCodeGrant = "urn:ietf:params:oauth:grant-type:device_code"
+
+// postForm sends an OAuth2 form request to Hydra's public endpoint,
+// authenticating as this client, and relays the answer to the browser.
+func postForm(w http.ResponseWriter, endpoint string, form url.Values) ([]byte, int) {
+	if config.UsePKCE || config.ClientSecret == "" {
+		form.Set("client_id", config.ClientID)
+	}
+	req, err := http.NewRequest(http.MethodPost, config.HydraInternalURL+endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "request_failed", err)
+		return nil, 0
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if !config.UsePKCE && config.ClientSecret != "" {
+		req.SetBasicAuth(config.ClientID, config.ClientSecret)
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		writeJSONError(w, http.StatusBadGateway, "connection_failed", err)
+		return nil, 0
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		writeJSONError(w, http.StatusBadGateway, "read_failed", err)
+		return nil, 0
+	}
+	fmt.Printf("%s -> %d %s\n", endpoint, resp.StatusCode, string(body))
+	return body, resp.StatusCode
+}
+
+func writeJSONError(w http.ResponseWriter, status int, code string, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error":             code,
+		"error_description": err.Error(),
+	})
+}
+
+func relay(w http.ResponseWriter, body []byte, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// handleDeviceDemo shows what a TV/CLI would: a code and where to enter it.
+func handleDeviceDemo(w http.ResponseWriter, r *http.Request) {
+	data := map[string]interface{}{"Title": "Device login"}
+	if err := deviceTemplate.ExecuteTemplate(w, "layout", data); err != nil {
+		log.Printf("Error executing device template: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// handleDeviceStart requests a device + user code (RFC 8628 §3.1).
+func handleDeviceStart(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, status := postForm(w, "/oauth2/device/auth", url.Values{
+		"scope": {"openid profile email offline_access"},
+	})
+	if status == 0 {
+		return
+	}
+	relay(w, body, status)
+}
+
+// handleDevicePoll is one token request of the polling loop (RFC 8628 §3.4).
+// authorization_pending / slow_down come back as 400 and the page keeps going.
+func handleDevicePoll(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, status := postForm(w, "/oauth2/token", url.Values{
+		"grant_type":  {deviceCodeGrant},
+		"device_code": {r.FormValue("device_code")},
+	})
+	if status == 0 {
+		return
+	}
+	if status == http.StatusOK {
+		startSession(w, body)
+	}
+	relay(w, body, status)
+}
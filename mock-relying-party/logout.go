@@ -0,0 +1,301 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Local RP sessions, created after a successful token exchange and ended by
+// front-channel or back-channel logout from the OP.
+type rpSession struct {
+	Sub       string    `json:"sub"`
+	Sid       string    `json:"sid"`
+	BridgeSid string    `json:"bridge_sid,omitempty"`
+	IDToken   string    `json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+const rpSessionCookie = "rp_session"
+
+var (
+	sessionsMu sync.Mutex
+	sessions   = map[string]*rpSession{}
+)
+
+const backchannelLogoutEvent = "http://schemas.openid.net/event/backchannel-logout"
+
+func randomID() string {
+	return generateCodeVerifier()
+}
+
+// jwtClaims decodes the payload of a JWT without verifying it. Only used for
+// the ID token we just got straight from the token endpoint over TLS/back-end.
+func jwtClaims(token string) (map[string]any, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed jwt")
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, err
+	}
+	var claims map[string]any
+	if err := json.Unmarshal(raw, &claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// startSession is called with the token endpoint response.
+func startSession(w http.ResponseWriter, tokenResponse []byte) {
+	var tr struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.Unmarshal(tokenResponse, &tr); err != nil || tr.IDToken == "" {
+		return
+	}
+	claims, err := jwtClaims(tr.IDToken)
+	if err != nil {
+		fmt.Printf("session: bad id_token: %v\n", err)
+		return
+	}
+	sess := &rpSession{IDToken: tr.IDToken, CreatedAt: time.Now()}
+	sess.Sub, _ = claims["sub"].(string)
+	sess.Sid, _ = claims["sid"].(string)
+	sess.BridgeSid, _ = claims["bridge_sid"].(string)
+
+	id := randomID()
+	sessionsMu.Lock()
+	sessions[id] = sess
+	sessionsMu.Unlock()
+
+	http.SetCookie(w, &http.Cookie{Name: rpSessionCookie, Value: id, Path: "/", HttpOnly: true, SameSite: http.SameSiteLaxMode})
+	fmt.Printf("session: started sub=%s sid=%s bridge_sid=%s\n", sess.Sub, sess.Sid, sess.BridgeSid)
+}
+
+// endSessions drops every local session matching sid (or sub when sid is empty).
+func endSessions(sid, sub string) int {
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	n := 0
+	for id, s := range sessions {
+		if (sid != "" && s.Sid == sid) || (sid == "" && sub != "" && s.Sub == sub) {
+			delete(sessions, id)
+			n++
+		}
+	}
+	return n
+}
+
+// endCurrentSession drops the session named by the browser's cookie.
+func endCurrentSession(r *http.Request) int {
+	c, err := r.Cookie(rpSessionCookie)
+	if err != nil {
+		return 0
+	}
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	if _, ok := sessions[c.Value]; !ok {
+		return 0
+	}
+	delete(sessions, c.Value)
+	return 1
+}
+
+func currentSession(r *http.Request) (*rpSession, bool) {
+	c, err := r.Cookie(rpSessionCookie)
+	if err != nil {
+		return nil, false
+	}
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	s, ok := sessions[c.Value]
+	return s, ok
+}
+
+// handleMe lets the demo show whether logout reached this RP.
+func handleMe(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if s, ok := currentSession(r); ok {
+		json.NewEncoder(w).Encode(map[string]any{"logged_in": true, "session": s})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]any{"logged_in": false})
+}
+
+// handleLogout starts RP-initiated logout at Hydra.
+func handleLogout(w http.ResponseWriter, r *http.Request) {
+	params := url.Values{
+		"post_logout_redirect_uri": {config.PostLogoutRedirectURI},
+		"state":                    {randomID()},
+	}
+	if s, ok := currentSession(r); ok {
+		params.Set("id_token_hint", s.IDToken)
+	}
+	http.Redirect(w, r, config.HydraPublicURL+"/oauth2/sessions/logout?"+params.Encode(), http.StatusFound)
+}
+
+// handleFrontchannelLogout is loaded in a hidden iframe by the bridge/Hydra.
+// With a sid (frontchannel_logout_session_required) the matching sessions
+// end and iss must name our OP; without one the browser's own session does.
+func handleFrontchannelLogout(w http.ResponseWriter, r *http.Request) {
+	iss := r.URL.Query().Get("iss")
+	sid := r.URL.Query().Get("sid")
+	w.Header().Set("Cache-Control", "no-store")
+
+	if sid == "" {
+		n := endCurrentSession(r)
+		fmt.Printf("frontchannel-logout: no sid, ended %d session(s) from cookie\n", n)
+		w.Write([]byte("ok"))
+		return
+	}
+	if strings.TrimSuffix(iss, "/") != strings.TrimSuffix(config.Issuer, "/") {
+		fmt.Printf("frontchannel-logout: unexpected iss %q\n", iss)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	n := endSessions(sid, "")
+	fmt.Printf("frontchannel-logout: sid=%s ended %d session(s)\n", sid, n)
+	w.Write([]byte("ok"))
+}
+
+// handleBackchannelLogout receives the logout_token POSTed by Hydra
+// (OIDC Back-Channel Logout 1.0) and ends the matching sessions.
+func handleBackchannelLogout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+
+	claims, err := verifyLogoutToken(r.FormValue("logout_token"))
+	if err != nil {
+		fmt.Printf("backchannel-logout: rejected: %v\n", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_request", "error_description": err.Error()})
+		return
+	}
+	sid, _ := claims["sid"].(string)
+	sub, _ := claims["sub"].(string)
+	n := endSessions(sid, sub)
+	fmt.Printf("backchannel-logout: sid=%s sub=%s ended %d session(s)\n", sid, sub, n)
+	w.WriteHeader(http.StatusOK)
+}
+
+type jwk struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+func fetchKey(kid string) (*rsa.PublicKey, error) {
+	client := &http.Client{Timeout: 5 * time.Second}
+	res, err := client.Get(config.HydraInternalURL + "/.well-known/jwks.json")
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&set); err != nil {
+		return nil, err
+	}
+	for _, k := range set.Keys {
+		if k.Kid != kid || k.Kty != "RSA" {
+			continue
+		}
+		n, err1 := base64.RawURLEncoding.DecodeString(k.N)
+		e, err2 := base64.RawURLEncoding.DecodeString(k.E)
+		if err1 != nil || err2 != nil {
+			return nil, errors.New("bad jwk encoding")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	}
+	return nil, fmt.Errorf("no RSA key with kid %q", kid)
+}
+
+func audienceContains(aud any, clientID string) bool {
+	switch v := aud.(type) {
+	case string:
+		return v == clientID
+	case []any:
+		for _, a := range v {
+			if a == clientID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func verifyLogoutToken(token string) (map[string]any, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed logout_token")
+	}
+	rawHeader, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, err
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := json.Unmarshal(rawHeader, &header); err != nil {
+		return nil, err
+	}
+	if header.Alg != "RS256" {
+		return nil, fmt.Errorf("unsupported alg %q", header.Alg)
+	}
+	key, err := fetchKey(header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig); err != nil {
+		return nil, errors.New("bad signature")
+	}
+
+	claims, err := jwtClaims(token)
+	if err != nil {
+		return nil, err
+	}
+	if iss, _ := claims["iss"].(string); strings.TrimSuffix(iss, "/") != strings.TrimSuffix(config.Issuer, "/") {
+		return nil, fmt.Errorf("unexpected iss %q", iss)
+	}
+	if !audienceContains(claims["aud"], config.ClientID) {
+		return nil, errors.New("token not issued for this client")
+	}
+	if iat, ok := claims["iat"].(float64); !ok || time.Since(time.Unix(int64(iat), 0)) > 5*time.Minute {
+		return nil, errors.New("stale or missing iat")
+	}
+	events, _ := claims["events"].(map[string]any)
+	if _, ok := events[backchannelLogoutEvent]; !ok {
+		return nil, errors.New("missing backchannel-logout event")
+	}
+	if _, ok := claims["nonce"]; ok {
+		return nil, errors.New("logout_token must not contain nonce")
+	}
+	if claims["sid"] == nil && claims["sub"] == nil {
+		return nil, errors.New("logout_token needs sid or sub")
+	}
+	return claims, nil
+}
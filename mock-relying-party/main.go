@@ -24,11 +24,17 @@ type Config struct {
 	ClientSecret string
 	RedirectURI  string
 	UsePKCE      bool // true for public clients, false for confidential
+
+	Issuer                string // expected "iss" in logout tokens
+	HydraPublicURL        string // browser-facing Hydra
+	HydraInternalURL      string // Hydra as reachable from this container
+	PostLogoutRedirectURI string
 }
 
 var (
 	homeTemplate    *template.Template
 	successTemplate *template.Template
+	deviceTemplate  *template.Template
 	config          Config
 	codeVerifiers   = make(map[string]string) // For PKCE
 )
@@ -48,6 +54,7 @@ func init() {
 	layoutPath := filepath.Join(templateBase, "layout.html")
 	homePath := filepath.Join(templateBase, "home.html")
 	successPath := filepath.Join(templateBase, "success.html")
+	devicePath := filepath.Join(templateBase, "device.html")
 
 	fmt.Printf("Loading templates from: %s\n", templateBase)
 	fmt.Printf("Layout: %s\n", layoutPath)
@@ -66,6 +73,12 @@ func init() {
 		log.Fatalf("Error parsing success template: %v", err)
 	}
 
+	// Parse layout + device
+	deviceTemplate, err = template.ParseFiles(layoutPath, devicePath)
+	if err != nil {
+		log.Fatalf("Error parsing device template: %v", err)
+	}
+
 	// Load configuration from environment
 	config = Config{
 		Port:         getEnv("PORT", "8091"),
@@ -73,7 +86,12 @@ func init() {
 		ClientSecret: getEnv("CLIENT_SECRET", "demo-secret"),
 		RedirectURI:  getEnv("REDIRECT_URI", "http://localhost:8091/success"),
 		UsePKCE:      getEnv("USE_PKCE", "false") == "true",
+
+		Issuer:           getEnv("ISSUER", "http://localhost:4444"),
+		HydraPublicURL:   getEnv("HYDRA_PUBLIC_URL", "http://localhost:4444"),
+		HydraInternalURL: getEnv("HYDRA_INTERNAL_URL", "http://host.docker.internal:4444"),
 	}
+	config.PostLogoutRedirectURI = getEnv("POST_LOGOUT_REDIRECT_URI", "http://localhost:"+config.Port+"/")
 
 	clientType := "confidential (with secret)"
 	if config.UsePKCE {
@@ -275,6 +293,10 @@ func handleTokenExchange(w http.ResponseWriter, r *http.Request) {
 	fmt.Printf("Status: %d\n", resp.StatusCode)
 	fmt.Printf("Body: %s\n", string(body))
 
+	if resp.StatusCode == http.StatusOK {
+		startSession(w, body)
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(resp.StatusCode)
 	w.Write(body)
@@ -358,6 +380,13 @@ func main() {
 	http.HandleFunc("/success", handleSuccess)
 	http.HandleFunc("/exchange-token", handleTokenExchange)
 	http.HandleFunc("/introspect-token", handleIntrospectToken)
+	http.HandleFunc("/me", handleMe)
+	http.HandleFunc("/device", handleDeviceDemo)
+	http.HandleFunc("/device/start", handleDeviceStart)
+	http.HandleFunc("/device/poll", handleDevicePoll)
+	http.HandleFunc("/logout", handleLogout)
+	http.HandleFunc("/frontchannel-logout", handleFrontchannelLogout)
+	http.HandleFunc("/backchannel-logout", handleBackchannelLogout)
 	http.HandleFunc("/", handleHome)
 
 	addr := ":" + config.Port